@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"wuffnetCMS/middleware"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// Scopes, die Rollen und API-Tokens gewährt werden können
+const (
+	ScopeRead    = "read"    // Tabellen und Datensätze lesen
+	ScopeWrite   = "write"   // Datensätze anlegen und ändern
+	ScopeDelete  = "delete"  // Datensätze löschen
+	ScopePublish = "publish" // Entwürfe prüfen und veröffentlichen (Freigabe-Workflow)
+	ScopeAdmin   = "admin"   // Verwaltung, z. B. Bearbeitungssperren anderer Benutzer aufheben
+)
+
+// Scopes enthält alle gültigen Scopes, z. B. für die Konfigurationsprüfung
+var Scopes = []string{ScopeRead, ScopeWrite, ScopeDelete, ScopePublish, ScopeAdmin}
+
+// Options legt Anmeldung, Rollen und die Gültigkeit von Sitzungen und API-Tokens fest
+type Options struct {
+	OIDC        OIDCOptions         `yaml:"oidc"`
+	Roles       map[string][]string `yaml:"roles"` // Rolle → Scopes
+	TwoFactor   TwoFactorOptions    `yaml:"two_factor"`
+	SessionTTL  time.Duration       `yaml:"session_ttl"`
+	TokenTTL    time.Duration       `yaml:"token_ttl"` // Gültigkeit neuer API-Tokens ohne expiresAt
+	TokenMaxTTL time.Duration       `yaml:"token_max_ttl"`
+}
+
+// OIDCOptions beschreibt den Identity Provider und wie seine Gruppen auf CMS-Rollen abgebildet werden
+type OIDCOptions struct {
+	Issuer       string            `yaml:"issuer"` // Leer = keine Anmeldung, die API bleibt wie bisher offen
+	ClientID     string            `yaml:"client_id"`
+	ClientSecret string            `yaml:"client_secret"` // Leer für öffentliche Clients, PKCE wird immer verwendet
+	RedirectURL  string            `yaml:"redirect_url"`  // Öffentliche URL von /auth/callback
+	Scopes       []string          `yaml:"scopes"`
+	GroupsClaim  string            `yaml:"groups_claim"` // Claim im ID-Token mit den Gruppen des Benutzers
+	GroupRoles   map[string]string `yaml:"group_roles"`  // Gruppe → Rolle
+	DefaultRole  string            `yaml:"default_role"` // Rolle ohne passende Gruppe; leer = Anmeldung abgelehnt
+}
+
+// TwoFactorOptions legt fest, für welche Rollen TOTP als zweiter Faktor Pflicht ist
+type TwoFactorOptions struct {
+	RequiredRoles []string `yaml:"required_roles"`
+	Issuer        string   `yaml:"issuer"` // Name des Eintrags in der Authenticator-App
+}
+
+// Service meldet Benutzer über OIDC an und prüft Sitzungen und API-Tokens.
+// Ein nil-Service bedeutet: Anmeldung ist ausgeschaltet.
+type Service struct {
+	db       *sql.DB
+	schema   string
+	opts     Options
+	verifier *oidc.IDTokenVerifier
+	oauth    oauth2.Config
+	secure   bool // Cookies nur über HTTPS senden
+	lockout  *middleware.Lockout
+}
+
+// New liest die Discovery des Identity Providers; ohne Issuer liefert es nil (Anmeldung aus).
+// schema ist das Metadaten-Schema mit den Tabellen users, sessions und api_tokens;
+// lockout begrenzt fehlgeschlagene Prüfungen des zweiten Faktors je Benutzer.
+func New(ctx context.Context, db *sql.DB, schema string, opts Options, lockout middleware.LockoutOptions) (*Service, error) {
+	if opts.OIDC.Issuer == "" {
+		return nil, nil
+	}
+	provider, err := oidc.NewProvider(ctx, opts.OIDC.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+	return &Service{
+		db:       db,
+		schema:   schema,
+		opts:     opts,
+		verifier: provider.Verifier(&oidc.Config{ClientID: opts.OIDC.ClientID}),
+		oauth: oauth2.Config{
+			ClientID:     opts.OIDC.ClientID,
+			ClientSecret: opts.OIDC.ClientSecret,
+			RedirectURL:  opts.OIDC.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       opts.OIDC.Scopes,
+		},
+		secure:  strings.HasPrefix(opts.OIDC.RedirectURL, "https://"),
+		lockout: middleware.NewLockout(lockout),
+	}, nil
+}
+
+// Principal ist der angemeldete Benutzer einer Anfrage, per Sitzung oder API-Token
+type Principal struct {
+	UserID  int64
+	Name    string
+	Email   string
+	Roles   []string
+	Scopes  []string
+	TokenID int64  // Gesetzt bei Anmeldung per API-Token
+	session string // Hash des Sitzungs-Cookies, gesetzt bei Anmeldung per Sitzung
+	totp    bool   // TOTP ist eingerichtet
+	pending string // Noch ausstehender zweiter Faktor (pendingVerify, bei Tokens nur pendingEnroll)
+}
+
+const (
+	pendingVerify = "verify" // TOTP-Code bzw. Wiederherstellungscode fehlt noch
+	pendingEnroll = "enroll" // Die Rolle verlangt TOTP, es ist aber noch nicht eingerichtet
+)
+
+// Can prüft, ob der Principal den Scope besitzt; solange der zweite Faktor aussteht, hat er keinen
+func (p *Principal) Can(scope string) bool {
+	return p.pending == "" && slices.Contains(p.Scopes, scope)
+}
+
+type contextKey int
+
+const (
+	principalKey contextKey = iota
+	invalidKey              // Anfrage mit ungültigen Anmeldedaten
+)
+
+// NewContext hinterlegt den angemeldeten Benutzer für FromContext
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// FromContext liefert den angemeldeten Benutzer, nil ohne Anmeldung
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey).(*Principal)
+	return p
+}
+
+// Allowed prüft einen Scope für Vorgänge, die nicht schon an der Route entschieden werden (z. B. GraphQL-Mutationen).
+// Ohne Principal ist die Anmeldung ausgeschaltet, denn sonst weist Authorize die Anfrage vorher ab.
+func Allowed(ctx context.Context, scope string) bool {
+	p := FromContext(ctx)
+	return p == nil || p.Can(scope)
+}
+
+// scopesFor vereinigt die Scopes der angegebenen Rollen
+func (s *Service) scopesFor(roles []string) []string {
+	var scopes []string
+	for _, scope := range Scopes {
+		for _, role := range roles {
+			if slices.Contains(s.opts.Roles[role], scope) {
+				scopes = append(scopes, scope)
+				break
+			}
+		}
+	}
+	return scopes
+}
+
+// requiresTwoFactor prüft, ob eine der Rollen TOTP verlangt
+func (s *Service) requiresTwoFactor(roles []string) bool {
+	for _, role := range roles {
+		if slices.Contains(s.opts.TwoFactor.RequiredRoles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// rolesFor bildet die Gruppen aus dem ID-Token auf CMS-Rollen ab
+func (s *Service) rolesFor(groups []string) []string {
+	var roles []string
+	for _, group := range groups {
+		if role, ok := s.opts.OIDC.GroupRoles[group]; ok && !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	if len(roles) == 0 && s.opts.OIDC.DefaultRole != "" {
+		roles = append(roles, s.opts.OIDC.DefaultRole)
+	}
+	slices.Sort(roles)
+	return roles
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// tokenQuery erkennt die Abfrage von tokenPrincipal
+var tokenQuery = regexp.QuoteMeta(`FROM "cms"."api_tokens" t JOIN "cms"."users" u`)
+
+func tokenRows(scopes, roles string, totp bool) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "scopes", "last_used_at", "user_id", "name", "email", "roles", "totp"}).
+		AddRow(3, scopes, time.Now(), 42, "alice", "alice@example.org", roles, totp)
+}
+
+func TestAuthorizeAPITokens(t *testing.T) {
+	secret := tokenPrefix + "secret"
+	tests := []struct {
+		name   string
+		method string
+		header string
+		rows   *sqlmock.Rows // nil = kein Treffer, also widerrufen oder abgelaufen
+		status int
+	}{
+		{"read token on read route", http.MethodGet, "Bearer " + secret, tokenRows(`{"read"}`, `{"editor"}`, false), http.StatusOK},
+		{"read token on write route", http.MethodPost, "Bearer " + secret, tokenRows(`{"read"}`, `{"editor"}`, false), http.StatusForbidden},
+		{"write token on write route", http.MethodPost, "Bearer " + secret, tokenRows(`{"read","write"}`, `{"editor"}`, false), http.StatusOK},
+		{"token scope no longer granted by role", http.MethodPost, "Bearer " + secret, tokenRows(`{"read","write"}`, `{"viewer"}`, false), http.StatusForbidden},
+		{"admin token without TOTP", http.MethodGet, "Bearer " + secret, tokenRows(`{"read"}`, `{"admin"}`, false), http.StatusForbidden},
+		{"admin token with TOTP", http.MethodGet, "Bearer " + secret, tokenRows(`{"read"}`, `{"admin"}`, true), http.StatusOK},
+		{"revoked or expired token", http.MethodGet, "Bearer " + secret, nil, http.StatusUnauthorized},
+		{"revoked token on public route", http.MethodHead, "Bearer " + secret, nil, http.StatusUnauthorized},
+		{"foreign bearer token", http.MethodGet, "Bearer eyJhbGciOi", nil, http.StatusUnauthorized},
+		{"no credentials", http.MethodGet, "", nil, http.StatusUnauthorized},
+		{"no credentials on public route", http.MethodHead, "", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			s := &Service{db: db, schema: "cms", opts: Options{Roles: map[string][]string{
+				"viewer": {ScopeRead},
+				"editor": {ScopeRead, ScopeWrite},
+				"admin":  {ScopeRead, ScopeWrite, ScopeAdmin},
+			}, TwoFactor: TwoFactorOptions{RequiredRoles: []string{"admin"}}}}
+			if tt.header == "Bearer "+secret {
+				query := mock.ExpectQuery(tokenQuery).WithArgs(hashSecret(secret))
+				if tt.rows != nil {
+					query.WillReturnRows(tt.rows)
+				} else {
+					query.WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				}
+			}
+
+			// HEAD ist hier öffentlich, GET verlangt read, alles andere write
+			scope := func(r *http.Request) string {
+				switch r.Method {
+				case http.MethodHead:
+					return ""
+				case http.MethodGet:
+					return ScopeRead
+				}
+				return ScopeWrite
+			}
+			handler := s.Authenticate(s.Authorize(scope, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})))
+
+			r := httptest.NewRequest(tt.method, "/api/tables/cms/pages", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if tt.status == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate header")
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"wuffnetCMS/middleware"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// SessionCookie enthält den geheimen Wert der Browser-Sitzung
+	SessionCookie = "cms_session"
+	// loginCookie hält state, nonce und PKCE-Verifier zwischen Weiterleitung und Callback
+	loginCookie = "cms_login"
+	// So lange darf die Anmeldung beim Identity Provider dauern
+	loginTimeout = 10 * time.Minute
+)
+
+// Login leitet zum Identity Provider weiter (Authorization Code Flow mit PKCE)
+func (s *Service) Login(w http.ResponseWriter, r *http.Request) {
+	if s == nil {
+		notConfigured(w, r)
+		return
+	}
+	state, nonce, verifier := newSecret(), newSecret(), oauth2.GenerateVerifier()
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookie,
+		Value:    state + "." + nonce + "." + verifier,
+		Path:     "/auth/",
+		MaxAge:   int(loginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   s.secure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode, // Der Callback ist eine Weiterleitung vom Identity Provider
+	})
+	url := s.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// Callback schließt die Anmeldung ab: Code einlösen, ID-Token prüfen, Rollen zuordnen und Sitzung anlegen
+func (s *Service) Callback(w http.ResponseWriter, r *http.Request) {
+	if s == nil {
+		notConfigured(w, r)
+		return
+	}
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	cookie, err := r.Cookie(loginCookie)
+	http.SetCookie(w, &http.Cookie{Name: loginCookie, Path: "/auth/", MaxAge: -1, HttpOnly: true, Secure: s.secure || r.TLS != nil})
+	var parts []string
+	if err == nil {
+		parts = strings.Split(cookie.Value, ".")
+	}
+	if len(parts) != 3 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(query.Get("state"))) != 1 {
+		middleware.WriteError(w, r, http.StatusBadRequest, "login_failed", "Login expired or was started in another browser. Please try again.")
+		return
+	}
+	nonce, verifier := parts[1], parts[2]
+
+	if reason := query.Get("error"); reason != "" {
+		middleware.WriteError(w, r, http.StatusForbidden, "login_failed", "The identity provider refused the login: "+reason+".")
+		return
+	}
+
+	token, err := s.oauth.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		middleware.Logger(ctx).Warn("OIDC code exchange failed", "error", err)
+		middleware.WriteError(w, r, http.StatusBadGateway, "login_failed", "Could not complete the login with the identity provider.")
+		return
+	}
+	rawIDToken, _ := token.Extra("id_token").(string)
+	idToken, err := s.verifier.Verify(ctx, rawIDToken)
+	if err != nil || subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		middleware.Logger(ctx).Warn("Invalid ID token", "error", err)
+		middleware.WriteError(w, r, http.StatusBadGateway, "login_failed", "The identity provider returned an invalid ID token.")
+		return
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		middleware.WriteError(w, r, http.StatusBadGateway, "login_failed", "The identity provider returned an invalid ID token.")
+		return
+	}
+	email, _ := claims["email"].(string)
+	name := idToken.Subject
+	for _, claim := range []string{"preferred_username", "email", "name"} {
+		if value, _ := claims[claim].(string); value != "" {
+			name = value
+			break
+		}
+	}
+	middleware.SetUser(ctx, idToken.Issuer+" "+idToken.Subject, name)
+
+	groups := stringList(claims[s.opts.OIDC.GroupsClaim])
+	roles := s.rolesFor(groups)
+	if len(roles) == 0 {
+		middleware.Logger(ctx).Info("Login without CMS role", "groups", groups)
+		middleware.WriteError(w, r, http.StatusForbidden, "forbidden", "Your account has no access to the CMS.")
+		return
+	}
+
+	userID, err := s.upsertUser(ctx, idToken.Issuer, idToken.Subject, name, email, roles)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	secret, expires, err := s.createSession(ctx, userID)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	http.SetCookie(w, s.sessionCookie(r, secret, expires))
+	middleware.Logger(ctx).Info("User logged in", "roles", roles)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// Logout beendet die Browser-Sitzung
+func (s *Service) Logout(w http.ResponseWriter, r *http.Request) {
+	if s == nil {
+		notConfigured(w, r)
+		return
+	}
+	if p := FromContext(r.Context()); p != nil && p.session != "" {
+		if err := s.deleteSession(r.Context(), p.session); err != nil {
+			internalError(w, r, err)
+			return
+		}
+	}
+	http.SetCookie(w, s.sessionCookie(r, "", time.Time{}))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Me liefert den angemeldeten Benutzer mit Rollen und wirksamen Scopes, z. B. für die Oberfläche
+func (s *Service) Me(w http.ResponseWriter, r *http.Request) {
+	if s == nil {
+		notConfigured(w, r)
+		return
+	}
+	p := FromContext(r.Context())
+	if p == nil {
+		unauthorized(w, r, "Bearer", "Authentication required.")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"name":   p.Name,
+		"email":  p.Email,
+		"roles":  p.Roles,
+		"scopes": p.Scopes,
+		// secondFactor: "verify" oder "enroll", solange die Sitzung noch nicht freigegeben ist
+		"secondFactor":      p.pending,
+		"twoFactor":         p.totp,
+		"twoFactorRequired": s.requiresTwoFactor(p.Roles),
+	})
+}
+
+// sessionCookie setzt bzw. löscht (leerer Wert) das Sitzungs-Cookie
+func (s *Service) sessionCookie(r *http.Request, secret string, expires time.Time) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     SessionCookie,
+		Value:    secret,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   s.secure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode, // Muss die Weiterleitung vom Callback zur Hauptseite überstehen
+	}
+	if secret == "" {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// stringList liest einen Claim, der ein einzelner String oder eine Liste von Strings sein kann
+func stringList(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var list []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func notConfigured(w http.ResponseWriter, r *http.Request) {
+	middleware.WriteError(w, r, http.StatusNotFound, "not_found", "Login is not configured.")
+}
+
+func internalError(w http.ResponseWriter, r *http.Request, err error) {
+	middleware.Logger(r.Context()).Error("Request failed", "status", http.StatusInternalServerError, "error", err)
+	middleware.WriteError(w, r, http.StatusInternalServerError, "internal_error", "An internal error occurred.")
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
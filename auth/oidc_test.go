@@ -0,0 +1,355 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"wuffnetCMS/middleware"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-jose/go-jose/v4"
+)
+
+// mockProvider ist ein lokaler OIDC-Provider mit Discovery, JWKS und Token-Endpunkt.
+// Die Anmeldung beim Provider selbst übernimmt authorize: sie merkt sich PKCE-Challenge und Nonce zum Code.
+type mockProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	codes  map[string]authorization
+	claims map[string]interface{} // Zusätzliche Claims des ID-Tokens
+	nonce  *string                // Überschreibt die Nonce im ID-Token
+}
+
+type authorization struct {
+	challenge string
+	nonce     string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &mockProvider{key: key, codes: map[string]authorization{}, claims: map[string]interface{}{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("POST /token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// authorize spielt die Anmeldung beim Provider für die URL aus Login und liefert den Code für den Callback
+func (p *mockProvider) authorize(t *testing.T, location string) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(location)
+	if err != nil || !strings.HasPrefix(location, p.URL+"/authorize") {
+		t.Fatalf("Login redirected to %q", location)
+	}
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("Login did not request PKCE: %q", location)
+	}
+	code = newSecret()
+	p.mu.Lock()
+	p.codes[code] = authorization{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	p.mu.Unlock()
+	return code, query.Get("state")
+}
+
+// token löst einen Code ein, wenn der PKCE-Verifier zur Challenge passt
+func (p *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	auth, ok := p.codes[r.FormValue("code")]
+	delete(p.codes, r.FormValue("code"))
+	sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss":   p.URL,
+		"sub":   "alice-sub",
+		"aud":   "cms",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": auth.nonce,
+	}
+	if p.nonce != nil {
+		claims["nonce"] = *p.nonce
+	}
+	for name, value := range p.claims {
+		claims[name] = value
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: p.key}, (&jose.SignerOptions{}).WithHeader("kid", "test"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	payload, _ := json.Marshal(claims)
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	idToken, _ := signed.CompactSerialize()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access", "token_type": "Bearer", "expires_in": 60, "id_token": idToken,
+	})
+}
+
+// capture merkt sich den Wert eines SQL-Arguments, z. B. den Hash der neuen Sitzung
+type capture struct{ value driver.Value }
+
+func (c *capture) Match(v driver.Value) bool {
+	c.value = v
+	return true
+}
+
+func newTestService(t *testing.T, provider *mockProvider) (*Service, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s, err := New(context.Background(), db, "cms", Options{
+		OIDC: OIDCOptions{
+			Issuer:      provider.URL,
+			ClientID:    "cms",
+			RedirectURL: "http://cms.example.org/auth/callback",
+			Scopes:      []string{"openid", "profile", "email"},
+			GroupsClaim: "groups",
+			GroupRoles:  map[string]string{"cms-editors": "editor", "cms-admins": "admin"},
+		},
+		Roles: map[string][]string{
+			"viewer": {ScopeRead},
+			"editor": {ScopeRead, ScopeWrite},
+			"admin":  {ScopeRead, ScopeWrite, ScopeDelete, ScopePublish, ScopeAdmin},
+		},
+		SessionTTL: time.Hour,
+	}, middleware.LockoutOptions{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return s, mock
+}
+
+// startLogin ruft Login auf und liefert Code, State und das Login-Cookie für den Callback
+func startLogin(t *testing.T, s *Service, provider *mockProvider) (code, state string, cookie *http.Cookie) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.Login(rec, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Login status = %d", rec.Code)
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == loginCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly {
+		t.Fatalf("Login did not set an HttpOnly %s cookie", loginCookie)
+	}
+	code, state = provider.authorize(t, rec.Header().Get("Location"))
+	return code, state, cookie
+}
+
+func callback(s *Service, code, state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/auth/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	s.Callback(rec, r)
+	return rec
+}
+
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid error body %q", rec.Body.String())
+	}
+	return body.Error.Code
+}
+
+func TestCallbackCreatesSession(t *testing.T) {
+	provider := newMockProvider(t)
+	provider.claims["preferred_username"] = "alice"
+	provider.claims["email"] = "alice@example.org"
+	provider.claims["groups"] = []string{"cms-editors", "unrelated"}
+	s, mock := newTestService(t, provider)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "cms"."users"`)).
+		WithArgs(provider.URL, "alice-sub", "alice", "alice@example.org", `{"editor"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "cms"."sessions" WHERE expires_at < now()`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	hash := &capture{}
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "cms"."sessions"`)).
+		WithArgs(hash, 42, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	code, state, cookie := startLogin(t, s, provider)
+	rec := callback(s, code, state, cookie)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/" {
+		t.Fatalf("Callback = %d %q, body %s", rec.Code, rec.Header().Get("Location"), rec.Body.String())
+	}
+	var session *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == SessionCookie {
+			session = c
+		}
+	}
+	if session == nil || session.Value == "" {
+		t.Fatal("Callback did not set a session cookie")
+	}
+	if !session.HttpOnly || session.SameSite != http.SameSiteLaxMode || session.Path != "/" {
+		t.Errorf("session cookie attributes = %+v", session)
+	}
+	if hash.value != hashSecret(session.Value) {
+		t.Errorf("stored session hash %v does not belong to the cookie", hash.value)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCallbackRejectsStateMismatch(t *testing.T) {
+	provider := newMockProvider(t)
+	s, mock := newTestService(t, provider)
+
+	code, _, cookie := startLogin(t, s, provider)
+	for name, state := range map[string]string{"wrong state": "forged", "empty state": ""} {
+		rec := callback(s, code, state, cookie)
+		if rec.Code != http.StatusBadRequest || errorCode(t, rec) != "login_failed" {
+			t.Errorf("%s: Callback = %d %s", name, rec.Code, rec.Body.String())
+		}
+	}
+	_, state, _ := startLogin(t, s, provider)
+	if rec := callback(s, code, state, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("without login cookie: Callback = %d", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCallbackRejectsNonceMismatch(t *testing.T) {
+	provider := newMockProvider(t)
+	forged := "replayed-nonce"
+	provider.nonce = &forged
+	s, mock := newTestService(t, provider)
+
+	code, state, cookie := startLogin(t, s, provider)
+	rec := callback(s, code, state, cookie)
+	if rec.Code != http.StatusBadGateway || errorCode(t, rec) != "login_failed" {
+		t.Errorf("Callback = %d %s", rec.Code, rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCallbackSendsPKCEVerifier(t *testing.T) {
+	provider := newMockProvider(t)
+	s, mock := newTestService(t, provider)
+
+	// Der Provider löst den Code nur mit dem Verifier aus dem Login-Cookie ein
+	code, state, cookie := startLogin(t, s, provider)
+	parts := strings.Split(cookie.Value, ".")
+	parts[2] = newSecret()
+	tampered := &http.Cookie{Name: cookie.Name, Value: strings.Join(parts, ".")}
+	if rec := callback(s, code, state, tampered); rec.Code != http.StatusBadGateway {
+		t.Errorf("wrong verifier: Callback = %d %s", rec.Code, rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCallbackMapsGroupsToRoles(t *testing.T) {
+	tests := []struct {
+		name        string
+		groups      interface{}
+		defaultRole string
+		roles       string // Rollen-Array für upsertUser, leer = Anmeldung abgelehnt
+	}{
+		{"single group", []string{"cms-editors"}, "", `{"editor"}`},
+		{"several groups sorted", []string{"cms-editors", "cms-admins", "cms-editors"}, "", `{"admin","editor"}`},
+		{"group as string", "cms-admins", "", `{"admin"}`},
+		{"default role", []string{"unrelated"}, "viewer", `{"viewer"}`},
+		{"no role", []string{"unrelated"}, "", ""},
+		{"no groups", nil, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newMockProvider(t)
+			provider.claims["preferred_username"] = "alice"
+			if tt.groups != nil {
+				provider.claims["groups"] = tt.groups
+			}
+			s, mock := newTestService(t, provider)
+			s.opts.OIDC.DefaultRole = tt.defaultRole
+
+			if tt.roles != "" {
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "cms"."users"`)).
+					WithArgs(provider.URL, "alice-sub", "alice", "", tt.roles).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+				mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "cms"."sessions"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "cms"."sessions"`)).WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+
+			code, state, cookie := startLogin(t, s, provider)
+			rec := callback(s, code, state, cookie)
+			want := http.StatusFound
+			if tt.roles == "" {
+				want = http.StatusForbidden
+			}
+			if rec.Code != want {
+				t.Errorf("Callback = %d, want %d: %s", rec.Code, want, rec.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
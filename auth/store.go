@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Präfix aller API-Tokens, damit sie z. B. in Logs und Secret-Scannern erkennbar sind
+const tokenPrefix = "wcms_"
+
+// apiToken beschreibt ein API-Token ohne den geheimen Wert
+type apiToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // Anfang des Tokens zum Wiedererkennen
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// table liefert den gequoteten Namen einer Tabelle im Metadaten-Schema
+func (s *Service) table(name string) string {
+	return pq.QuoteIdentifier(s.schema) + "." + pq.QuoteIdentifier(name)
+}
+
+// newSecret erzeugt einen zufälligen Wert für Sitzungs-Cookies und API-Tokens
+func newSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// hashSecret bildet den gespeicherten Hash; die Werte sind zufällig genug für SHA-256 ohne Salt
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// upsertUser legt den Benutzer bei der ersten Anmeldung an und übernimmt danach Name, E-Mail und Rollen
+func (s *Service) upsertUser(ctx context.Context, issuer, subject, name, email string, roles []string) (int64, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (issuer, subject, name, email, roles, last_login_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, now())
+		ON CONFLICT (issuer, subject) DO UPDATE
+		SET name = EXCLUDED.name, email = EXCLUDED.email, roles = EXCLUDED.roles, last_login_at = now()
+		RETURNING id`, s.table("users"))
+
+	var id int64
+	if err := s.db.QueryRowContext(ctx, query, issuer, subject, name, email, pq.Array(roles)).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to save user: %w", err)
+	}
+	return id, nil
+}
+
+// createSession legt eine Sitzung an und liefert den Wert für das Cookie; abgelaufene Sitzungen werden dabei entfernt
+func (s *Service) createSession(ctx context.Context, userID int64) (string, time.Time, error) {
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE expires_at < now()", s.table("sessions"))); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to remove expired sessions: %w", err)
+	}
+
+	secret := newSecret()
+	expires := time.Now().Add(s.opts.SessionTTL)
+	query := fmt.Sprintf("INSERT INTO %s (token_hash, user_id, expires_at) VALUES ($1, $2, $3)", s.table("sessions"))
+	if _, err := s.db.ExecContext(ctx, query, hashSecret(secret), userID, expires); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create session: %w", err)
+	}
+	return secret, expires, nil
+}
+
+// sessionPrincipal liefert den Benutzer einer gültigen Sitzung, nil wenn sie unbekannt oder abgelaufen ist
+func (s *Service) sessionPrincipal(ctx context.Context, secret string) (*Principal, error) {
+	query := fmt.Sprintf(`
+		SELECT u.id, u.name, COALESCE(u.email, ''), u.roles, u.totp_enabled_at IS NOT NULL, s.verified
+		FROM %s s JOIN %s u ON u.id = s.user_id
+		WHERE s.token_hash = $1 AND s.expires_at > now()`, s.table("sessions"), s.table("users"))
+
+	p := &Principal{session: hashSecret(secret)}
+	var verified bool
+	err := s.db.QueryRowContext(ctx, query, p.session).Scan(&p.UserID, &p.Name, &p.Email, pq.Array(&p.Roles), &p.totp, &verified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+	p.Scopes = s.scopesFor(p.Roles)
+
+	// Die Richtlinie gilt auch für bestehende Sitzungen, sobald sie geändert wird
+	switch {
+	case p.totp && !verified:
+		p.pending = pendingVerify
+	case !p.totp && s.requiresTwoFactor(p.Roles):
+		p.pending = pendingEnroll
+	}
+	return p, nil
+}
+
+func (s *Service) deleteSession(ctx context.Context, hash string) error {
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE token_hash = $1", s.table("sessions")), hash); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// tokenPrincipal liefert den Benutzer eines gültigen API-Tokens, nil wenn es unbekannt oder abgelaufen ist.
+// Wirksam sind nur Scopes, die das Token hat und die Rollen des Benutzers weiterhin gewähren.
+// Verlangt eine Rolle TOTP, gilt das Token erst, wenn der Benutzer es eingerichtet hat.
+func (s *Service) tokenPrincipal(ctx context.Context, secret string) (*Principal, error) {
+	query := fmt.Sprintf(`
+		SELECT t.id, t.scopes, t.last_used_at, u.id, u.name, COALESCE(u.email, ''), u.roles, u.totp_enabled_at IS NOT NULL
+		FROM %s t JOIN %s u ON u.id = t.user_id
+		WHERE t.token_hash = $1 AND t.expires_at > now()`, s.table("api_tokens"), s.table("users"))
+
+	p := &Principal{}
+	var tokenScopes []string
+	var lastUsed sql.NullTime
+	err := s.db.QueryRowContext(ctx, query, hashSecret(secret)).
+		Scan(&p.TokenID, pq.Array(&tokenScopes), &lastUsed, &p.UserID, &p.Name, &p.Email, pq.Array(&p.Roles), &p.totp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API token: %w", err)
+	}
+	for _, scope := range s.scopesFor(p.Roles) {
+		for _, granted := range tokenScopes {
+			if scope == granted {
+				p.Scopes = append(p.Scopes, scope)
+			}
+		}
+	}
+	if !p.totp && s.requiresTwoFactor(p.Roles) {
+		p.pending = pendingEnroll
+	}
+
+	// Letzte Verwendung höchstens minütlich festhalten, um nicht jede Anfrage schreiben zu lassen
+	if !lastUsed.Valid || time.Since(lastUsed.Time) > time.Minute {
+		query := fmt.Sprintf("UPDATE %s SET last_used_at = now() WHERE id = $1", s.table("api_tokens"))
+		if _, err := s.db.ExecContext(ctx, query, p.TokenID); err != nil {
+			return nil, fmt.Errorf("failed to update API token: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// createToken speichert ein neues API-Token und liefert einmalig den geheimen Wert
+func (s *Service) createToken(ctx context.Context, userID int64, name string, scopes []string, expires time.Time) (apiToken, string, error) {
+	secret := tokenPrefix + newSecret()
+	token := apiToken{Name: name, Prefix: secret[:len(tokenPrefix)+6], Scopes: scopes, ExpiresAt: expires}
+	query := fmt.Sprintf(`
+		INSERT INTO %s (user_id, name, prefix, token_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`, s.table("api_tokens"))
+
+	err := s.db.QueryRowContext(ctx, query, userID, name, token.Prefix, hashSecret(secret), pq.Array(scopes), expires).
+		Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return apiToken{}, "", fmt.Errorf("failed to create API token: %w", err)
+	}
+	return token, secret, nil
+}
+
+// listTokens liefert die API-Tokens eines Benutzers, neueste zuerst
+func (s *Service) listTokens(ctx context.Context, userID int64) ([]apiToken, error) {
+	query := fmt.Sprintf(`
+		SELECT id, name, prefix, scopes, created_at, expires_at, last_used_at
+		FROM %s WHERE user_id = $1 ORDER BY created_at DESC`, s.table("api_tokens"))
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []apiToken{}
+	for rows.Next() {
+		var token apiToken
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&token.ID, &token.Name, &token.Prefix, pq.Array(&token.Scopes), &token.CreatedAt, &token.ExpiresAt, &lastUsed); err != nil {
+			return nil, fmt.Errorf("failed to scan API token: %w", err)
+		}
+		if lastUsed.Valid {
+			token.LastUsedAt = &lastUsed.Time
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// deleteToken widerruft ein API-Token des Benutzers; false, wenn es keines mit dieser ID gibt
+func (s *Service) deleteToken(ctx context.Context, userID, id int64) (bool, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1 AND user_id = $2", s.table("api_tokens"))
+	result, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete API token: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+	"wuffnetCMS/middleware"
+)
+
+// ListTokens liefert die API-Tokens des angemeldeten Benutzers (ohne geheime Werte)
+func (s *Service) ListTokens(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.tokenOwner(w, r)
+	if !ok {
+		return
+	}
+	tokens, err := s.listTokens(r.Context(), p.UserID)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// CreateToken legt ein API-Token an. Der geheime Wert steht nur in dieser Antwort und wird nicht gespeichert.
+func (s *Service) CreateToken(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.tokenOwner(w, r)
+	if !ok {
+		return
+	}
+	var request struct {
+		Name      string    `json:"name"`
+		Scopes    []string  `json:"scopes"`    // Leer = alle Scopes des Benutzers
+		ExpiresAt time.Time `json:"expiresAt"` // Leer = token_ttl ab jetzt
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		middleware.WriteError(w, r, http.StatusBadRequest, "bad_request", "Invalid input")
+		return
+	}
+
+	if request.Name == "" || len(request.Name) > 100 {
+		middleware.WriteError(w, r, http.StatusBadRequest, "bad_request", "Token name must be between 1 and 100 characters.")
+		return
+	}
+	if len(request.Scopes) == 0 {
+		request.Scopes = p.Scopes
+	}
+	for _, scope := range request.Scopes {
+		if !p.Can(scope) {
+			middleware.WriteError(w, r, http.StatusForbidden, "forbidden", "Your roles do not grant the scope "+strconv.Quote(scope)+".")
+			return
+		}
+	}
+	slices.Sort(request.Scopes)
+	request.Scopes = slices.Compact(request.Scopes)
+
+	now := time.Now()
+	if request.ExpiresAt.IsZero() {
+		request.ExpiresAt = now.Add(s.opts.TokenTTL)
+	}
+	if !request.ExpiresAt.After(now) || request.ExpiresAt.After(now.Add(s.opts.TokenMaxTTL)) {
+		middleware.WriteError(w, r, http.StatusBadRequest, "bad_request", "expiresAt must be in the future and at most "+s.opts.TokenMaxTTL.String()+" ahead.")
+		return
+	}
+
+	token, secret, err := s.createToken(r.Context(), p.UserID, request.Name, request.Scopes, request.ExpiresAt)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	middleware.Logger(r.Context()).Info("API token created", "token_id", token.ID, "scopes", token.Scopes, "expires_at", token.ExpiresAt)
+	writeJSON(w, http.StatusCreated, struct {
+		apiToken
+		Token string `json:"token"`
+	}{token, secret})
+}
+
+// DeleteToken widerruft ein API-Token des angemeldeten Benutzers
+func (s *Service) DeleteToken(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.tokenOwner(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		middleware.WriteError(w, r, http.StatusBadRequest, "bad_request", "Invalid token ID")
+		return
+	}
+	deleted, err := s.deleteToken(r.Context(), p.UserID, id)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if !deleted {
+		middleware.WriteError(w, r, http.StatusNotFound, "not_found", "Token not found")
+		return
+	}
+	middleware.Logger(r.Context()).Info("API token revoked", "token_id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tokenOwner verlangt eine Browser-Sitzung; mit einem API-Token lassen sich keine weiteren Tokens verwalten
+func (s *Service) tokenOwner(w http.ResponseWriter, r *http.Request) (*Principal, bool) {
+	if s == nil {
+		notConfigured(w, r)
+		return nil, false
+	}
+	p := FromContext(r.Context())
+	if p == nil {
+		unauthorized(w, r, "Bearer", "Authentication required.")
+		return nil, false
+	}
+	if p.session == "" {
+		middleware.WriteError(w, r, http.StatusForbidden, "forbidden", "API tokens can only be managed from a browser session.")
+		return nil, false
+	}
+	if p.pending != "" {
+		secondFactorRequired(w, r)
+		return nil, false
+	}
+	return p, true
+}
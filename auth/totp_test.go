@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// Testvektoren aus RFC 6238, Anhang B (SHA1); die 6-stelligen Codes sind die letzten Stellen der 8-stelligen
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		step := tt.unix / int64(totpPeriod.Seconds())
+		if code := totpCode(key, step); code != tt.code {
+			t.Errorf("T=%d: totpCode = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestTOTPMatch(t *testing.T) {
+	key := []byte("12345678901234567890")
+	secret := base32NoPadding.EncodeToString(key)
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / int64(totpPeriod.Seconds())
+
+	tests := []struct {
+		name string
+		code string
+		step int64
+		ok   bool
+	}{
+		{"current step", totpCode(key, current), current, true},
+		{"with spaces", "050 471", current, true},
+		{"previous step within skew", totpCode(key, current-1), current - 1, true},
+		{"next step within skew", totpCode(key, current+1), current + 1, true},
+		{"outside skew", totpCode(key, current-2), 0, false},
+		{"wrong code", "000000", 0, false},
+		{"too short", "05047", 0, false},
+	}
+	for _, tt := range tests {
+		step, ok := totpMatch(secret, tt.code, now)
+		if ok != tt.ok || step != tt.step {
+			t.Errorf("%s: totpMatch = %d, %v, want %d, %v", tt.name, step, ok, tt.step, tt.ok)
+		}
+	}
+	if _, ok := totpMatch("not base32!", "050471", now); ok {
+		t.Error("invalid secret accepted")
+	}
+}
+
+// Ein Code gilt nur einmal: checkTOTP verbraucht seinen Zeitschritt über totp_last_step
+func TestCheckTOTPRejectsReplay(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := &Service{db: db, schema: "cms"}
+
+	key := []byte("12345678901234567890")
+	secret := base32NoPadding.EncodeToString(key)
+	step := time.Now().Unix() / int64(totpPeriod.Seconds())
+	code := totpCode(key, step)
+
+	secretQuery := regexp.QuoteMeta(`SELECT COALESCE(totp_secret, '') FROM "cms"."users" WHERE id = $1`)
+	consume := regexp.QuoteMeta(`UPDATE "cms"."users" SET totp_last_step = $2`) +
+		`\s+` + regexp.QuoteMeta(`WHERE id = $1 AND totp_enabled_at IS NOT NULL AND (totp_last_step IS NULL OR totp_last_step < $2)`)
+
+	// Erste Verwendung: der Schritt ist neuer als totp_last_step
+	mock.ExpectQuery(secretQuery).WithArgs(42).WillReturnRows(sqlmock.NewRows([]string{"secret"}).AddRow(secret))
+	mock.ExpectExec(consume).WithArgs(42, step).WillReturnResult(sqlmock.NewResult(0, 1))
+	// Zweite Verwendung: totp_last_step ist schon step, die Bedingung trifft keine Zeile
+	mock.ExpectQuery(secretQuery).WithArgs(42).WillReturnRows(sqlmock.NewRows([]string{"secret"}).AddRow(secret))
+	mock.ExpectExec(consume).WithArgs(42, step).WillReturnResult(sqlmock.NewResult(0, 0))
+	// Ein falscher Code verbraucht keinen Schritt
+	mock.ExpectQuery(secretQuery).WithArgs(42).WillReturnRows(sqlmock.NewRows([]string{"secret"}).AddRow(secret))
+
+	ctx := context.Background()
+	if ok, err := s.checkTOTP(ctx, 42, code); !ok || err != nil {
+		t.Fatalf("first use: checkTOTP = %v, %v", ok, err)
+	}
+	if ok, err := s.checkTOTP(ctx, 42, code); ok || err != nil {
+		t.Errorf("replay: checkTOTP = %v, %v", ok, err)
+	}
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	if ok, err := s.checkTOTP(ctx, 42, wrong); ok || err != nil {
+		t.Errorf("wrong code: checkTOTP = %v, %v", ok, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Verlangt eine Rolle TOTP, gelten API-Tokens erst nach der Einrichtung; sonst ließe sich der zweite Faktor umgehen
+func TestTokenRequiresTwoFactorEnrollment(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := &Service{db: db, schema: "cms", opts: Options{
+		Roles:     map[string][]string{"admin": {ScopeRead, ScopeAdmin}},
+		TwoFactor: TwoFactorOptions{RequiredRoles: []string{"admin"}},
+	}}
+	secret := tokenPrefix + "secret"
+	mock.ExpectQuery(tokenQuery).WithArgs(hashSecret(secret)).WillReturnRows(tokenRows(`{"read","admin"}`, `{"admin"}`, false))
+
+	handler := s.Authenticate(s.Authorize(func(*http.Request) string { return ScopeRead }, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	r := httptest.NewRequest(http.MethodGet, "/api/tables", nil)
+	r.Header.Set("Authorization", "Bearer "+secret)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusForbidden || errorCode(t, rec) != "second_factor_required" {
+		t.Errorf("status = %d %s", rec.Code, rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,356 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+	"wuffnetCMS/middleware"
+
+	"rsc.io/qr"
+)
+
+// twoFactorRequest ist der Body aller Endpunkte, die einen Code prüfen
+type twoFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"` // Nur bei VerifyTOTP, anstelle von Code
+}
+
+// EnrollTOTP erzeugt ein neues Geheimnis mit Provisioning-URI und QR-Code; es gilt erst nach ConfirmTOTP
+func (s *Service) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.sessionUser(w, r, pendingEnroll)
+	if !ok {
+		return
+	}
+	if p.totp {
+		middleware.WriteError(w, r, http.StatusConflict, "conflict", "Two-factor authentication is already enabled.")
+		return
+	}
+
+	secret := newTOTPSecret()
+	if err := s.setTOTPSecret(r.Context(), p.UserID, secret); err != nil {
+		internalError(w, r, err)
+		return
+	}
+	uri := totpURI(s.opts.TwoFactor.Issuer, p.Name, secret)
+	code, err := qr.Encode(uri, qr.M)
+	if err != nil {
+		internalError(w, r, fmt.Errorf("failed to encode QR code: %w", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"secret": secret,
+		"uri":    uri,
+		"qrCode": "data:image/png;base64," + base64.StdEncoding.EncodeToString(code.PNG()),
+	})
+}
+
+// ConfirmTOTP schließt die Einrichtung mit einem ersten Code ab und liefert einmalig die Wiederherstellungscodes
+func (s *Service) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	p, request, ok := s.twoFactorAttempt(w, r, pendingEnroll)
+	if !ok {
+		return
+	}
+	if p.totp {
+		middleware.WriteError(w, r, http.StatusConflict, "conflict", "Two-factor authentication is already enabled.")
+		return
+	}
+	secret, err := s.totpSecret(r.Context(), p.UserID)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if secret == "" {
+		middleware.WriteError(w, r, http.StatusConflict, "conflict", "Start the enrolment first.")
+		return
+	}
+	step, valid := totpMatch(secret, request.Code, time.Now())
+	if !valid {
+		s.invalidCode(w, r, p)
+		return
+	}
+
+	codes := newRecoveryCodes()
+	if err := s.enableTOTP(r.Context(), p, step, codes); err != nil {
+		internalError(w, r, err)
+		return
+	}
+	s.lockout.Reset(lockoutKey(p))
+	middleware.Logger(r.Context()).Info("Two-factor authentication enabled")
+	writeJSON(w, http.StatusOK, map[string]interface{}{"recoveryCodes": codes})
+}
+
+// VerifyTOTP prüft bei der Anmeldung den TOTP-Code oder einen Wiederherstellungscode und gibt die Sitzung frei
+func (s *Service) VerifyTOTP(w http.ResponseWriter, r *http.Request) {
+	p, request, ok := s.twoFactorAttempt(w, r, pendingVerify)
+	if !ok {
+		return
+	}
+	if p.pending != pendingVerify {
+		middleware.WriteError(w, r, http.StatusConflict, "conflict", "No second factor is pending.")
+		return
+	}
+
+	var valid bool
+	var err error
+	if request.RecoveryCode != "" {
+		valid, err = s.useRecoveryCode(r.Context(), p.UserID, request.RecoveryCode)
+	} else {
+		valid, err = s.checkTOTP(r.Context(), p.UserID, request.Code)
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if !valid {
+		s.invalidCode(w, r, p)
+		return
+	}
+
+	if err := s.verifySession(r.Context(), p.session); err != nil {
+		internalError(w, r, err)
+		return
+	}
+	s.lockout.Reset(lockoutKey(p))
+	if request.RecoveryCode != "" {
+		middleware.Logger(r.Context()).Warn("Recovery code used for login")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes ersetzt alle Wiederherstellungscodes; verlangt einen aktuellen TOTP-Code
+func (s *Service) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.checkedTOTPUser(w, r)
+	if !ok {
+		return
+	}
+	codes := newRecoveryCodes()
+	if err := s.replaceRecoveryCodes(r.Context(), s.db, p.UserID, codes); err != nil {
+		internalError(w, r, err)
+		return
+	}
+	middleware.Logger(r.Context()).Info("Recovery codes regenerated")
+	writeJSON(w, http.StatusOK, map[string]interface{}{"recoveryCodes": codes})
+}
+
+// DisableTOTP schaltet den zweiten Faktor ab, sofern keine Rolle des Benutzers ihn verlangt
+func (s *Service) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.checkedTOTPUser(w, r)
+	if !ok {
+		return
+	}
+	if s.requiresTwoFactor(p.Roles) {
+		middleware.WriteError(w, r, http.StatusForbidden, "forbidden", "Your role requires two-factor authentication.")
+		return
+	}
+	if err := s.disableTOTP(r.Context(), p.UserID); err != nil {
+		internalError(w, r, err)
+		return
+	}
+	middleware.Logger(r.Context()).Info("Two-factor authentication disabled")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sessionUser verlangt eine Browser-Sitzung, deren zweiter Faktor erledigt ist oder in allowed steht
+func (s *Service) sessionUser(w http.ResponseWriter, r *http.Request, allowed ...string) (*Principal, bool) {
+	if s == nil {
+		notConfigured(w, r)
+		return nil, false
+	}
+	p := FromContext(r.Context())
+	if p == nil {
+		unauthorized(w, r, "Bearer", "Authentication required.")
+		return nil, false
+	}
+	if p.session == "" {
+		middleware.WriteError(w, r, http.StatusForbidden, "forbidden", "Only available from a browser session.")
+		return nil, false
+	}
+	if p.pending != "" && !slices.Contains(allowed, p.pending) {
+		secondFactorRequired(w, r)
+		return nil, false
+	}
+	return p, true
+}
+
+// twoFactorAttempt liest den Code aus der Anfrage, sofern der Benutzer nicht wegen Fehlversuchen gesperrt ist
+func (s *Service) twoFactorAttempt(w http.ResponseWriter, r *http.Request, allowed ...string) (*Principal, twoFactorRequest, bool) {
+	var request twoFactorRequest
+	p, ok := s.sessionUser(w, r, allowed...)
+	if !ok {
+		return nil, request, false
+	}
+	if remaining := s.lockout.Locked(lockoutKey(p)); remaining > 0 {
+		s.lockout.Reject(w, r, remaining)
+		return nil, request, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		middleware.WriteError(w, r, http.StatusBadRequest, "bad_request", "Invalid input")
+		return nil, request, false
+	}
+	return p, request, true
+}
+
+// checkedTOTPUser verlangt eine freigegebene Sitzung mit eingerichtetem TOTP und einen gültigen Code
+func (s *Service) checkedTOTPUser(w http.ResponseWriter, r *http.Request) (*Principal, bool) {
+	p, request, ok := s.twoFactorAttempt(w, r)
+	if !ok {
+		return nil, false
+	}
+	if !p.totp {
+		middleware.WriteError(w, r, http.StatusConflict, "conflict", "Two-factor authentication is not enabled.")
+		return nil, false
+	}
+	valid, err := s.checkTOTP(r.Context(), p.UserID, request.Code)
+	if err != nil {
+		internalError(w, r, err)
+		return nil, false
+	}
+	if !valid {
+		s.invalidCode(w, r, p)
+		return nil, false
+	}
+	s.lockout.Reset(lockoutKey(p))
+	return p, true
+}
+
+// invalidCode zählt den Fehlversuch; nach zu vielen wird der Benutzer vorübergehend gesperrt
+func (s *Service) invalidCode(w http.ResponseWriter, r *http.Request, p *Principal) {
+	middleware.Logger(r.Context()).Warn("Invalid second factor")
+	if locked := s.lockout.Fail(lockoutKey(p)); locked > 0 {
+		s.lockout.Reject(w, r, locked)
+		return
+	}
+	middleware.WriteError(w, r, http.StatusBadRequest, "invalid_code", "The code is invalid or was already used.")
+}
+
+func lockoutKey(p *Principal) string {
+	return "totp:" + strconv.FormatInt(p.UserID, 10)
+}
+
+func secondFactorRequired(w http.ResponseWriter, r *http.Request) {
+	middleware.WriteError(w, r, http.StatusForbidden, "second_factor_required", "Complete the two-factor login at /auth/2fa first.")
+}
+
+// execer erlaubt Schreibzugriffe über *sql.DB oder innerhalb einer *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// setTOTPSecret merkt sich ein noch unbestätigtes Geheimnis; ein aktives wird nicht überschrieben
+func (s *Service) setTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	query := fmt.Sprintf("UPDATE %s SET totp_secret = $2, totp_last_step = NULL WHERE id = $1 AND totp_enabled_at IS NULL", s.table("users"))
+	if _, err := s.db.ExecContext(ctx, query, userID, secret); err != nil {
+		return fmt.Errorf("failed to save TOTP secret: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) totpSecret(ctx context.Context, userID int64) (string, error) {
+	var secret string
+	query := fmt.Sprintf("SELECT COALESCE(totp_secret, '') FROM %s WHERE id = $1", s.table("users"))
+	if err := s.db.QueryRowContext(ctx, query, userID).Scan(&secret); err != nil {
+		return "", fmt.Errorf("failed to read TOTP secret: %w", err)
+	}
+	return secret, nil
+}
+
+// checkTOTP prüft einen Code und verbraucht seinen Zeitschritt, damit er nicht erneut gilt
+func (s *Service) checkTOTP(ctx context.Context, userID int64, code string) (bool, error) {
+	secret, err := s.totpSecret(ctx, userID)
+	if err != nil || secret == "" {
+		return false, err
+	}
+	step, ok := totpMatch(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	query := fmt.Sprintf(`
+		UPDATE %s SET totp_last_step = $2
+		WHERE id = $1 AND totp_enabled_at IS NOT NULL AND (totp_last_step IS NULL OR totp_last_step < $2)`, s.table("users"))
+	result, err := s.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP step: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// enableTOTP aktiviert das bestätigte Geheimnis, legt die Wiederherstellungscodes an und gibt die Sitzung frei
+func (s *Service) enableTOTP(ctx context.Context, p *Principal, step int64, codes []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("UPDATE %s SET totp_enabled_at = now(), totp_last_step = $2 WHERE id = $1", s.table("users"))
+	if _, err := tx.ExecContext(ctx, query, p.UserID, step); err != nil {
+		return fmt.Errorf("failed to enable TOTP: %w", err)
+	}
+	if err := s.replaceRecoveryCodes(ctx, tx, p.UserID, codes); err != nil {
+		return err
+	}
+	if err := s.verifySession(ctx, p.session, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Service) replaceRecoveryCodes(ctx context.Context, db execer, userID int64, codes []string) error {
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE user_id = $1", s.table("recovery_codes")), userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (user_id, code_hash) VALUES ($1, $2)", s.table("recovery_codes"))
+	for _, code := range codes {
+		if _, err := db.ExecContext(ctx, query, userID, hashSecret(normalizeRecoveryCode(code))); err != nil {
+			return fmt.Errorf("failed to save recovery code: %w", err)
+		}
+	}
+	return nil
+}
+
+// useRecoveryCode verbraucht einen noch unbenutzten Wiederherstellungscode
+func (s *Service) useRecoveryCode(ctx context.Context, userID int64, code string) (bool, error) {
+	query := fmt.Sprintf("UPDATE %s SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL", s.table("recovery_codes"))
+	result, err := s.db.ExecContext(ctx, query, userID, hashSecret(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// verifySession gibt eine Sitzung nach geprüftem zweiten Faktor frei, optional innerhalb einer Transaktion
+func (s *Service) verifySession(ctx context.Context, hash string, tx ...execer) error {
+	var db execer = s.db
+	if len(tx) > 0 {
+		db = tx[0]
+	}
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET verified = true WHERE token_hash = $1", s.table("sessions")), hash); err != nil {
+		return fmt.Errorf("failed to verify session: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) disableTOTP(ctx context.Context, userID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("UPDATE %s SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL WHERE id = $1", s.table("users"))
+	if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to disable TOTP: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE user_id = $1", s.table("recovery_codes")), userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,101 @@
+// fetch-vendor lädt die in web/vendor.json aufgeführten Fremdbibliotheken nach web/static/vendor,
+// damit die Oberfläche ohne CDN auskommt. Aufruf über "go generate ./web".
+//
+// Ist für eine Datei bereits ein SHA-256 eingetragen, muss der Download übereinstimmen;
+// fehlende Prüfsummen werden beim ersten Download in das Manifest geschrieben.
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type vendorFile struct {
+	Path   string `json:"path"`
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+func main() {
+	manifestPath := flag.String("manifest", "vendor.json", "vendor manifest")
+	dir := flag.String("dir", "static/vendor", "target directory")
+	flag.Parse()
+
+	manifest, err := os.ReadFile(*manifestPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var files []vendorFile
+	if err := json.Unmarshal(manifest, &files); err != nil {
+		log.Fatalf("invalid %s: %v", *manifestPath, err)
+	}
+
+	client := &http.Client{Timeout: time.Minute}
+	changed := false
+	for i, file := range files {
+		content, err := download(client, file.URL)
+		if err != nil {
+			log.Fatalf("%s: %v", file.Path, err)
+		}
+
+		sum := sha256.Sum256(content)
+		hash := hex.EncodeToString(sum[:])
+		switch file.SHA256 {
+		case hash:
+		case "":
+			files[i].SHA256 = hash
+			changed = true
+		default:
+			log.Fatalf("%s: checksum mismatch, expected %s, got %s", file.Path, file.SHA256, hash)
+		}
+
+		target := filepath.Join(*dir, filepath.FromSlash(file.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(target, content, 0o644); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s  %s\n", hash, file.Path)
+	}
+
+	if changed {
+		var out bytes.Buffer
+		out.WriteString("[\n")
+		for i, file := range files {
+			line, _ := json.Marshal(file)
+			out.WriteString("  ")
+			out.Write(line)
+			if i < len(files)-1 {
+				out.WriteString(",")
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString("]\n")
+		if err := os.WriteFile(*manifestPath, out.Bytes(), 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func download(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
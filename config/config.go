@@ -1,26 +1,98 @@
 package config
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"os"
+	"log/slog"
+	"strings"
+	"time"
+	"wuffnetCMS/tracing"
 
-	_ "github.com/lib/pq"
+	"github.com/XSAM/otelsql"
+	"github.com/lib/pq"
 )
 
-func ConnectDB() (*sql.DB, error) {
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
+// ConnectDB öffnet den Verbindungspool und wartet, bis die Datenbank erreichbar ist.
+// Fehlgeschlagene Pings werden mit wachsendem Abstand wiederholt, bis StartupTimeout abgelaufen oder ctx beendet ist.
+func ConnectDB(ctx context.Context, cfg Database) (*sql.DB, error) {
+	// Der instrumentierte Treiber erzeugt für jedes Statement einen Span (ohne Parameterwerte)
+	db, err := otelsql.Open("postgres", cfg.DSN(), tracing.SQLOptions()...)
+	if err != nil {
+		return nil, err
+	}
 
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=require",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 
-	db, err := sql.Open("postgres", connStr)
-	if err != nil {
+	if err := waitForDB(ctx, db, cfg.StartupTimeout); err != nil {
+		db.Close()
 		return nil, err
 	}
 	return db, nil
 }
+
+// Wartezeiten zwischen den Verbindungsversuchen beim Start
+const (
+	initialBackoff = 500 * time.Millisecond
+	maxBackoff     = 5 * time.Second
+)
+
+func waitForDB(ctx context.Context, db *sql.DB, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := initialBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		// Falsche Zugangsdaten oder eine fehlende Datenbank werden durch Warten nicht besser
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && (pqErr.Code.Class() == "28" || pqErr.Code.Name() == "invalid_catalog_name") {
+			return fmt.Errorf("database rejected connection: %w", err)
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("database not reachable after %d attempts: %w", attempt, err)
+		}
+
+		slog.Warn("Database not reachable, retrying", "attempt", attempt, "retry_in", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// DSN baut den Connection-String im key=value-Format von lib/pq
+func (cfg Database) DSN() string {
+	params := []string{
+		"host=" + quoteDSN(cfg.Host),
+		fmt.Sprintf("port=%d", cfg.Port),
+		"user=" + quoteDSN(cfg.User),
+		"password=" + quoteDSN(cfg.Password),
+		"dbname=" + quoteDSN(cfg.Name),
+		"sslmode=" + quoteDSN(cfg.SSLMode),
+	}
+	if cfg.SSLRootCert != "" {
+		params = append(params, "sslrootcert="+quoteDSN(cfg.SSLRootCert))
+	}
+	if cfg.ConnectTimeout > 0 {
+		// lib/pq erwartet ganze Sekunden
+		seconds := int((cfg.ConnectTimeout + time.Second - 1) / time.Second)
+		params = append(params, fmt.Sprintf("connect_timeout=%d", seconds))
+	}
+	return strings.Join(params, " ")
+}
+
+// quoteDSN setzt Werte in einfache Anführungszeichen, damit Leerzeichen und Sonderzeichen erhalten bleiben
+func quoteDSN(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
@@ -0,0 +1,18 @@
+package config
+
+import (
+	"io"
+	"log/slog"
+)
+
+// NewLogger erzeugt einen Logger mit Level und Format aus der Konfiguration
+func NewLogger(cfg Log, w io.Writer) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(cfg.Level)) // Bereits durch Validate geprüft
+
+	options := &slog.HandlerOptions{Level: level}
+	if cfg.Format == "json" {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
@@ -0,0 +1,797 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"wuffnetCMS/auth"
+	"wuffnetCMS/events"
+	"wuffnetCMS/middleware"
+	"wuffnetCMS/scheduler"
+	"wuffnetCMS/tracing"
+	"wuffnetCMS/webhooks"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config enthält alle Einstellungen des Servers.
+// Rangfolge: Standardwerte < Konfigurationsdatei < Umgebungsvariablen < Kommandozeilen-Flags
+type Config struct {
+	Server    Server                      `yaml:"server"`
+	Database  Database                    `yaml:"database"`
+	CMS       CMS                         `yaml:"cms"`
+	Log       Log                         `yaml:"log"`
+	Tracing   tracing.Options             `yaml:"tracing"`
+	CORS      middleware.CORSOptions      `yaml:"cors"`
+	RateLimit middleware.RateLimitOptions `yaml:"rate_limit"`
+	Auth      auth.Options                `yaml:"auth"`
+	Scheduler scheduler.Options           `yaml:"scheduler"`
+	Events    events.Options              `yaml:"events"`
+	Webhooks  webhooks.Options            `yaml:"webhooks"`
+}
+
+type Server struct {
+	Addr              string        `yaml:"addr"`
+	TLSCert           string        `yaml:"tls_cert"` // Zertifikat und Schlüssel aktivieren HTTPS
+	TLSKey            string        `yaml:"tls_key"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"` // Wartezeit auf laufende Anfragen beim Beenden
+	AssetsDir         string        `yaml:"assets_dir"`       // Oberfläche von der Festplatte statt aus dem Binary (Entwicklung)
+}
+
+type Database struct {
+	Host            string        `yaml:"host"`
+	Port            int           `yaml:"port"`
+	User            string        `yaml:"user"`
+	Password        string        `yaml:"password"`
+	Name            string        `yaml:"name"`
+	SSLMode         string        `yaml:"sslmode"`
+	SSLRootCert     string        `yaml:"sslrootcert"`
+	ConnectTimeout  time.Duration `yaml:"connect_timeout"`
+	MaxOpenConns    int           `yaml:"max_open_conns"` // 0 = unbegrenzt
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`  // 0 = unbegrenzt
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"` // 0 = unbegrenzt
+	StartupTimeout  time.Duration `yaml:"startup_timeout"`    // So lange wird beim Start auf die Datenbank gewartet
+
+	// Statement-Timeout je Endpunkt-Gruppe (content, fields, save, delete, graphql), sonst StatementTimeout; 0 = kein Limit
+	StatementTimeout  time.Duration            `yaml:"statement_timeout"`
+	StatementTimeouts map[string]time.Duration `yaml:"statement_timeouts"`
+	MaxQueryCost      float64                  `yaml:"max_query_cost"` // Obergrenze der EXPLAIN-Kosten für Tabelleninhalte; 0 = aus
+}
+
+// Endpunkt-Gruppen, die in statement_timeouts erlaubt sind
+var statementEndpoints = []string{"content", "fields", "save", "delete", "graphql"}
+
+// Routen-Gruppen, die in rate_limit.groups erlaubt sind (Zuordnung in routes.SetupRoutes)
+var rateLimitGroups = []string{"api", "write", "login"}
+
+type CMS struct {
+	MetadataSchema string        `yaml:"metadata_schema"`
+	ExposedSchemas []string      `yaml:"exposed_schemas"` // Leer bedeutet alle Schemas
+	HiddenSchemas  []string      `yaml:"hidden_schemas"`
+	CatalogTTL     time.Duration `yaml:"catalog_ttl"`   // So lange gilt der zwischengespeicherte Tabellenkatalog
+	EditLockTTL    time.Duration `yaml:"edit_lock_ttl"` // So lange gilt eine Bearbeitungssperre ohne Heartbeat
+}
+
+type Log struct {
+	Level  string `yaml:"level"`  // debug, info, warn, error
+	Format string `yaml:"format"` // text oder json
+}
+
+// Default liefert die Standardwerte, die dem bisherigen Verhalten entsprechen
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:              ":8080",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: Database{
+			Host:           "localhost",
+			Port:           5432,
+			SSLMode:        "require",
+			ConnectTimeout: 10 * time.Second,
+			MaxOpenConns:   20,
+			MaxIdleConns:   5,
+			StartupTimeout: 30 * time.Second,
+
+			StatementTimeout: 30 * time.Second,
+		},
+		CMS: CMS{MetadataSchema: "cms", CatalogTTL: time.Minute, EditLockTTL: 2 * time.Minute},
+		Log: Log{Level: "info", Format: "text"},
+		Tracing: tracing.Options{
+			Exporter:    "none",
+			SampleRatio: 1,
+			ServiceName: "wuffnetCMS",
+		},
+		CORS: middleware.CORSOptions{
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "X-Request-ID"},
+			MaxAge:         10 * time.Minute,
+		},
+		RateLimit: middleware.RateLimitOptions{
+			Groups: map[string]middleware.GroupLimit{
+				"api":   {PerIP: middleware.Limit{Rate: 20, Burst: 40}, PerUser: middleware.Limit{Rate: 10, Burst: 20}},
+				"write": {PerIP: middleware.Limit{Rate: 5, Burst: 10}, PerUser: middleware.Limit{Rate: 2, Burst: 10}},
+				"login": {PerIP: middleware.Limit{Rate: 0.1, Burst: 5}},
+			},
+			Lockout: middleware.LockoutOptions{MaxFailures: 5, Window: 15 * time.Minute, Duration: 15 * time.Minute},
+		},
+		Auth: auth.Options{
+			OIDC: auth.OIDCOptions{
+				Scopes:      []string{"openid", "profile", "email"},
+				GroupsClaim: "groups",
+			},
+			Roles: map[string][]string{
+				"viewer":   {auth.ScopeRead},
+				"editor":   {auth.ScopeRead, auth.ScopeWrite},
+				"reviewer": {auth.ScopeRead, auth.ScopePublish},
+				"admin":    {auth.ScopeRead, auth.ScopeWrite, auth.ScopeDelete, auth.ScopePublish, auth.ScopeAdmin},
+			},
+			TwoFactor: auth.TwoFactorOptions{
+				RequiredRoles: []string{"admin"},
+				Issuer:        "wuffnetCMS",
+			},
+			SessionTTL:  8 * time.Hour,
+			TokenTTL:    30 * 24 * time.Hour,
+			TokenMaxTTL: 365 * 24 * time.Hour,
+		},
+		Scheduler: scheduler.Options{Interval: 30 * time.Second},
+		Events:    events.Options{Enabled: true, KeepAlive: 25 * time.Second},
+		Webhooks: webhooks.Options{
+			Timeout:     10 * time.Second,
+			MaxAttempts: 10,
+			Backoff:     30 * time.Second,
+			MaxBackoff:  time.Hour,
+			Retention:   30 * 24 * time.Hour,
+		},
+	}
+}
+
+// Load liest die Konfiguration aus Datei, Umgebung und Flags (args ohne Programmnamen).
+// Die Datei wird über -config bzw. CMS_CONFIG angegeben, sonst wird config.yaml bzw. config.toml verwendet, falls vorhanden.
+// Das Format richtet sich nach der Endung: .toml ist TOML, alles andere YAML.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	var path string
+
+	fs := flag.NewFlagSet("wuffnetCMS", flag.ContinueOnError)
+	fs.StringVar(&path, "config", "", "path to the configuration file (YAML, or TOML with .toml extension)")
+	cfg.bindFlags(fs)
+
+	// Erster Durchlauf nur für -config; die Flags werden nach Datei und Umgebung erneut angewendet
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	explicit := path != ""
+	if !explicit {
+		path = os.Getenv("CMS_CONFIG")
+		explicit = path != ""
+	}
+	if !explicit {
+		path = "config.yaml"
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			path = "config.toml"
+		}
+	}
+
+	cfg = Default()
+	if err := cfg.loadFile(path, explicit); err != nil {
+		return nil, err
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (c *Config) loadFile(path string, required bool) error {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		if content, err = tomlToYAML(content); err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+
+	decoder := yaml.NewDecoder(strings.NewReader(string(content)))
+	decoder.KnownFields(true) // Tippfehler in Schlüsseln nicht stillschweigend ignorieren
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// tomlToYAML wandelt eine TOML-Datei in YAML um, damit für beide Formate dieselben
+// yaml-Tags, Dauern wie "30s" und die Prüfung auf unbekannte Schlüssel gelten
+func tomlToYAML(content []byte) ([]byte, error) {
+	var values map[string]interface{}
+	if _, err := toml.Decode(string(content), &values); err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return yaml.Marshal(values)
+}
+
+// loadEnv übernimmt gesetzte Umgebungsvariablen; die DB_*-Namen entsprechen der bisherigen .env
+func (c *Config) loadEnv() error {
+	var errs []error
+	envString := func(target *string, name string) {
+		if value, ok := os.LookupEnv(name); ok {
+			*target = value
+		}
+	}
+	envInt := func(target *int, name string) {
+		if value, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid number %q", name, value))
+				return
+			}
+			*target = n
+		}
+	}
+	envDuration := func(target *time.Duration, name string) {
+		if value, ok := os.LookupEnv(name); ok {
+			d, err := parseDuration(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid duration %q", name, value))
+				return
+			}
+			*target = d
+		}
+	}
+	envBool := func(target *bool, name string) {
+		if value, ok := os.LookupEnv(name); ok {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid boolean %q", name, value))
+				return
+			}
+			*target = b
+		}
+	}
+	envFloat := func(target *float64, name string) {
+		if value, ok := os.LookupEnv(name); ok {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid number %q", name, value))
+				return
+			}
+			*target = f
+		}
+	}
+	envList := func(target *[]string, name string) {
+		if value, ok := os.LookupEnv(name); ok {
+			*target = splitList(value)
+		}
+	}
+
+	envString(&c.Server.Addr, "CMS_LISTEN_ADDR")
+	envString(&c.Server.TLSCert, "CMS_TLS_CERT")
+	envString(&c.Server.TLSKey, "CMS_TLS_KEY")
+	envDuration(&c.Server.ReadHeaderTimeout, "CMS_READ_HEADER_TIMEOUT")
+	envDuration(&c.Server.ReadTimeout, "CMS_READ_TIMEOUT")
+	envDuration(&c.Server.WriteTimeout, "CMS_WRITE_TIMEOUT")
+	envDuration(&c.Server.IdleTimeout, "CMS_IDLE_TIMEOUT")
+	envDuration(&c.Server.ShutdownTimeout, "CMS_SHUTDOWN_TIMEOUT")
+	envString(&c.Server.AssetsDir, "CMS_ASSETS_DIR")
+
+	envString(&c.Database.Host, "DB_HOST")
+	envInt(&c.Database.Port, "DB_PORT")
+	envString(&c.Database.User, "DB_USER")
+	envString(&c.Database.Password, "DB_PASSWORD")
+	envString(&c.Database.Name, "DB_NAME")
+	envString(&c.Database.SSLMode, "DB_SSLMODE")
+	envString(&c.Database.SSLRootCert, "DB_SSLROOTCERT")
+	envDuration(&c.Database.ConnectTimeout, "DB_CONNECT_TIMEOUT")
+	envInt(&c.Database.MaxOpenConns, "DB_MAX_OPEN_CONNS")
+	envInt(&c.Database.MaxIdleConns, "DB_MAX_IDLE_CONNS")
+	envDuration(&c.Database.ConnMaxLifetime, "DB_CONN_MAX_LIFETIME")
+	envDuration(&c.Database.ConnMaxIdleTime, "DB_CONN_MAX_IDLE_TIME")
+	envDuration(&c.Database.StartupTimeout, "DB_STARTUP_TIMEOUT")
+	envDuration(&c.Database.StatementTimeout, "DB_STATEMENT_TIMEOUT")
+	if value, ok := os.LookupEnv("DB_STATEMENT_TIMEOUTS"); ok {
+		timeouts, err := parseTimeouts(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("DB_STATEMENT_TIMEOUTS: %w", err))
+		}
+		c.Database.StatementTimeouts = timeouts
+	}
+	envFloat(&c.Database.MaxQueryCost, "DB_MAX_QUERY_COST")
+
+	envString(&c.CMS.MetadataSchema, "CMS_METADATA_SCHEMA")
+	envList(&c.CMS.ExposedSchemas, "CMS_EXPOSED_SCHEMAS")
+	envList(&c.CMS.HiddenSchemas, "CMS_HIDDEN_SCHEMAS")
+	envDuration(&c.CMS.CatalogTTL, "CMS_CATALOG_TTL")
+	envDuration(&c.CMS.EditLockTTL, "CMS_EDIT_LOCK_TTL")
+
+	envString(&c.Log.Level, "LOG_LEVEL")
+	envString(&c.Log.Format, "LOG_FORMAT")
+
+	envString(&c.Tracing.Exporter, "CMS_TRACING_EXPORTER")
+	envString(&c.Tracing.Endpoint, "CMS_TRACING_ENDPOINT")
+	envBool(&c.Tracing.Insecure, "CMS_TRACING_INSECURE")
+	envFloat(&c.Tracing.SampleRatio, "CMS_TRACING_SAMPLE_RATIO")
+	envString(&c.Tracing.ServiceName, "OTEL_SERVICE_NAME")
+
+	envList(&c.CORS.AllowedOrigins, "CMS_CORS_ORIGINS")
+	envList(&c.CORS.AllowedMethods, "CMS_CORS_METHODS")
+	envList(&c.CORS.AllowedHeaders, "CMS_CORS_HEADERS")
+	envDuration(&c.CORS.MaxAge, "CMS_CORS_MAX_AGE")
+
+	if value, ok := os.LookupEnv("CMS_RATE_LIMITS"); ok {
+		if err := parseRateLimits(value, &c.RateLimit); err != nil {
+			errs = append(errs, fmt.Errorf("CMS_RATE_LIMITS: %w", err))
+		}
+	}
+	envList(&c.RateLimit.TrustedProxies, "CMS_TRUSTED_PROXIES")
+	envInt(&c.RateLimit.Lockout.MaxFailures, "CMS_LOCKOUT_MAX_FAILURES")
+	envDuration(&c.RateLimit.Lockout.Window, "CMS_LOCKOUT_WINDOW")
+	envDuration(&c.RateLimit.Lockout.Duration, "CMS_LOCKOUT_DURATION")
+
+	envString(&c.Auth.OIDC.Issuer, "CMS_OIDC_ISSUER")
+	envString(&c.Auth.OIDC.ClientID, "CMS_OIDC_CLIENT_ID")
+	envString(&c.Auth.OIDC.ClientSecret, "CMS_OIDC_CLIENT_SECRET")
+	envString(&c.Auth.OIDC.RedirectURL, "CMS_OIDC_REDIRECT_URL")
+	envList(&c.Auth.OIDC.Scopes, "CMS_OIDC_SCOPES")
+	envString(&c.Auth.OIDC.GroupsClaim, "CMS_OIDC_GROUPS_CLAIM")
+	if value, ok := os.LookupEnv("CMS_OIDC_GROUP_ROLES"); ok {
+		roles, err := parseGroupRoles(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("CMS_OIDC_GROUP_ROLES: %w", err))
+		}
+		c.Auth.OIDC.GroupRoles = roles
+	}
+	envString(&c.Auth.OIDC.DefaultRole, "CMS_OIDC_DEFAULT_ROLE")
+	if value, ok := os.LookupEnv("CMS_AUTH_ROLES"); ok {
+		roles, err := parseRoles(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("CMS_AUTH_ROLES: %w", err))
+		}
+		c.Auth.Roles = roles
+	}
+	envList(&c.Auth.TwoFactor.RequiredRoles, "CMS_2FA_REQUIRED_ROLES")
+	envString(&c.Auth.TwoFactor.Issuer, "CMS_2FA_ISSUER")
+	envDuration(&c.Auth.SessionTTL, "CMS_SESSION_TTL")
+	envDuration(&c.Auth.TokenTTL, "CMS_TOKEN_TTL")
+	envDuration(&c.Auth.TokenMaxTTL, "CMS_TOKEN_MAX_TTL")
+
+	envDuration(&c.Scheduler.Interval, "CMS_SCHEDULER_INTERVAL")
+
+	envBool(&c.Events.Enabled, "CMS_EVENTS_ENABLED")
+	envDuration(&c.Events.KeepAlive, "CMS_EVENTS_KEEP_ALIVE")
+
+	// Die Webhooks selbst gibt es wegen ihrer Secrets nur in der Konfigurationsdatei
+	envDuration(&c.Webhooks.Timeout, "CMS_WEBHOOK_TIMEOUT")
+	envInt(&c.Webhooks.MaxAttempts, "CMS_WEBHOOK_MAX_ATTEMPTS")
+	envDuration(&c.Webhooks.Backoff, "CMS_WEBHOOK_BACKOFF")
+	envDuration(&c.Webhooks.MaxBackoff, "CMS_WEBHOOK_MAX_BACKOFF")
+	envDuration(&c.Webhooks.Retention, "CMS_WEBHOOK_RETENTION")
+
+	return errors.Join(errs...)
+}
+
+// bindFlags verknüpft die Flags direkt mit den Feldern; nicht gesetzte Flags ändern nichts
+func (c *Config) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Server.Addr, "listen", c.Server.Addr, "listen address, e.g. :8080")
+	fs.StringVar(&c.Server.TLSCert, "tls-cert", c.Server.TLSCert, "TLS certificate file")
+	fs.StringVar(&c.Server.TLSKey, "tls-key", c.Server.TLSKey, "TLS private key file")
+	fs.DurationVar(&c.Server.ReadHeaderTimeout, "read-header-timeout", c.Server.ReadHeaderTimeout, "time to read request headers")
+	fs.DurationVar(&c.Server.ReadTimeout, "read-timeout", c.Server.ReadTimeout, "time to read the whole request")
+	fs.DurationVar(&c.Server.WriteTimeout, "write-timeout", c.Server.WriteTimeout, "time to write the response")
+	fs.DurationVar(&c.Server.IdleTimeout, "idle-timeout", c.Server.IdleTimeout, "keep-alive idle timeout")
+	fs.DurationVar(&c.Server.ShutdownTimeout, "shutdown-timeout", c.Server.ShutdownTimeout, "time to drain in-flight requests on shutdown")
+	fs.StringVar(&c.Server.AssetsDir, "assets-dir", c.Server.AssetsDir, "serve the web UI from this directory instead of the binary, e.g. web")
+
+	fs.StringVar(&c.Database.Host, "db-host", c.Database.Host, "database host")
+	fs.IntVar(&c.Database.Port, "db-port", c.Database.Port, "database port")
+	fs.StringVar(&c.Database.User, "db-user", c.Database.User, "database user")
+	fs.StringVar(&c.Database.Name, "db-name", c.Database.Name, "database name")
+	fs.StringVar(&c.Database.SSLMode, "db-sslmode", c.Database.SSLMode, "disable, require, verify-ca or verify-full")
+	fs.StringVar(&c.Database.SSLRootCert, "db-sslrootcert", c.Database.SSLRootCert, "CA certificate for verify-ca/verify-full")
+	fs.DurationVar(&c.Database.ConnectTimeout, "db-connect-timeout", c.Database.ConnectTimeout, "database connect timeout")
+	fs.IntVar(&c.Database.MaxOpenConns, "db-max-open-conns", c.Database.MaxOpenConns, "maximum open connections (0 = unlimited)")
+	fs.IntVar(&c.Database.MaxIdleConns, "db-max-idle-conns", c.Database.MaxIdleConns, "maximum idle connections")
+	fs.DurationVar(&c.Database.ConnMaxLifetime, "db-conn-max-lifetime", c.Database.ConnMaxLifetime, "maximum connection lifetime (0 = unlimited)")
+	fs.DurationVar(&c.Database.ConnMaxIdleTime, "db-conn-max-idle-time", c.Database.ConnMaxIdleTime, "maximum idle time per connection (0 = unlimited)")
+	fs.DurationVar(&c.Database.StartupTimeout, "db-startup-timeout", c.Database.StartupTimeout, "how long to retry the database at startup")
+	fs.DurationVar(&c.Database.StatementTimeout, "db-statement-timeout", c.Database.StatementTimeout, "default statement timeout (0 = unlimited)")
+	fs.Func("db-statement-timeouts", "per endpoint group timeouts, e.g. content=5s,save=10s", func(value string) error {
+		timeouts, err := parseTimeouts(value)
+		c.Database.StatementTimeouts = timeouts
+		return err
+	})
+	fs.Float64Var(&c.Database.MaxQueryCost, "db-max-query-cost", c.Database.MaxQueryCost, "reject table content queries above this EXPLAIN cost (0 = off)")
+
+	fs.StringVar(&c.CMS.MetadataSchema, "metadata-schema", c.CMS.MetadataSchema, "schema for CMS tables")
+	fs.Func("exposed-schemas", "comma-separated schemas shown in the CMS (default all)", func(value string) error {
+		c.CMS.ExposedSchemas = splitList(value)
+		return nil
+	})
+	fs.Func("hidden-schemas", "comma-separated schemas hidden from the CMS", func(value string) error {
+		c.CMS.HiddenSchemas = splitList(value)
+		return nil
+	})
+	fs.DurationVar(&c.CMS.CatalogTTL, "catalog-ttl", c.CMS.CatalogTTL, "how long the table catalog is cached")
+	fs.DurationVar(&c.CMS.EditLockTTL, "edit-lock-ttl", c.CMS.EditLockTTL, "how long an edit lock lasts without a heartbeat")
+
+	fs.StringVar(&c.Log.Level, "log-level", c.Log.Level, "debug, info, warn or error")
+	fs.StringVar(&c.Log.Format, "log-format", c.Log.Format, "text or json")
+
+	fs.StringVar(&c.Tracing.Exporter, "tracing-exporter", c.Tracing.Exporter, "none, otlp or stdout")
+	fs.StringVar(&c.Tracing.Endpoint, "tracing-endpoint", c.Tracing.Endpoint, "OTLP/HTTP collector host:port")
+	fs.BoolVar(&c.Tracing.Insecure, "tracing-insecure", c.Tracing.Insecure, "send OTLP without TLS")
+	fs.Float64Var(&c.Tracing.SampleRatio, "tracing-sample-ratio", c.Tracing.SampleRatio, "share of traces to record (0..1)")
+
+	fs.Func("cors-origins", "comma-separated origins allowed to call the public API, or * (default none)", func(value string) error {
+		c.CORS.AllowedOrigins = splitList(value)
+		return nil
+	})
+	fs.Func("cors-methods", "comma-separated methods allowed for cross-origin requests", func(value string) error {
+		c.CORS.AllowedMethods = splitList(value)
+		return nil
+	})
+	fs.Func("cors-headers", "comma-separated request headers allowed for cross-origin requests", func(value string) error {
+		c.CORS.AllowedHeaders = splitList(value)
+		return nil
+	})
+	fs.DurationVar(&c.CORS.MaxAge, "cors-max-age", c.CORS.MaxAge, "how long browsers may cache preflight responses")
+
+	fs.Func("rate-limits", "per group limits as group.scope=rate/burst, e.g. api.per_ip=20/40,write.per_user=2/10", func(value string) error {
+		return parseRateLimits(value, &c.RateLimit)
+	})
+	fs.Func("trusted-proxies", "comma-separated proxy CIDRs whose X-Forwarded-For is trusted", func(value string) error {
+		c.RateLimit.TrustedProxies = splitList(value)
+		return nil
+	})
+	fs.IntVar(&c.RateLimit.Lockout.MaxFailures, "lockout-max-failures", c.RateLimit.Lockout.MaxFailures, "failed logins before a temporary lockout (0 = off)")
+	fs.DurationVar(&c.RateLimit.Lockout.Window, "lockout-window", c.RateLimit.Lockout.Window, "period in which failed logins are counted")
+	fs.DurationVar(&c.RateLimit.Lockout.Duration, "lockout-duration", c.RateLimit.Lockout.Duration, "how long a lockout lasts")
+
+	// Das Client-Secret gibt es wie das Datenbank-Passwort nur über Datei oder Umgebung
+	fs.StringVar(&c.Auth.OIDC.Issuer, "oidc-issuer", c.Auth.OIDC.Issuer, "OIDC issuer URL (empty = no login, API open)")
+	fs.StringVar(&c.Auth.OIDC.ClientID, "oidc-client-id", c.Auth.OIDC.ClientID, "OIDC client ID")
+	fs.StringVar(&c.Auth.OIDC.RedirectURL, "oidc-redirect-url", c.Auth.OIDC.RedirectURL, "public URL of /auth/callback")
+	fs.Func("oidc-scopes", "comma-separated scopes requested from the identity provider", func(value string) error {
+		c.Auth.OIDC.Scopes = splitList(value)
+		return nil
+	})
+	fs.StringVar(&c.Auth.OIDC.GroupsClaim, "oidc-groups-claim", c.Auth.OIDC.GroupsClaim, "ID token claim with the user's groups")
+	fs.Func("oidc-group-roles", "group to role mapping as group=role, e.g. cms-editors=editor,cms-admins=admin", func(value string) error {
+		roles, err := parseGroupRoles(value)
+		c.Auth.OIDC.GroupRoles = roles
+		return err
+	})
+	fs.StringVar(&c.Auth.OIDC.DefaultRole, "oidc-default-role", c.Auth.OIDC.DefaultRole, "role for users without a mapped group (empty = deny)")
+	fs.Func("auth-roles", "role to scope mapping as role=scope+scope, e.g. viewer=read,editor=read+write", func(value string) error {
+		roles, err := parseRoles(value)
+		c.Auth.Roles = roles
+		return err
+	})
+	fs.Func("2fa-required-roles", "comma-separated roles that must use TOTP as a second factor", func(value string) error {
+		c.Auth.TwoFactor.RequiredRoles = splitList(value)
+		return nil
+	})
+	fs.StringVar(&c.Auth.TwoFactor.Issuer, "2fa-issuer", c.Auth.TwoFactor.Issuer, "name shown in authenticator apps")
+	fs.DurationVar(&c.Auth.SessionTTL, "session-ttl", c.Auth.SessionTTL, "lifetime of browser sessions")
+	fs.DurationVar(&c.Auth.TokenTTL, "token-ttl", c.Auth.TokenTTL, "default lifetime of new API tokens")
+	fs.DurationVar(&c.Auth.TokenMaxTTL, "token-max-ttl", c.Auth.TokenMaxTTL, "maximum lifetime of API tokens")
+
+	fs.DurationVar(&c.Scheduler.Interval, "scheduler-interval", c.Scheduler.Interval, "how often due publish/unpublish schedules are run (0 = off)")
+
+	fs.BoolVar(&c.Events.Enabled, "events", c.Events.Enabled, "stream record changes on /api/events")
+	fs.DurationVar(&c.Events.KeepAlive, "events-keep-alive", c.Events.KeepAlive, "interval of keep-alive comments in event streams")
+
+	fs.DurationVar(&c.Webhooks.Timeout, "webhook-timeout", c.Webhooks.Timeout, "time to wait for a webhook response")
+	fs.IntVar(&c.Webhooks.MaxAttempts, "webhook-max-attempts", c.Webhooks.MaxAttempts, "attempts before a webhook delivery fails")
+	fs.DurationVar(&c.Webhooks.Backoff, "webhook-backoff", c.Webhooks.Backoff, "delay after the first failed attempt, doubled per attempt")
+	fs.DurationVar(&c.Webhooks.MaxBackoff, "webhook-max-backoff", c.Webhooks.MaxBackoff, "maximum delay between attempts")
+	fs.DurationVar(&c.Webhooks.Retention, "webhook-retention", c.Webhooks.Retention, "how long finished deliveries are kept (0 = forever)")
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*$`)
+
+// Origins bestehen nur aus Schema, Host und optional Port, ohne Pfad
+var originPattern = regexp.MustCompile(`^https?://[A-Za-z0-9.-]+(:[0-9]+)?$`)
+
+var urlPattern = regexp.MustCompile(`^https?://[A-Za-z0-9.-]+(:[0-9]+)?(/[^\s]*)?$`)
+
+// Namen von Webhooks erscheinen in der API und im Protokoll der Zustellungen
+var webhookNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Validate prüft die Konfiguration und meldet alle Fehler auf einmal
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr must not be empty")
+	check((c.Server.TLSCert == "") == (c.Server.TLSKey == ""), "server.tls_cert and server.tls_key must be set together")
+	check(c.Server.ReadHeaderTimeout >= 0 && c.Server.ReadTimeout >= 0 && c.Server.WriteTimeout >= 0 && c.Server.IdleTimeout >= 0,
+		"server timeouts must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+
+	check(c.Database.Host != "", "database.host must not be empty")
+	check(c.Database.Port > 0 && c.Database.Port <= 65535, "database.port %d is out of range", c.Database.Port)
+	check(c.Database.User != "", "database.user must not be empty")
+	check(c.Database.Name != "", "database.name must not be empty")
+	switch c.Database.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		check(false, "database.sslmode %q is not supported", c.Database.SSLMode)
+	}
+	if c.Database.SSLRootCert != "" {
+		_, err := os.Stat(c.Database.SSLRootCert)
+		check(err == nil, "database.sslrootcert: %v", err)
+	}
+	check(c.Database.ConnectTimeout >= 0, "database.connect_timeout must not be negative")
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns must not be negative")
+	check(c.Database.MaxOpenConns == 0 || c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns must not exceed database.max_open_conns")
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time must not be negative")
+	check(c.Database.StartupTimeout >= 0, "database.startup_timeout must not be negative")
+	check(c.Database.StatementTimeout >= 0, "database.statement_timeout must not be negative")
+	for endpoint, timeout := range c.Database.StatementTimeouts {
+		known := false
+		for _, name := range statementEndpoints {
+			known = known || name == endpoint
+		}
+		check(known, "database.statement_timeouts: unknown endpoint group %q (allowed: %s)", endpoint, strings.Join(statementEndpoints, ", "))
+		check(timeout >= 0, "database.statement_timeouts.%s must not be negative", endpoint)
+	}
+	check(c.Database.MaxQueryCost >= 0, "database.max_query_cost must not be negative")
+
+	check(identifierPattern.MatchString(c.CMS.MetadataSchema), "cms.metadata_schema %q is not a valid schema name", c.CMS.MetadataSchema)
+	for _, schema := range c.CMS.ExposedSchemas {
+		for _, hidden := range c.CMS.HiddenSchemas {
+			check(schema != hidden, "schema %q is both exposed and hidden", schema)
+		}
+	}
+	check(c.CMS.CatalogTTL >= 0, "cms.catalog_ttl must not be negative")
+	check(c.CMS.EditLockTTL >= 30*time.Second, "cms.edit_lock_ttl must be at least 30s")
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "log.level %q is not supported", c.Log.Level)
+	}
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format %q is not supported", c.Log.Format)
+
+	switch c.Tracing.Exporter {
+	case "none", "otlp", "stdout":
+	default:
+		check(false, "tracing.exporter %q is not supported", c.Tracing.Exporter)
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+	check(c.Tracing.Exporter == "none" || c.Tracing.ServiceName != "", "tracing.service_name must not be empty")
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		check(origin == "*" || originPattern.MatchString(origin), "cors.allowed_origins: %q is not an origin like https://example.org", origin)
+	}
+	check(len(c.CORS.AllowedOrigins) == 0 || len(c.CORS.AllowedMethods) > 0, "cors.allowed_methods must not be empty")
+	check(c.CORS.MaxAge >= 0, "cors.max_age must not be negative")
+
+	for group, limit := range c.RateLimit.Groups {
+		check(slices.Contains(rateLimitGroups, group), "rate_limit.groups: unknown group %q (allowed: %s)", group, strings.Join(rateLimitGroups, ", "))
+		for scope, l := range map[string]middleware.Limit{"per_ip": limit.PerIP, "per_user": limit.PerUser} {
+			check(l.Rate >= 0 && l.Burst >= 0, "rate_limit.groups.%s.%s must not be negative", group, scope)
+			check(l.Rate == 0 || l.Burst >= 1, "rate_limit.groups.%s.%s.burst must be at least 1", group, scope)
+		}
+	}
+	for _, proxy := range c.RateLimit.TrustedProxies {
+		_, err := middleware.ParsePrefix(proxy)
+		check(err == nil, "rate_limit.trusted_proxies: %q is not an address or CIDR", proxy)
+	}
+	check(c.RateLimit.Lockout.MaxFailures >= 0, "rate_limit.lockout.max_failures must not be negative")
+	check(c.RateLimit.Lockout.MaxFailures == 0 || (c.RateLimit.Lockout.Window > 0 && c.RateLimit.Lockout.Duration > 0),
+		"rate_limit.lockout.window and duration must be positive")
+
+	for role, scopes := range c.Auth.Roles {
+		for _, scope := range scopes {
+			check(slices.Contains(auth.Scopes, scope), "auth.roles.%s: unknown scope %q (allowed: %s)", role, scope, strings.Join(auth.Scopes, ", "))
+		}
+	}
+	for _, role := range c.Auth.TwoFactor.RequiredRoles {
+		_, known := c.Auth.Roles[role]
+		check(known, "auth.two_factor.required_roles: unknown role %q", role)
+	}
+	check(c.Auth.TwoFactor.Issuer != "" && !strings.Contains(c.Auth.TwoFactor.Issuer, ":"), "auth.two_factor.issuer must be set and must not contain a colon")
+	check(c.Auth.SessionTTL > 0, "auth.session_ttl must be positive")
+	check(c.Auth.TokenTTL > 0 && c.Auth.TokenTTL <= c.Auth.TokenMaxTTL, "auth.token_ttl must be positive and not exceed auth.token_max_ttl")
+	if oidc := c.Auth.OIDC; oidc.Issuer != "" {
+		check(urlPattern.MatchString(oidc.Issuer), "auth.oidc.issuer %q is not an http(s) URL", oidc.Issuer)
+		check(oidc.ClientID != "", "auth.oidc.client_id must be set")
+		check(urlPattern.MatchString(oidc.RedirectURL) && strings.HasSuffix(oidc.RedirectURL, "/auth/callback"),
+			"auth.oidc.redirect_url %q must be the public URL of /auth/callback", oidc.RedirectURL)
+		check(slices.Contains(oidc.Scopes, "openid"), "auth.oidc.scopes must contain openid")
+		for group, role := range oidc.GroupRoles {
+			_, known := c.Auth.Roles[role]
+			check(known, "auth.oidc.group_roles.%s: unknown role %q", group, role)
+		}
+		_, known := c.Auth.Roles[oidc.DefaultRole]
+		check(oidc.DefaultRole == "" || known, "auth.oidc.default_role: unknown role %q", oidc.DefaultRole)
+	}
+
+	check(c.Scheduler.Interval >= 0, "scheduler.interval must not be negative")
+	check(!c.Events.Enabled || c.Events.KeepAlive > 0, "events.keep_alive must be positive")
+
+	check(c.Webhooks.Timeout > 0, "webhooks.timeout must be positive")
+	check(c.Webhooks.MaxAttempts >= 1, "webhooks.max_attempts must be at least 1")
+	check(c.Webhooks.Backoff > 0 && c.Webhooks.MaxBackoff >= c.Webhooks.Backoff, "webhooks.backoff must be positive and not exceed webhooks.max_backoff")
+	check(c.Webhooks.Retention >= 0, "webhooks.retention must not be negative")
+	check(len(c.Webhooks.Endpoints) == 0 || c.Scheduler.Interval > 0, "webhooks are delivered by the scheduler, scheduler.interval must be positive")
+	names := map[string]bool{}
+	for i, endpoint := range c.Webhooks.Endpoints {
+		check(webhookNamePattern.MatchString(endpoint.Name), "webhooks.endpoints[%d].name %q must consist of letters, digits, '.', '_' or '-'", i, endpoint.Name)
+		check(!names[endpoint.Name], "webhooks.endpoints: duplicate name %q", endpoint.Name)
+		names[endpoint.Name] = true
+		check(urlPattern.MatchString(endpoint.URL), "webhooks.endpoints.%s.url %q is not an http(s) URL", endpoint.Name, endpoint.URL)
+		check(endpoint.Secret != "", "webhooks.endpoints.%s.secret must be set", endpoint.Name)
+		check(endpoint.Schema == "" || identifierPattern.MatchString(endpoint.Schema), "webhooks.endpoints.%s.schema %q is not a valid schema name", endpoint.Name, endpoint.Schema)
+		check(endpoint.Table == "" || (endpoint.Schema != "" && identifierPattern.MatchString(endpoint.Table)),
+			"webhooks.endpoints.%s.table %q must be a valid table name and requires a schema", endpoint.Name, endpoint.Table)
+		for _, event := range endpoint.Events {
+			check(slices.Contains(webhooks.Events, event), "webhooks.endpoints.%s: unknown event %q (allowed: %s)", endpoint.Name, event, strings.Join(webhooks.Events, ", "))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Print schreibt die wirksame Konfiguration als YAML, Passwort, Client-Secret und Webhook-Secrets werden maskiert
+func (c Config) Print(w io.Writer) error {
+	if c.Database.Password != "" {
+		c.Database.Password = "********"
+	}
+	if c.Auth.OIDC.ClientSecret != "" {
+		c.Auth.OIDC.ClientSecret = "********"
+	}
+	c.Webhooks.Endpoints = slices.Clone(c.Webhooks.Endpoints)
+	for i := range c.Webhooks.Endpoints {
+		c.Webhooks.Endpoints[i].Secret = "********"
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// parseDuration akzeptiert Go-Dauern wie 5s sowie reine Sekundenangaben
+func parseDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// parseRateLimits liest Angaben der Form api.per_ip=20/40,write.per_user=2/10 (Rate pro Sekunde/Burst)
+// und überschreibt damit die betroffenen Einträge in opts.Groups
+func parseRateLimits(value string, opts *middleware.RateLimitOptions) error {
+	if opts.Groups == nil {
+		opts.Groups = map[string]middleware.GroupLimit{}
+	}
+	for _, item := range splitList(value) {
+		key, limit, ok := strings.Cut(item, "=")
+		group, scope, ok2 := strings.Cut(key, ".")
+		rate, burst, ok3 := strings.Cut(limit, "/")
+		if !ok || !ok2 || !ok3 {
+			return fmt.Errorf("%q is not in the form group.scope=rate/burst", item)
+		}
+		var l middleware.Limit
+		var err error
+		if l.Rate, err = strconv.ParseFloat(rate, 64); err != nil {
+			return fmt.Errorf("%q: invalid rate: %w", item, err)
+		}
+		if l.Burst, err = strconv.Atoi(burst); err != nil {
+			return fmt.Errorf("%q: invalid burst: %w", item, err)
+		}
+
+		entry := opts.Groups[group]
+		switch scope {
+		case "per_ip":
+			entry.PerIP = l
+		case "per_user":
+			entry.PerUser = l
+		default:
+			return fmt.Errorf("%q: scope must be per_ip or per_user", item)
+		}
+		opts.Groups[group] = entry
+	}
+	return nil
+}
+
+// parseTimeouts liest Angaben der Form content=5s,save=10s
+func parseTimeouts(value string) (map[string]time.Duration, error) {
+	timeouts := map[string]time.Duration{}
+	for _, item := range splitList(value) {
+		name, duration, found := strings.Cut(item, "=")
+		if !found {
+			return nil, fmt.Errorf("expected group=duration, got %q", item)
+		}
+		d, err := parseDuration(strings.TrimSpace(duration))
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration for %s: %q", name, duration)
+		}
+		timeouts[strings.TrimSpace(name)] = d
+	}
+	return timeouts, nil
+}
+
+// parseGroupRoles liest Angaben der Form cms-editors=editor,cms-admins=admin
+func parseGroupRoles(value string) (map[string]string, error) {
+	roles := map[string]string{}
+	for _, item := range splitList(value) {
+		group, role, found := strings.Cut(item, "=")
+		if !found {
+			return nil, fmt.Errorf("expected group=role, got %q", item)
+		}
+		roles[strings.TrimSpace(group)] = strings.TrimSpace(role)
+	}
+	return roles, nil
+}
+
+// parseRoles liest Angaben der Form viewer=read,editor=read+write
+func parseRoles(value string) (map[string][]string, error) {
+	roles := map[string][]string{}
+	for _, item := range splitList(value) {
+		role, scopes, found := strings.Cut(item, "=")
+		if !found {
+			return nil, fmt.Errorf("expected role=scope+scope, got %q", item)
+		}
+		roles[strings.TrimSpace(role)] = strings.Split(strings.TrimSpace(scopes), "+")
+	}
+	return roles, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"wuffnetCMS/webhooks"
+
+	"gopkg.in/yaml.v3"
+)
+
+// writeConfig legt eine Konfigurationsdatei im temporären Verzeichnis des Tests an
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const yamlConfig = `
+server:
+  addr: ":9000"
+  read_timeout: 45s
+database:
+  host: db.file
+  port: 6543
+  user: cms
+  name: cms
+log:
+  level: debug
+`
+
+const tomlConfig = `
+[server]
+addr = ":9000"
+read_timeout = "45s"
+
+[database]
+host = "db.file"
+port = 6543
+user = "cms"
+name = "cms"
+
+[log]
+level = "debug"
+`
+
+// Rangfolge: Standardwerte < Datei < Umgebung < Flags
+func TestLoadPrecedence(t *testing.T) {
+	for _, file := range []struct{ name, content string }{{"config.yaml", yamlConfig}, {"config.toml", tomlConfig}} {
+		t.Run(file.name, func(t *testing.T) {
+			path := writeConfig(t, file.name, file.content)
+			t.Setenv("CMS_LISTEN_ADDR", ":9100")
+			t.Setenv("DB_HOST", "db.env")
+
+			cfg, err := Load([]string{"-config", path, "-listen", ":9200"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tests := []struct {
+				name      string
+				got, want interface{}
+			}{
+				{"flag over env and file", cfg.Server.Addr, ":9200"},
+				{"env over file", cfg.Database.Host, "db.env"},
+				{"file over default", cfg.Database.Port, 6543},
+				{"file duration", cfg.Server.ReadTimeout, 45 * time.Second},
+				{"file string", cfg.Log.Level, "debug"},
+				{"default", cfg.Server.WriteTimeout, 60 * time.Second},
+			}
+			for _, tt := range tests {
+				if tt.got != tt.want {
+					t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name, file, content string
+		want                string
+	}{
+		{"unknown YAML key", "config.yaml", "server:\n  adress: \":9000\"\n", "field adress not found"},
+		{"unknown TOML key", "config.toml", "[server]\nadress = \":9000\"\n", "field adress not found"},
+		{"invalid TOML", "config.toml", "[server\n", "invalid config file"},
+		{"TOML parsed by extension only", "config.yml", "[server]\naddr = \":9000\"\n", "invalid config file"},
+		{"validation", "config.toml", "[database]\nport = 0\nuser = \"cms\"\nname = \"cms\"\n", "database.port 0 is out of range"},
+	}
+	for _, tt := range tests {
+		_, err := Load([]string{"-config", writeConfig(t, tt.file, tt.content)})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	if _, err := Load([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}); err == nil {
+		t.Error("missing explicit config file accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() Config {
+		cfg := Default()
+		cfg.Database.User, cfg.Database.Name = "cms", "cms"
+		return cfg
+	}
+	if cfg := valid(); cfg.Validate() != nil {
+		t.Fatalf("valid config rejected: %v", cfg.Validate())
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []string
+	}{
+		{"empty addr", func(c *Config) { c.Server.Addr = "" }, []string{"server.addr must not be empty"}},
+		{"TLS key missing", func(c *Config) { c.Server.TLSCert = "cert.pem" }, []string{"server.tls_cert and server.tls_key must be set together"}},
+		{"sslmode", func(c *Config) { c.Database.SSLMode = "always" }, []string{`database.sslmode "always" is not supported`}},
+		{"idle above open conns", func(c *Config) { c.Database.MaxOpenConns, c.Database.MaxIdleConns = 2, 5 }, []string{"database.max_idle_conns must not exceed"}},
+		{"unknown timeout group", func(c *Config) { c.Database.StatementTimeouts = map[string]time.Duration{"reports": time.Second} }, []string{`unknown endpoint group "reports"`}},
+		{"exposed and hidden", func(c *Config) { c.CMS.ExposedSchemas, c.CMS.HiddenSchemas = []string{"shop"}, []string{"shop"} }, []string{`schema "shop" is both exposed and hidden`}},
+		{"all errors at once", func(c *Config) { c.Log.Level, c.Log.Format = "trace", "xml" }, []string{`log.level "trace"`, `log.format "xml"`}},
+	}
+	for _, tt := range tests {
+		cfg := valid()
+		tt.modify(&cfg)
+		err := cfg.Validate()
+		if err == nil {
+			t.Errorf("%s: accepted", tt.name)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %q does not contain %q", tt.name, err, want)
+			}
+		}
+	}
+}
+
+// Print gibt gültiges YAML aus, das sich wieder laden lässt; Geheimnisse erscheinen nur maskiert
+func TestPrint(t *testing.T) {
+	cfg := Default()
+	cfg.Database.User, cfg.Database.Name, cfg.Database.Password = "cms", "cms", "db-secret"
+	cfg.Auth.OIDC.ClientSecret = "oidc-secret"
+	cfg.Webhooks.Endpoints = []webhooks.Endpoint{{Name: "search", URL: "https://search.example.org/hook", Secret: "hook-secret"}}
+
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"db-secret", "oidc-secret", "hook-secret"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("output contains %s", secret)
+		}
+	}
+	if cfg.Webhooks.Endpoints[0].Secret != "hook-secret" {
+		t.Error("Print changed the webhook secret of the caller")
+	}
+
+	printed := Default()
+	decoder := yaml.NewDecoder(&out)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&printed); err != nil {
+		t.Fatal(err)
+	}
+	if printed.Database.Password != "********" || printed.Auth.OIDC.ClientSecret != "********" || printed.Webhooks.Endpoints[0].Secret != "********" {
+		t.Errorf("secrets not masked: %q %q %q", printed.Database.Password, printed.Auth.OIDC.ClientSecret, printed.Webhooks.Endpoints[0].Secret)
+	}
+	if printed.Server.ReadTimeout != cfg.Server.ReadTimeout || printed.Webhooks.Endpoints[0].URL != cfg.Webhooks.Endpoints[0].URL ||
+		printed.RateLimit.Groups["api"] != cfg.RateLimit.Groups["api"] {
+		t.Error("printed config does not round-trip")
+	}
+}
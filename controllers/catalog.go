@@ -0,0 +1,327 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+	"wuffnetCMS/models"
+
+	"github.com/lib/pq"
+)
+
+// ExposedSchemas begrenzt das CMS auf diese Schemas; leer bedeutet alle außer HiddenSchemas
+var ExposedSchemas []string
+
+// HiddenSchemas werden weder angezeigt noch bearbeitet
+var HiddenSchemas []string
+
+// schemaVisible prüft ein Schema gegen ExposedSchemas und HiddenSchemas.
+// Das Metadaten-Schema ist nur sichtbar, wenn es ausdrücklich freigegeben ist.
+func schemaVisible(schema string) bool {
+	if schema == MetadataSchema && !slices.Contains(ExposedSchemas, schema) {
+		return false
+	}
+	for _, hidden := range HiddenSchemas {
+		if schema == hidden {
+			return false
+		}
+	}
+	if len(ExposedSchemas) == 0 {
+		return true
+	}
+	for _, exposed := range ExposedSchemas {
+		if schema == exposed {
+			return true
+		}
+	}
+	return false
+}
+
+// filterSchema schränkt eine Liste aus den Metadaten-Tabellen auf schema bzw. auf alle Schemas ein,
+// die schemaVisible zulässt. Gefiltert wird in SQL, damit LIMIT und OFFSET nur sichtbare Einträge zählen.
+// column ist eine feste Spalte wie table_schema; ein verborgenes schema ergibt 404.
+func filterSchema(query *sqlBuilder, column, schema string) error {
+	if schema != "" {
+		if !schemaVisible(schema) {
+			return newError(http.StatusNotFound, CodeNotFound, "Schema not found")
+		}
+		query.SQL(" AND " + column + " = ").Arg(schema)
+		return nil
+	}
+	hidden := append([]string{}, HiddenSchemas...)
+	if !slices.Contains(ExposedSchemas, MetadataSchema) {
+		hidden = append(hidden, MetadataSchema)
+	}
+	query.SQL(" AND " + column + " <> ALL(").Arg(pq.Array(hidden)).SQL(")")
+	if len(ExposedSchemas) > 0 {
+		query.SQL(" AND " + column + " = ANY(").Arg(pq.Array(ExposedSchemas)).SQL(")")
+	}
+	return nil
+}
+
+// CatalogTTL bestimmt, wie lange der zwischengespeicherte Katalog gilt; 0 = bei jeder Anfrage neu lesen
+var CatalogTTL = time.Minute
+
+// Unbekannte Namen lösen höchstens in diesem Abstand ein erneutes Lesen aus,
+// damit beliebige Namen in Anfragen keine Katalogabfragen erzwingen
+const catalogMissInterval = 5 * time.Second
+
+var catalog struct {
+	mu     sync.Mutex
+	tables []models.Table
+	loaded time.Time
+}
+
+// LoadCatalog liefert alle sichtbaren Tabellen mit Spalten, Primär- und Fremdschlüsseln.
+// Das Ergebnis wird zwischengespeichert und darf nicht verändert werden.
+func LoadCatalog(ctx context.Context, db Queryer) ([]models.Table, error) {
+	catalog.mu.Lock()
+	defer catalog.mu.Unlock()
+	if catalog.tables != nil && time.Since(catalog.loaded) < CatalogTTL {
+		return catalog.tables, nil
+	}
+	return reloadCatalog(ctx, db)
+}
+
+// reloadCatalog liest den Katalog neu; catalog.mu muss gehalten werden
+func reloadCatalog(ctx context.Context, db Queryer) ([]models.Table, error) {
+	tables, err := loadCatalog(ctx, db, "", "")
+	if err != nil {
+		return nil, err
+	}
+	if tables == nil {
+		tables = []models.Table{}
+	}
+	catalog.tables = tables
+	catalog.loaded = time.Now()
+	return tables, nil
+}
+
+// LoadTable sucht eine sichtbare Tabelle im Katalog, nil wenn sie nicht existiert.
+// Ist sie unbekannt, wird der Katalog einmal neu gelesen, falls er nicht gerade erst geladen wurde.
+func LoadTable(ctx context.Context, db Queryer, schema, table string) (*models.Table, error) {
+	tables, err := LoadCatalog(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if found := findTable(tables, schema, table); found != nil {
+		return found, nil
+	}
+
+	catalog.mu.Lock()
+	defer catalog.mu.Unlock()
+	if time.Since(catalog.loaded) < catalogMissInterval {
+		return findTable(catalog.tables, schema, table), nil
+	}
+	tables, err = reloadCatalog(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return findTable(tables, schema, table), nil
+}
+
+func findTable(tables []models.Table, schema, table string) *models.Table {
+	for i := range tables {
+		if tables[i].Schema == schema && tables[i].Name == table {
+			return &tables[i]
+		}
+	}
+	return nil
+}
+
+// resolveTable löst Schema- und Tabellennamen aus einer Anfrage gegen den Katalog auf; unbekannte Namen ergeben 400
+func resolveTable(ctx context.Context, db Queryer, schema, table string) (*models.Table, error) {
+	if schema == "" || table == "" {
+		return nil, badRequest("Schema or table name missing")
+	}
+	found, err := LoadTable(ctx, db, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("error reading catalog: %w", err)
+	}
+	if found == nil {
+		return nil, newError(http.StatusBadRequest, CodeUnknownTable, fmt.Sprintf("Unknown table: %s.%s", schema, table))
+	}
+	return found, nil
+}
+
+// resolveColumn löst einen Spaltennamen aus einer Anfrage auf; unbekannte Namen ergeben 400
+func resolveColumn(table *models.Table, name string) (*models.Column, error) {
+	column := table.Column(name)
+	if column == nil {
+		return nil, newError(http.StatusBadRequest, CodeUnknownColumn, fmt.Sprintf("Unknown column: %s", name))
+	}
+	return column, nil
+}
+
+// resolvePrimaryKey prüft, dass name der Primärschlüssel der Tabelle ist
+func resolvePrimaryKey(table *models.Table, name string) (*models.Column, error) {
+	if table.ReadOnly {
+		return nil, newError(http.StatusBadRequest, CodeBadRequest, "Table has a composite primary key and is read-only")
+	}
+	if table.PrimaryKey == "" {
+		return nil, newError(http.StatusBadRequest, CodeBadRequest, "Table has no primary key")
+	}
+	if name != table.PrimaryKey {
+		return nil, newError(http.StatusBadRequest, CodeUnknownColumn, fmt.Sprintf("%s is not the primary key of %s.%s", name, table.Schema, table.Name))
+	}
+	return table.Column(name), nil
+}
+
+// loadCatalog schränkt den Katalog optional auf Schema und Tabelle ein
+func loadCatalog(ctx context.Context, db Queryer, schema, table string) ([]models.Table, error) {
+	query := `
+		SELECT
+			col.table_schema,
+			col.table_name,
+			col.column_name,
+			col.data_type,
+			col.is_nullable = 'YES' AS is_nullable,
+			col.column_default,
+			CASE WHEN col.is_identity = 'YES' THEN col.identity_generation ELSE '' END AS identity,
+			col.is_generated = 'ALWAYS' AS is_generated,
+			col.character_maximum_length,
+			CASE WHEN col.data_type = 'numeric' THEN col.numeric_precision END,
+			CASE WHEN col.data_type = 'numeric' THEN col.numeric_scale END,
+			pk.column_name IS NOT NULL AS is_primary_key,
+			EXISTS (
+				SELECT 1
+				FROM pg_index AS idx
+				JOIN pg_attribute AS att
+					ON att.attrelid = idx.indrelid
+					AND att.attnum = idx.indkey[0]
+				WHERE idx.indrelid = format('%I.%I', col.table_schema, col.table_name)::regclass
+					AND idx.indisunique
+					AND NOT idx.indisprimary
+					AND idx.indnatts = 1
+					AND idx.indpred IS NULL
+					AND att.attname = col.column_name
+			) AS is_unique,
+			ARRAY(
+				SELECT pg_get_constraintdef(con.oid)
+				FROM pg_constraint AS con
+				JOIN pg_attribute AS att
+					ON att.attrelid = con.conrelid
+					AND att.attnum = con.conkey[1]
+				WHERE con.conrelid = format('%I.%I', col.table_schema, col.table_name)::regclass
+					AND con.contype = 'c'
+					AND array_length(con.conkey, 1) = 1
+					AND att.attname = col.column_name
+			) AS checks,
+			fk.referenced_schema,
+			fk.referenced_table,
+			fk.referenced_column
+		FROM information_schema.columns AS col
+		JOIN information_schema.tables AS t
+			ON t.table_schema = col.table_schema
+			AND t.table_name = col.table_name
+			AND t.table_type = 'BASE TABLE'
+		LEFT JOIN (
+			SELECT kcu.table_schema, kcu.table_name, kcu.column_name
+			FROM information_schema.table_constraints AS tc
+			JOIN information_schema.key_column_usage AS kcu
+				ON tc.constraint_name = kcu.constraint_name
+				AND tc.table_schema = kcu.table_schema
+				AND tc.table_name = kcu.table_name
+			WHERE tc.constraint_type = 'PRIMARY KEY'
+		) AS pk
+			ON pk.table_schema = col.table_schema
+			AND pk.table_name = col.table_name
+			AND pk.column_name = col.column_name
+		LEFT JOIN (
+			SELECT DISTINCT ON (kcu.table_schema, kcu.table_name, kcu.column_name)
+				kcu.table_schema,
+				kcu.table_name,
+				kcu.column_name,
+				ccu.table_schema AS referenced_schema,
+				ccu.table_name AS referenced_table,
+				ccu.column_name AS referenced_column
+			FROM information_schema.table_constraints AS tc
+			JOIN information_schema.key_column_usage AS kcu
+				ON tc.constraint_name = kcu.constraint_name
+				AND tc.table_schema = kcu.table_schema
+				AND tc.table_name = kcu.table_name
+			JOIN information_schema.constraint_column_usage AS ccu
+				ON tc.constraint_name = ccu.constraint_name
+				AND tc.table_schema = ccu.constraint_schema
+			WHERE tc.constraint_type = 'FOREIGN KEY'
+		) AS fk
+			ON fk.table_schema = col.table_schema
+			AND fk.table_name = col.table_name
+			AND fk.column_name = col.column_name
+		WHERE col.table_schema NOT IN ('pg_catalog', 'information_schema')
+			AND ($1 = '' OR col.table_schema = $1)
+			AND ($2 = '' OR col.table_name = $2)
+		ORDER BY col.table_schema, col.table_name, col.ordinal_position;
+	`
+
+	rows, err := db.QueryContext(ctx, query, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %v", err)
+	}
+	defer rows.Close()
+
+	var tables []models.Table
+	for rows.Next() {
+		var tableSchema, tableName string
+		var col models.Column
+		var isPrimaryKey bool
+		var columnDefault sql.NullString
+		var maxLength, precision, scale sql.NullInt64
+		var checks pq.StringArray
+		var refSchema, refTable, refColumn sql.NullString
+		if err := rows.Scan(&tableSchema, &tableName, &col.Name, &col.DataType, &col.IsNullable, &columnDefault, &col.Identity, &col.Generated,
+			&maxLength, &precision, &scale, &isPrimaryKey, &col.Unique, &checks, &refSchema, &refTable, &refColumn); err != nil {
+			return nil, fmt.Errorf("failed to scan catalog: %v", err)
+		}
+		if !schemaVisible(tableSchema) {
+			continue
+		}
+		col.Default = columnDefault.String
+		col.HasDefault = columnDefault.Valid || col.Identity != "" || col.Generated
+		col.MaxLength = nullInt(maxLength)
+		col.NumericPrecision = nullInt(precision)
+		col.NumericScale = nullInt(scale)
+		col.Checks = checks
+
+		if refSchema.Valid && refTable.Valid && refColumn.Valid {
+			col.References = &models.ForeignKey{Schema: refSchema.String, Table: refTable.String, Column: refColumn.String}
+		}
+
+		// Die Zeilen sind sortiert, daher genügt der Vergleich mit der letzten Tabelle
+		if len(tables) == 0 || tables[len(tables)-1].Schema != tableSchema || tables[len(tables)-1].Name != tableName {
+			tables = append(tables, models.Table{Schema: tableSchema, Name: tableName})
+		}
+		current := &tables[len(tables)-1]
+		if isPrimaryKey {
+			current.PrimaryKeys = append(current.PrimaryKeys, col.Name)
+		}
+		current.Columns = append(current.Columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %v", err)
+	}
+
+	// Schreiben und Einzelabfragen setzen einen einspaltigen Schlüssel voraus
+	for i := range tables {
+		switch len(tables[i].PrimaryKeys) {
+		case 0:
+		case 1:
+			tables[i].PrimaryKey = tables[i].PrimaryKeys[0]
+		default:
+			tables[i].ReadOnly = true
+		}
+	}
+	return tables, nil
+}
+
+func nullInt(value sql.NullInt64) *int {
+	if !value.Valid {
+		return nil
+	}
+	v := int(value.Int64)
+	return &v
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+	"wuffnetCMS/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+// filterSchema muss in SQL dieselben Schemas zulassen wie schemaVisible
+func TestFilterSchema(t *testing.T) {
+	defer func(exposed, hidden []string) { ExposedSchemas, HiddenSchemas = exposed, hidden }(ExposedSchemas, HiddenSchemas)
+
+	tests := []struct {
+		name            string
+		exposed, hidden []string
+		schema          string
+		sql             string
+		args            []string // Werte der Array-Parameter bzw. des Schemas
+		status          int      // 0 = kein Fehler
+	}{
+		{"all but metadata", nil, nil, "", ` AND table_schema <> ALL($1)`, []string{`{"cms"}`}, 0},
+		{"hidden schemas", nil, []string{"audit"}, "", ` AND table_schema <> ALL($1)`, []string{`{"audit","cms"}`}, 0},
+		{"exposed schemas", []string{"public"}, nil, "", ` AND table_schema <> ALL($1) AND table_schema = ANY($2)`, []string{`{"cms"}`, `{"public"}`}, 0},
+		{"exposed metadata", []string{"public", "cms"}, nil, "", ` AND table_schema <> ALL($1) AND table_schema = ANY($2)`, []string{`{}`, `{"public","cms"}`}, 0},
+		{"visible parameter", nil, nil, "public", ` AND table_schema = $1`, []string{"public"}, 0},
+		{"hidden parameter", nil, []string{"audit"}, "audit", "", nil, http.StatusNotFound},
+		{"metadata parameter", nil, nil, "cms", "", nil, http.StatusNotFound},
+		{"parameter not exposed", []string{"public"}, nil, "shop", "", nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ExposedSchemas, HiddenSchemas = tt.exposed, tt.hidden
+			query := &sqlBuilder{}
+			err := filterSchema(query, "table_schema", tt.schema)
+			if tt.status != 0 {
+				if apiErr := toAPIError(err); err == nil || apiErr.Status != tt.status {
+					t.Fatalf("filterSchema error = %v, want status %d", err, tt.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query.String() != tt.sql {
+				t.Errorf("SQL = %q, want %q", query.String(), tt.sql)
+			}
+			var args []string
+			for _, arg := range query.Args() {
+				if valuer, ok := arg.(driver.Valuer); ok {
+					value, _ := valuer.Value()
+					arg = value
+				}
+				args = append(args, arg.(string))
+			}
+			if !slices.Equal(args, tt.args) {
+				t.Errorf("args = %q, want %q", args, tt.args)
+			}
+		})
+	}
+
+	// Gegenprobe: der SQL-Filter lässt genau die Schemas zu, die schemaVisible zulässt
+	ExposedSchemas, HiddenSchemas = []string{"public", "shop"}, []string{"shop"}
+	for _, schema := range []string{"public", "shop", "cms", "other"} {
+		query := &sqlBuilder{}
+		filterSchema(query, "table_schema", "")
+		hidden, exposed := pq.StringArray{}, pq.StringArray{}
+		hidden.Scan(mustValue(t, query.Args()[0]))
+		exposed.Scan(mustValue(t, query.Args()[1]))
+		if allowed := !slices.Contains(hidden, schema) && slices.Contains(exposed, schema); allowed != schemaVisible(schema) {
+			t.Errorf("%s: SQL filter allows %v, schemaVisible %v", schema, allowed, schemaVisible(schema))
+		}
+	}
+}
+
+func mustValue(t *testing.T, arg interface{}) interface{} {
+	t.Helper()
+	value, err := arg.(driver.Valuer).Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+// Tabellen mit zusammengesetztem Primärschlüssel behalten alle Schlüsselspalten, sind aber schreibgeschützt
+func TestLoadCatalogPrimaryKeys(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"table_schema", "table_name", "column_name", "data_type", "is_nullable", "column_default", "identity", "is_generated",
+		"character_maximum_length", "numeric_precision", "numeric_scale", "is_primary_key", "is_unique", "checks", "referenced_schema", "referenced_table", "referenced_column"})
+	column := func(table, name string, primaryKey bool) {
+		rows.AddRow("public", table, name, "integer", false, nil, "", false, nil, nil, nil, primaryKey, false, "{}", nil, nil, nil)
+	}
+	column("log", "message", false)
+	column("order_items", "order_id", true)
+	column("order_items", "product_id", true)
+	column("order_items", "qty", false)
+	column("orders", "id", true)
+	mock.ExpectQuery(`FROM information_schema.columns AS col`).WithArgs("", "").WillReturnRows(rows)
+
+	tables, err := loadCatalog(context.Background(), db, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		table       string
+		primaryKey  string
+		primaryKeys []string
+		readOnly    bool
+	}{
+		{"log", "", nil, false},
+		{"order_items", "", []string{"order_id", "product_id"}, true},
+		{"orders", "id", []string{"id"}, false},
+	}
+	for _, tt := range tests {
+		table := findTable(tables, "public", tt.table)
+		if table == nil {
+			t.Fatalf("%s missing", tt.table)
+		}
+		if table.PrimaryKey != tt.primaryKey || !slices.Equal(table.PrimaryKeys, tt.primaryKeys) || table.ReadOnly != tt.readOnly {
+			t.Errorf("%s: PrimaryKey %q, PrimaryKeys %v, ReadOnly %v", tt.table, table.PrimaryKey, table.PrimaryKeys, table.ReadOnly)
+		}
+	}
+
+	if _, err := resolvePrimaryKey(findTable(tables, "public", "order_items"), "order_id"); toAPIError(err).Status != http.StatusBadRequest {
+		t.Errorf("composite key: resolvePrimaryKey error = %v", err)
+	}
+	if column, err := resolvePrimaryKey(findTable(tables, "public", "orders"), "id"); err != nil || column.Name != "id" {
+		t.Errorf("single key: resolvePrimaryKey = %v, %v", column, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// useCatalog setzt den zwischengespeicherten Katalog für die Dauer des Tests, damit resolveTable keine Abfrage braucht
+func useCatalog(t *testing.T, tables []models.Table) {
+	t.Helper()
+	catalog.mu.Lock()
+	defer catalog.mu.Unlock()
+	previous, loaded := catalog.tables, catalog.loaded
+	catalog.tables, catalog.loaded = tables, time.Now()
+	t.Cleanup(func() {
+		catalog.mu.Lock()
+		defer catalog.mu.Unlock()
+		catalog.tables, catalog.loaded = previous, loaded
+	})
+}
@@ -1,16 +1,18 @@
 package controllers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/lib/pq"
+	"wuffnetCMS/metrics"
+	"wuffnetCMS/middleware"
+	"wuffnetCMS/models"
 )
 
 type Option struct {
@@ -23,80 +25,80 @@ type ColumnInfo struct {
 	Type     string   `json:"type"`
 	Options  []Option `json:"options,omitempty"` // Optional für Foreign Keys
 	Readonly bool     `json:"readonly"`
+	FieldConstraints
+
+	// Werte, die die Datenbank selbst vergibt
+	Auto      bool   `json:"auto"`               // Default, Identity oder generiert: darf leer bleiben
+	Default   string `json:"default,omitempty"`  // column_default
+	Identity  string `json:"identity,omitempty"` // ALWAYS oder BY DEFAULT
+	Generated bool   `json:"generated"`          // GENERATED ALWAYS AS (...) STORED
 }
 
 func GetTables(db *sql.DB, w http.ResponseWriter, r *http.Request) {
-	query := `
-		SELECT 
-			t.table_schema, 
-			t.table_name,
-			kcu.column_name AS primary_key_column
-		FROM information_schema.tables AS t
-		LEFT JOIN information_schema.table_constraints AS tc 
-			ON t.table_schema = tc.table_schema 
-			AND t.table_name = tc.table_name 
-			AND tc.constraint_type = 'PRIMARY KEY'
-		LEFT JOIN information_schema.key_column_usage AS kcu 
-			ON tc.constraint_name = kcu.constraint_name 
-			AND tc.table_schema = kcu.table_schema 
-			AND tc.table_name = kcu.table_name
-		WHERE t.table_type = 'BASE TABLE' 
-			AND t.table_schema NOT IN ('pg_catalog', 'information_schema')
-		ORDER BY t.table_schema, t.table_name;
-	`
-
-	rows, err := db.Query(query)
+	annotate(r, "list_tables", "", "")
+	tables, err := LoadCatalog(r.Context(), db)
 	if err != nil {
-		http.Error(w, "Error fetching tables", http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error fetching tables: %w", err))
 		return
 	}
-	defer rows.Close()
 
-	schemaTablesMap := make(map[string][]map[string]interface{})
-	for rows.Next() {
-		var schema, tableName string
-		var primaryKeyColumn sql.NullString
-
-		if err := rows.Scan(&schema, &tableName, &primaryKeyColumn); err != nil {
-			http.Error(w, "Error scanning tables", http.StatusInternalServerError)
-			return
+	// Tabellen nach Schema gruppieren; der Katalog ist bereits sortiert
+	result := []map[string]interface{}{}
+	for _, table := range tables {
+		tableInfo := map[string]interface{}{
+			"tableName":        table.Name,
+			"primaryKeyColumn": table.PrimaryKey,
 		}
-
-		// Bereite die Primärschlüsselspalte für JSON vor
-		var primaryKey string
-		if primaryKeyColumn.Valid {
-			primaryKey = primaryKeyColumn.String
+		if len(result) == 0 || result[len(result)-1]["schema"] != table.Schema {
+			result = append(result, map[string]interface{}{"schema": table.Schema, "tables": []map[string]interface{}{}})
 		}
+		group := result[len(result)-1]
+		group["tables"] = append(group["tables"].([]map[string]interface{}), tableInfo)
+	}
 
-		// Struktur für Tabellen- und Primary-Key-Info anlegen
-		tableInfo := map[string]interface{}{
-			"tableName":        tableName,
-			"primaryKeyColumn": primaryKey,
-		}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
 
-		// Füge Tabelle zur Schema-Gruppe hinzu
-		schemaTablesMap[schema] = append(schemaTablesMap[schema], tableInfo)
+func GetTableContent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	annotate(r, "read_content", r.URL.Query().Get("schema"), r.URL.Query().Get("table"))
+	table, err := resolveTable(r.Context(), db, r.URL.Query().Get("schema"), r.URL.Query().Get("table"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	q, err := parseContentQuery(r, table)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 
-	// Konvertiere das Mapping in das gewünschte JSON-Format
-	var result []map[string]interface{}
-	for schema, tables := range schemaTablesMap {
-		result = append(result, map[string]interface{}{
-			"schema": schema,
-			"tables": tables,
-		})
+	response, err := loadTableContent(r.Context(), db, q)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 
+	// JSON-Daten zurücksenden
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		middleware.Logger(r.Context()).Warn("Failed to encode JSON response", "error", err)
+	}
 }
 
-func GetTableContent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
-	schema := r.URL.Query().Get("schema")
-	table := r.URL.Query().Get("table")
-	search := r.URL.Query().Get("filter")
-	sortBy := r.URL.Query().Get("sort_by")
-	order := r.URL.Query().Get("order")
+// contentQuery fasst die Parameter einer Tabellenabfrage zusammen; Tabelle und Sortierspalte stammen aus dem Katalog
+type contentQuery struct {
+	Table  *models.Table
+	Search string
+	SortBy *models.Column
+	Order  string
+	Limit  int
+	Offset int
+	View   string // viewLive oder viewDraft
+}
+
+// parseContentQuery liest Filter, Sortierung und Paging aus den Query-Parametern
+func parseContentQuery(r *http.Request, table *models.Table) (contentQuery, error) {
 	limitStr := r.URL.Query().Get("limit")
 	offsetStr := r.URL.Query().Get("offset")
 
@@ -111,93 +113,136 @@ func GetTableContent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	// Konvertiere limit und offset in Ganzzahlen
 	limitInt, err := strconv.Atoi(limitStr)
 	if err != nil {
-		http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
-		return
+		return contentQuery{}, badRequest("Invalid limit parameter")
 	}
 	offsetInt, err := strconv.Atoi(offsetStr)
 	if err != nil {
-		http.Error(w, "Invalid offset parameter", http.StatusBadRequest)
-		return
+		return contentQuery{}, badRequest("Invalid offset parameter")
 	}
 
-	// Fehlerprüfung auf fehlende Werte
-	if schema == "" || table == "" {
-		http.Error(w, "Schema or table name missing", http.StatusBadRequest)
-		return
+	q := contentQuery{
+		Table:  table,
+		Search: r.URL.Query().Get("filter"),
+		Order:  r.URL.Query().Get("order"),
+		Limit:  limitInt,
+		Offset: offsetInt,
+		View:   r.URL.Query().Get("view"),
+	}
+	switch q.View {
+	case "":
+		q.View = viewLive
+	case viewLive, viewDraft:
+	default:
+		return contentQuery{}, badRequest("Invalid view parameter")
+	}
+	if sortBy := r.URL.Query().Get("sort_by"); sortBy != "" {
+		if q.SortBy, err = resolveColumn(table, sortBy); err != nil {
+			return contentQuery{}, err
+		}
 	}
+	return q, nil
+}
 
-	// Grundlegende SQL-Queries für Abfrage und Zählen
-	baseQuery := fmt.Sprintf("FROM %s.%s", pq.QuoteIdentifier(schema), pq.QuoteIdentifier(table))
-	query := "SELECT * " + baseQuery
-	countQuery := "SELECT COUNT(*) " + baseQuery
-	args := []interface{}{}
-	countArgs := []interface{}{}
-	filterClause := ""
+// loadTableContent liefert die gefilterten Datensätze einer Seite samt Paging-Informationen.
+// Die Abfragen laufen mit dem Statement-Timeout für Tabelleninhalte und der Kostenprüfung.
+func loadTableContent(ctx context.Context, db *sql.DB, q contentQuery) (map[string]interface{}, error) {
+	var response map[string]interface{}
+	err := withStatementTimeout(ctx, db, EndpointContent, true, func(tx Queryer) error {
+		var err error
+		response, err = queryTableContent(ctx, tx, q)
+		return err
+	})
+	return response, err
+}
 
-	// Filter hinzufügen, wenn Suchparameter vorhanden sind
-	if search != "" {
-		colQuery := fmt.Sprintf("SELECT column_name FROM information_schema.columns WHERE table_schema=$1 AND table_name=$2")
-		colRows, err := db.Query(colQuery, schema, table)
-		if err != nil {
-			http.Error(w, "Error fetching columns for filter", http.StatusInternalServerError)
+func queryTableContent(ctx context.Context, db Queryer, q contentQuery) (map[string]interface{}, error) {
+	// Filter über alle Spalten der Tabelle
+	where := func(b *sqlBuilder) {
+		if q.Search == "" {
 			return
 		}
-		defer colRows.Close()
-
-		orConditions := []string{}
-		for colRows.Next() {
-			var colName string
-			if err := colRows.Scan(&colName); err != nil {
-				http.Error(w, "Error scanning columns", http.StatusInternalServerError)
-				return
+		for i := range q.Table.Columns {
+			if i == 0 {
+				b.SQL(" WHERE ")
+			} else {
+				b.SQL(" OR ")
 			}
-			orConditions = append(orConditions, fmt.Sprintf("CAST(%s AS TEXT) ILIKE $%d", pq.QuoteIdentifier(colName), len(args)+1))
-			args = append(args, "%"+search+"%")
-			countArgs = append(countArgs, "%"+search+"%")
-		}
-		if len(orConditions) > 0 {
-			filterClause = " WHERE " + strings.Join(orConditions, " OR ")
+			b.SQL("CAST(").Column(&q.Table.Columns[i]).SQL(" AS TEXT) ILIKE ").Arg("%" + q.Search + "%")
 		}
-		query += filterClause
-		countQuery += filterClause
 	}
 
-	// Sortieroption hinzufügen, falls vorhanden
-	if sortBy != "" {
-		if order != "asc" && order != "desc" {
-			order = "asc"
-		}
-		query += fmt.Sprintf(" ORDER BY %s %s", pq.QuoteIdentifier(sortBy), order)
+	count := &sqlBuilder{}
+	count.SQL("SELECT COUNT(*) FROM ").Table(q.Table)
+	where(count)
+
+	query := &sqlBuilder{}
+	query.SQL("SELECT * FROM ").Table(q.Table)
+	where(query)
+	if q.SortBy != nil {
+		query.SQL(" ORDER BY ").Column(q.SortBy).Order(q.Order)
 	}
+	// Limit und Offset nur für die Datenabfrage, nicht für die Zählung
+	query.SQL(" LIMIT ").Arg(q.Limit).SQL(" OFFSET ").Arg(q.Offset)
 
-	// Limit und Offset hinzufügen nur für query, nicht für countQuery
-	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
-	args = append(args, limitInt, offsetInt)
+	// Zu teure Abfragen (z. B. ILIKE-Filter über große Tabellen) vor der Ausführung ablehnen
+	if err := checkQueryCost(ctx, db, count.String(), count.Args()); err != nil {
+		return nil, err
+	}
+	if err := checkQueryCost(ctx, db, query.String(), query.Args()); err != nil {
+		return nil, err
+	}
 
 	// Gesamtanzahl der gefilterten Datensätze abfragen
 	var totalCount int
-	err = db.QueryRow(countQuery, countArgs...).Scan(&totalCount)
+	err := db.QueryRowContext(ctx, count.String(), count.Args()...).Scan(&totalCount)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error counting rows: %v", err), http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("error counting rows: %w", err)
 	}
 
 	// Query ausführen und Fehler protokollieren
-	rows, err := db.Query(query, args...)
+	rows, err := db.QueryContext(ctx, query.String(), query.Args()...)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to fetch table content: %v", err), http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to fetch table content: %w", err)
 	}
 	defer rows.Close()
 
+	// Ergebnisse sammeln und in JSON-Format umwandeln
+	content, err := scanRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Paging-Informationen hinzufügen
+	response := map[string]interface{}{
+		"data":        content,
+		"totalCount":  totalCount,
+		"hasNextPage": totalCount > (q.Offset + q.Limit),
+	}
+
+	// Gesperrte Datensätze mit dem bearbeitenden Benutzer markieren
+	if err := applyLocks(ctx, db, q.Table, content); err != nil {
+		return nil, err
+	}
+
+	// Entwurfsansicht: offene Entwürfe überlagern die Datensätze, neue Datensätze stehen unter drafts
+	if q.View == viewDraft {
+		created, err := applyDrafts(ctx, db, q.Table, content)
+		if err != nil {
+			return nil, err
+		}
+		response["drafts"] = created
+	}
+	return response, nil
+}
+
+// scanRows liest alle Zeilen eines Ergebnisses und wandelt die Werte in JSON-taugliche Typen um
+func scanRows(rows *sql.Rows) ([]map[string]interface{}, error) {
 	// Spaltennamen und -typen abrufen
 	columnTypes, err := rows.ColumnTypes()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error fetching column types: %v", err), http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("error fetching column types: %w", err)
 	}
 
-	// Ergebnisse sammeln und in JSON-Format umwandeln
 	content := []map[string]interface{}{}
 	for rows.Next() {
 		columnValues := make([]interface{}, len(columnTypes))
@@ -207,8 +252,7 @@ func GetTableContent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		}
 
 		if err := rows.Scan(columnPointers...); err != nil {
-			http.Error(w, fmt.Sprintf("Error scanning row: %v", err), http.StatusInternalServerError)
-			return
+			return nil, fmt.Errorf("error scanning row: %w", err)
 		}
 
 		rowMap := map[string]interface{}{}
@@ -271,145 +315,158 @@ func GetTableContent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		}
 		content = append(content, rowMap)
 	}
+	return content, nil
+}
 
-	// Paging-Informationen hinzufügen
-	response := map[string]interface{}{
-		"data":        content,
-		"totalCount":  totalCount,
-		"hasNextPage": totalCount > (offsetInt + limitInt),
-	}
+// selectOne liest genau einen Datensatz anhand einer Spalte, nil wenn keiner existiert
+func selectOne(ctx context.Context, db Queryer, table *models.Table, column *models.Column, value interface{}) (map[string]interface{}, error) {
+	query := &sqlBuilder{}
+	query.SQL("SELECT * FROM ").Table(table).SQL(" WHERE ").Column(column).SQL(" = ").Arg(value).SQL(" LIMIT 1")
 
-	// JSON-Daten zurücksenden
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
+	rows, err := db.QueryContext(ctx, query.String(), query.Args()...)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding JSON response: %v", err), http.StatusInternalServerError)
+		return nil, fmt.Errorf("failed to fetch record: %w", err)
 	}
+	defer rows.Close()
+
+	content, err := scanRows(rows)
+	if err != nil || len(content) == 0 {
+		return nil, err
+	}
+	return content[0], nil
 }
 
 func GetTableFields(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	schema := r.URL.Query().Get("schema")
-	table := r.URL.Query().Get("table")
+	tableName := r.URL.Query().Get("table")
+	annotate(r, "read_fields", schema, tableName)
 
-	// Fehlerprüfung für fehlende Parameter
-	if schema == "" || table == "" {
-		http.Error(w, "Schema or table name missing", http.StatusBadRequest)
+	table, err := resolveTable(r.Context(), db, schema, tableName)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	// SQL-Query zum Abrufen der Spaltennamen und Datentypen
-	query := `
-		SELECT 
-			col.column_name, 
-			col.data_type,
-			referenced_table_info.table_schema AS referenced_schema,
-			referenced_table_info.table_name AS referenced_table,
-			referenced_table_info.column_name AS referenced_column,
-			pk.constraint_type is not null as readonly
-		FROM 
-			information_schema.columns AS col
-		LEFT JOIN 
-			information_schema.key_column_usage AS kcu ON 
-				col.table_schema = kcu.table_schema AND 
-				col.table_name = kcu.table_name AND 
-				col.column_name = kcu.column_name
-		LEFT JOIN 
-				information_schema.table_constraints AS tc ON 
-				kcu.constraint_name = tc.constraint_name AND 
-				kcu.table_schema = tc.table_schema AND
-				tc.constraint_type = 'FOREIGN KEY'
-		LEFT JOIN 
-				information_schema.table_constraints AS pk ON 
-				kcu.constraint_name = pk.constraint_name AND 
-				kcu.table_schema = pk.table_schema AND
-				pk.constraint_type = 'PRIMARY KEY'	
-		LEFT JOIN 
-			information_schema.constraint_column_usage AS referenced_table_info ON 
-				tc.constraint_name = referenced_table_info.constraint_name AND
-				tc.table_schema = referenced_table_info.table_schema
-		WHERE 
-            col.table_schema = $1 AND 
-            col.table_name = $2;
-	`
-
-	rows, err := db.Query(query, schema, table)
+	var columns []ColumnInfo
+	err = withStatementTimeout(r.Context(), db, EndpointFields, true, func(tx Queryer) error {
+		var err error
+		columns, err = loadTableFields(r.Context(), tx, table)
+		return err
+	})
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error querying columns: %v", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	defer rows.Close()
 
-	var columns []ColumnInfo
+	// Antwort im JSON-Format senden
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(columns); err != nil {
+		middleware.Logger(r.Context()).Warn("Failed to encode JSON response", "error", err)
+	}
+}
 
-	// Ergebnisse iterieren und in die Struktur einfügen
-	for rows.Next() {
-		var col ColumnInfo
-		var referencedSchema, referencedTable, referencedColumn sql.NullString
-		if err := rows.Scan(&col.Name, &col.Type, &referencedSchema, &referencedTable, &referencedColumn, &col.Readonly); err != nil {
-			http.Error(w, fmt.Sprintf("Error scanning column data: %v", err), http.StatusInternalServerError)
-			return
+// loadTableFields liefert die Formularfelder einer Tabelle samt Fremdschlüssel-Optionen und Vorgaben
+func loadTableFields(ctx context.Context, db Queryer, table *models.Table) ([]ColumnInfo, error) {
+	// Vorgaben aus Constraints und Zusatzregeln für die Formularvalidierung
+	rules, err := loadColumnRules(ctx, db, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	constraints := tableConstraints(table, rules)
+
+	columns := []ColumnInfo{}
+	for i := range table.Columns {
+		col := &table.Columns[i]
+		info := ColumnInfo{
+			Name: col.Name,
+			// Typanpassung für PostgreSQL-Datentypen zu allgemeinen Typen
+			Type:      normalizeDataType(col.DataType),
+			Readonly:  col.Name == table.PrimaryKey,
+			Auto:      col.HasDefault,
+			Default:   col.Default,
+			Identity:  col.Identity,
+			Generated: col.Generated,
+		}
+		if c, ok := constraints[col.Name]; ok {
+			info.FieldConstraints = *c
+		}
+		// Generierte Spalten und GENERATED ALWAYS-Identitäten sind nicht beschreibbar
+		if col.Generated || col.Identity == "ALWAYS" {
+			info.Readonly = true
 		}
-		// Typanpassung für PostgreSQL-Datentypen zu allgemeinen Typen
-		col.Type = normalizeDataType(col.Type)
-
-		// Wenn Foreign Key, dann Optionen abfragen und als `select` setzen
-		if referencedSchema.Valid && referencedTable.Valid && referencedColumn.Valid {
-			col.Type = "select" // Setze auf Dropdown
-			optionsQuery := fmt.Sprintf(`
-				SELECT %s AS value, CONCAT_WS(', ', %s) AS label 
-				FROM %s.%s`,
-				referencedColumn.String, // Die ID-Spalte (Primary Key) als `value`
-				getConcatenatedTextColumns(db, referencedSchema.String, referencedTable.String, referencedColumn.String), referencedSchema.String,
-				referencedTable.String,
-			)
-
-			optionsRows, err := db.Query(optionsQuery)
+
+		// Fremdschlüssel auf sichtbare Tabellen werden als Auswahlliste angeboten
+		if col.References != nil {
+			options, visible, err := loadOptions(ctx, db, col.References)
 			if err != nil {
-				log.Printf("Error querying options for foreign key column %s: %v", col.Name, err)
-				continue
+				middleware.Logger(ctx).Warn("Failed to load foreign key options", "column", col.Name, "error", err)
 			}
-			defer optionsRows.Close()
-
-			var options []Option
-			for optionsRows.Next() {
-				var option Option
-				if err := optionsRows.Scan(&option.Value, &option.Label); err != nil {
-					log.Printf("Error scanning foreign key options for column %s: %v", col.Name, err)
-					continue
-				}
-				options = append(options, option)
+			if visible {
+				info.Type = "select"
+				info.Options = options
 			}
-			col.Options = options
 		}
+		columns = append(columns, info)
+	}
+	return columns, nil
+}
 
-		columns = append(columns, col)
+// loadOptions liest die Auswahlwerte eines Fremdschlüssels: den Schlüssel als Wert und die Textspalten
+// der Zieltabelle als Beschriftung. Liegt die Zieltabelle in einem verborgenen Schema, ist visible false.
+func loadOptions(ctx context.Context, db Queryer, reference *models.ForeignKey) (options []Option, visible bool, err error) {
+	target, err := LoadTable(ctx, db, reference.Schema, reference.Table)
+	if err != nil || target == nil {
+		return nil, false, err
+	}
+	valueColumn := target.Column(reference.Column)
+	if valueColumn == nil {
+		return nil, false, nil
 	}
 
-	// Antwort im JSON-Format senden
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(columns); err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding JSON response: %v", err), http.StatusInternalServerError)
+	var labelColumns []*models.Column
+	for i := range target.Columns {
+		if isTextType(target.Columns[i].DataType) {
+			labelColumns = append(labelColumns, &target.Columns[i])
+		}
 	}
+
+	query := &sqlBuilder{}
+	query.SQL("SELECT ").Column(valueColumn).SQL(" AS value, ")
+	if len(labelColumns) > 0 {
+		query.SQL("CONCAT_WS(' ', ").Columns(labelColumns).SQL(")")
+	} else {
+		// Ohne Textspalten dient der Schlüssel selbst als Beschriftung
+		query.SQL("CAST(").Column(valueColumn).SQL(" AS TEXT)")
+	}
+	query.SQL(" AS label FROM ").Table(target)
+
+	options, err = queryOptions(ctx, db, query)
+	return options, true, err
 }
 
-// GetColumnTypes ruft die Spaltentypen der Tabelle ab
-func GetColumnTypes(db *sql.DB, schema, table string) (map[string]string, error) {
-	query := "SELECT column_name, data_type FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2"
-	rows, err := db.Query(query, schema, table)
+// queryOptions führt die Abfrage der Auswahlwerte aus. Ein Savepoint sorgt dafür,
+// dass ein Fehler hier nicht die ganze Transaktion abbricht.
+func queryOptions(ctx context.Context, db Queryer, query *sqlBuilder) ([]Option, error) {
+	if _, err := db.ExecContext(ctx, "SAVEPOINT field_options"); err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, query.String(), query.Args()...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch column types: %v", err)
+		db.ExecContext(ctx, "ROLLBACK TO SAVEPOINT field_options")
+		return nil, err
 	}
 	defer rows.Close()
 
-	columnTypes := make(map[string]string)
+	var options []Option
 	for rows.Next() {
-		var columnName, dataType string
-		if err := rows.Scan(&columnName, &dataType); err != nil {
-			return nil, err
+		var option Option
+		if err := rows.Scan(&option.Value, &option.Label); err != nil {
+			middleware.Logger(ctx).Warn("Failed to scan foreign key option", "error", err)
+			continue
 		}
-		columnTypes[columnName] = dataType
+		options = append(options, option)
 	}
-	return columnTypes, nil
+	return options, rows.Err()
 }
 
 // Hilfsfunktion zur Normalisierung von PostgreSQL-Datentypen
@@ -433,88 +490,188 @@ func normalizeDataType(dataType string) string {
 		return "text" // Fallback auf text
 	}
 }
-func getConcatenatedTextColumns(db *sql.DB, schema, table, fallbackColumn string) string {
-	var columns []string
-	query := `
-        SELECT column_name 
-        FROM information_schema.columns 
-        WHERE table_schema = $1 
-          AND table_name = $2 
-          AND data_type IN ('character varying', 'text', 'char')
-    `
-
-	rows, err := db.Query(query, schema, table)
-	if err != nil {
-		log.Printf("Fehler beim Abrufen der Textspalten: %v", err)
-		return fmt.Sprintf("CAST(%s AS TEXT)", pq.QuoteIdentifier(fallbackColumn)) // Standard: Fallback-Spalte als Text
-	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var columnName string
-		if err := rows.Scan(&columnName); err == nil {
-			columns = append(columns, columnName)
+// RecordColumn ist ein Spalten-Wert-Paar eines zu speichernden Datensatzes
+type RecordColumn struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// columnValue liefert den Wert einer Spalte, nil wenn sie fehlt
+func columnValue(columns []RecordColumn, name string) interface{} {
+	for _, column := range columns {
+		if column.Name == name {
+			return column.Value
 		}
 	}
+	return nil
+}
 
-	if len(columns) == 0 {
-		// Falls keine Textspalten gefunden, Fallback-Spalte verwenden
-		return fmt.Sprintf("CAST(%s AS TEXT)", pq.QuoteIdentifier(fallbackColumn))
-	}
+// SaveRequest beschreibt einen Datensatz, der angelegt oder aktualisiert werden soll
+type SaveRequest struct {
+	Schema     string         `json:"schema"`
+	Table      string         `json:"table"`
+	PrimaryKey string         `json:"primaryKey"`
+	Columns    []RecordColumn `json:"columns"`
+	DraftID    int64          `json:"draftId,omitempty"` // Bestehenden Entwurf ergänzen, z. B. eines noch nicht veröffentlichten Datensatzes
+}
 
-	return "CONCAT_WS(' ', " + strings.Join(columns, ", ") + ")"
+// DeleteRequest beschreibt einen zu löschenden Datensatz
+type DeleteRequest struct {
+	Schema          string      `json:"schema"`
+	Table           string      `json:"table"`
+	PrimaryKey      string      `json:"primaryKey"`
+	PrimaryKeyValue interface{} `json:"primaryKeyValue"`
 }
 
+// saveMode legt fest, ob saveRecord anlegt oder aktualisiert
+type saveMode int
+
+const (
+	// saveAuto aktualisiert, wenn der Primärschlüssel gesetzt ist (Verhalten von /api/save-record)
+	saveAuto saveMode = iota
+	saveInsert
+	saveUpdate
+)
+
 func SaveRecord(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, errMethodNotAllowed)
 		return
 	}
 
 	// Anfrage-Daten parsen
-	var data struct {
-		Schema     string `json:"schema"`
-		Table      string `json:"table"`
-		PrimaryKey string `json:"primaryKey"`
-		Columns    []struct {
-			Name  string      `json:"name"`
-			Value interface{} `json:"value"`
-		} `json:"columns"`
-	}
-
+	var data SaveRequest
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		writeError(w, r, badRequest("Invalid input"))
 		return
 	}
 
-	columnTypes, err := GetColumnTypes(db, data.Schema, data.Table)
+	annotate(r, "save", data.Schema, data.Table)
+	draft, err := saveRecord(r.Context(), db, &data, saveAuto)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to retrieve column types: %v", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
+	if draft != nil {
+		writeJSON(w, http.StatusAccepted, draft)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
+
+// saveRecord prüft und konvertiert die übergebenen Werte und führt ein INSERT oder UPDATE aus.
+// Hat ein anderer Benutzer den Datensatz zur Bearbeitung gesperrt, wird nicht gespeichert.
+// Bei einem INSERT wird der erzeugte Primärschlüssel an data.Columns angehängt.
+// Für Tabellen mit Freigabe-Workflow wird stattdessen ein Entwurf gespeichert und geliefert.
+func saveRecord(ctx context.Context, db *sql.DB, data *SaveRequest, mode saveMode) (*Draft, error) {
+	var operation string
+	var draft *Draft
+	err := withStatementTimeout(ctx, db, EndpointSave, false, func(tx Queryer) error {
+		table, err := resolveTable(ctx, tx, data.Schema, data.Table)
+		if err != nil {
+			return err
+		}
+		if err := checkEditLock(ctx, tx, table, data, mode); err != nil {
+			return err
+		}
+		if workflow, err := workflowEnabled(ctx, tx, table); err != nil {
+			return err
+		} else if workflow {
+			draft, err = saveDraft(ctx, tx, table, data, mode)
+			return err
+		}
+		if operation, err = saveRecordTx(ctx, tx, data, mode); err != nil {
+			return err
+		}
+		return recordChanged(ctx, tx, operation, table, columnValue(data.Columns, table.PrimaryKey))
+	})
+	if err != nil || draft != nil {
+		return draft, err
+	}
+	metrics.RecordChange(operation, data.Schema, data.Table)
+	return nil, nil
+}
+
+// Änderungsarten eines Datensatzes
+const (
+	opInsert = "insert"
+	opUpdate = "update"
+	opDelete = "delete"
+)
+
+// saveRecordTx speichert innerhalb einer bestehenden Transaktion und liefert opInsert bzw. opUpdate
+func saveRecordTx(ctx context.Context, db Queryer, data *SaveRequest, mode saveMode) (string, error) {
+	table, err := resolveTable(ctx, db, data.Schema, data.Table)
+	if err != nil {
+		return "", err
+	}
+	primaryKey, err := resolvePrimaryKey(table, data.PrimaryKey)
+	if err != nil {
+		return "", err
+	}
+	columnTypes := make(map[string]string)
+	columnsByName := make(map[string]models.Column)
+	for _, col := range table.Columns {
+		columnTypes[col.Name] = col.DataType
+		columnsByName[col.Name] = col
+	}
+
+	// Überprüfung auf Primary Key und Setzen für Update
+	var primaryKeyValue interface{}
+	isUpdate := mode == saveUpdate
+	for _, column := range data.Columns {
+		if _, ok := columnTypes[column.Name]; !ok {
+			return "", fieldError(column.Name, CodeUnknownColumn, fmt.Sprintf("Unknown column: %s", column.Name))
+		}
+		if column.Name == data.PrimaryKey {
+			primaryKeyValue = column.Value
+			isUpdate = mode == saveUpdate || (mode == saveAuto && !isEmpty(primaryKeyValue))
+		}
+	}
+
+	// Werte gegen Constraints und Zusatzregeln prüfen, bevor SQL ausgeführt wird
+	if err := validateRecord(ctx, db, table, data, isUpdate, primaryKeyValue); err != nil {
+		return "", err
+	}
 
 	// Variablen für die SQL-Anweisung vorbereiten
-	columns := []string{}
+	columns := []*models.Column{}
 	values := []interface{}{}
-	var primaryKeyValue interface{}
-	isUpdate := false
 
 	for _, column := range data.Columns {
-		colType, ok := columnTypes[column.Name]
-		if !ok {
-			http.Error(w, fmt.Sprintf("Unknown column: %s", column.Name), http.StatusBadRequest)
-			return
+		colType := columnTypes[column.Name]
+		colInfo := columnsByName[column.Name]
+
+		// Generierte Spalten und GENERATED ALWAYS-Identitäten vergibt ausschließlich die Datenbank
+		if colInfo.Generated || colInfo.Identity == "ALWAYS" {
+			continue
 		}
 
-		// Überprüfung auf Primary Key und Setzen für Update
-		if column.Name == data.PrimaryKey {
-			primaryKeyValue = column.Value
-			if primaryKeyValue != nil && primaryKeyValue != "" {
-				isUpdate = true
-			}
+		// Ein explizit gesetzter Primärschlüssel wird nur beim Anlegen mitgeschrieben
+		if column.Name == data.PrimaryKey && (mode != saveInsert || isEmpty(column.Value)) {
 			continue
 		}
 
+		// Leere Werte: Default der Datenbank verwenden bzw. NULL für Nicht-Text-Spalten
+		if isEmpty(column.Value) {
+			if colInfo.HasDefault && !isUpdate {
+				continue
+			}
+			if colInfo.HasDefault && !colInfo.IsNullable {
+				columns = append(columns, table.Column(column.Name))
+				values = append(values, sqlDefault)
+				continue
+			}
+			if colInfo.IsNullable && (column.Value == nil || !isTextType(colType)) {
+				columns = append(columns, table.Column(column.Name))
+				values = append(values, nil)
+				continue
+			}
+		}
+
 		// Konvertierung basierend auf Typ
 		var convertedValue interface{}
 		switch colType {
@@ -526,113 +683,128 @@ func SaveRecord(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 			if val, ok := column.Value.(string); ok {
 				convertedValue, err = time.Parse(time.RFC3339, val)
 				if err != nil {
-					http.Error(w, fmt.Sprintf("Invalid timestamp format for %s: %v", column.Name, err), http.StatusBadRequest)
-					return
+					return "", fieldError(column.Name, CodeInvalidFormat, fmt.Sprintf("Invalid timestamp format for %s", column.Name))
 				}
 			}
 		case "time":
 			if val, ok := column.Value.(string); ok {
 				convertedValue, err = time.Parse("15:04:05", val)
 				if err != nil {
-					http.Error(w, fmt.Sprintf("Invalid time format for %s: %v", column.Name, err), http.StatusBadRequest)
-					return
+					return "", fieldError(column.Name, CodeInvalidFormat, fmt.Sprintf("Invalid time format for %s", column.Name))
 				}
 			}
 		case "numeric", "float":
-			if val, ok := column.Value.(string); ok {
+			switch val := column.Value.(type) {
+			case string:
 				convertedValue, err = strconv.ParseFloat(strings.Replace(val, ",", ".", 1), 64)
 				if err != nil {
-					http.Error(w, fmt.Sprintf("Invalid number format for %s: %v", column.Name, err), http.StatusBadRequest)
-					return
+					return "", fieldError(column.Name, CodeInvalidFormat, fmt.Sprintf("Invalid number format for %s", column.Name))
 				}
+			case float64:
+				convertedValue = val
 			}
 		default:
 			convertedValue = column.Value
 		}
 
-		columns = append(columns, pq.QuoteIdentifier(column.Name))
+		columns = append(columns, table.Column(column.Name))
 		values = append(values, convertedValue)
 	}
 
 	if isUpdate {
-		// UPDATE Query
-		query := fmt.Sprintf("UPDATE %s.%s SET ", pq.QuoteIdentifier(data.Schema), pq.QuoteIdentifier(data.Table))
+		if len(columns) == 0 {
+			return "", badRequest("No columns to update")
+		}
 
-		setClauses := make([]string, len(columns))
+		query := &sqlBuilder{}
+		query.SQL("UPDATE ").Table(table).SQL(" SET ")
 		for i, col := range columns {
-			setClauses[i] = fmt.Sprintf("%s = $%d", col, i+1)
+			if i > 0 {
+				query.SQL(", ")
+			}
+			query.Column(col).SQL(" = ").Arg(values[i])
 		}
+		query.SQL(" WHERE ").Column(primaryKey).SQL(" = ").Arg(primaryKeyValue).SQL(" RETURNING ").Column(primaryKey)
 
-		query += strings.Join(setClauses, ", ")
-		query += fmt.Sprintf(" WHERE %s = $%d", pq.QuoteIdentifier(data.PrimaryKey), len(columns)+1)
-		values = append(values, primaryKeyValue)
-
-		if _, err := db.Exec(query, values...); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to update record: %v", err), http.StatusInternalServerError)
-			return
+		err := db.QueryRowContext(ctx, query.String(), query.Args()...).Scan(&primaryKeyValue)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", errRecordNotFound
 		}
-	} else {
-		// INSERT Query
-		query := fmt.Sprintf("INSERT INTO %s.%s (", pq.QuoteIdentifier(data.Schema), pq.QuoteIdentifier(data.Table))
-		query += strings.Join(columns, ", ")
-		query += ") VALUES ("
+		if err != nil {
+			return "", fmt.Errorf("failed to update record: %w", err)
+		}
+		setPrimaryKeyValue(data, primaryKeyValue)
+		return opUpdate, nil
+	}
 
-		valuePlaceholders := make([]string, len(columns))
-		for i := range valuePlaceholders {
-			valuePlaceholders[i] = fmt.Sprintf("$%d", i+1)
+	// INSERT Query
+	query := &sqlBuilder{}
+	query.SQL("INSERT INTO ").Table(table)
+	if len(columns) == 0 {
+		// Alle Werte stammen aus Defaults der Datenbank
+		query.SQL(" DEFAULT VALUES")
+	} else {
+		query.SQL(" (").Columns(columns).SQL(") VALUES (")
+		for i, value := range values {
+			if i > 0 {
+				query.SQL(", ")
+			}
+			query.Arg(value)
 		}
-		query += strings.Join(valuePlaceholders, ", ")
-		query += ") RETURNING " + pq.QuoteIdentifier(data.PrimaryKey)
+		query.SQL(")")
+	}
+	query.SQL(" RETURNING ").Column(primaryKey)
+
+	if err := db.QueryRowContext(ctx, query.String(), query.Args()...).Scan(&primaryKeyValue); err != nil {
+		return "", fmt.Errorf("failed to insert record: %w", err)
+	}
+	setPrimaryKeyValue(data, primaryKeyValue)
+	return opInsert, nil
+}
 
-		if err := db.QueryRow(query, values...).Scan(&primaryKeyValue); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to insert record: %v", err), http.StatusInternalServerError)
+// setPrimaryKeyValue übernimmt den Schlüssel aus RETURNING, also so, wie Postgres ihn speichert ("007" wird 7);
+// nur dann gleichen die Meldungen von recordChanged denen des Triggers notify_change
+func setPrimaryKeyValue(data *SaveRequest, value interface{}) {
+	for i := range data.Columns {
+		if data.Columns[i].Name == data.PrimaryKey {
+			data.Columns[i].Value = value
 			return
 		}
-		data.Columns = append(data.Columns, struct {
-			Name  string      `json:"name"`
-			Value interface{} `json:"value"`
-		}{data.PrimaryKey, primaryKeyValue})
 	}
+	data.Columns = append(data.Columns, RecordColumn{data.PrimaryKey, value})
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(data)
+func isTextType(dataType string) bool {
+	switch strings.ToLower(dataType) {
+	case "text", "character varying", "character":
+		return true
+	}
+	return false
 }
 
 // DeleteRecord löscht einen Datensatz basierend auf dem Primary Key
 func DeleteRecord(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, errMethodNotAllowed)
 		return
 	}
 
-	var data struct {
-		Schema          string      `json:"schema"`
-		Table           string      `json:"table"`
-		PrimaryKey      string      `json:"primaryKey"`
-		PrimaryKeyValue interface{} `json:"primaryKeyValue"`
-	}
+	var data DeleteRequest
 
 	// Daten aus der Anfrage parsen
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		writeError(w, r, badRequest("Invalid input"))
 		return
 	}
 
-	// Überprüfen, ob die erforderlichen Felder vorhanden sind
-	if data.Schema == "" || data.Table == "" || data.PrimaryKey == "" || data.PrimaryKeyValue == nil {
-		http.Error(w, "Fehlende Parameter für das Löschen", http.StatusBadRequest)
+	annotate(r, "delete", data.Schema, data.Table)
+	affected, err := deleteRecord(r.Context(), db, data)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-
-	// SQL-Anweisung vorbereiten
-	query := fmt.Sprintf("DELETE FROM %s.%s WHERE %s = $1",
-		pq.QuoteIdentifier(data.Schema),
-		pq.QuoteIdentifier(data.Table),
-		pq.QuoteIdentifier(data.PrimaryKey))
-
-	// Ausführen der SQL-Anweisung
-	if _, err := db.Exec(query, data.PrimaryKeyValue); err != nil {
-		http.Error(w, fmt.Sprintf("Fehler beim Löschen des Datensatzes: %v", err), http.StatusInternalServerError)
+	if affected == 0 {
+		writeError(w, r, errRecordNotFound)
 		return
 	}
 
@@ -640,3 +812,43 @@ func DeleteRecord(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Datensatz erfolgreich gelöscht"))
 }
+
+// deleteRecord löscht den Datensatz und liefert die Anzahl der betroffenen Zeilen
+func deleteRecord(ctx context.Context, db *sql.DB, data DeleteRequest) (int64, error) {
+	if data.PrimaryKeyValue == nil {
+		return 0, badRequest("Missing parameters for delete")
+	}
+	table, err := resolveTable(ctx, db, data.Schema, data.Table)
+	if err != nil {
+		return 0, err
+	}
+	primaryKey, err := resolvePrimaryKey(table, data.PrimaryKey)
+	if err != nil {
+		return 0, err
+	}
+
+	// SQL-Anweisung vorbereiten
+	query := &sqlBuilder{}
+	query.SQL("DELETE FROM ").Table(table).SQL(" WHERE ").Column(primaryKey).SQL(" = ").Arg(data.PrimaryKeyValue).
+		SQL(" RETURNING ").Column(primaryKey)
+
+	// Ausführen der SQL-Anweisung
+	var affected int64
+	err = withStatementTimeout(ctx, db, EndpointDelete, false, func(tx Queryer) error {
+		// Gemeldet wird der gespeicherte Schlüssel, nicht der Wert aus der Anfrage (vgl. setPrimaryKeyValue)
+		var key interface{}
+		err := tx.QueryRowContext(ctx, query.String(), query.Args()...).Scan(&key)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete record: %w", err)
+		}
+		affected = 1
+		return recordChanged(ctx, tx, opDelete, table, key)
+	})
+	if err == nil && affected > 0 {
+		metrics.RecordChange(opDelete, table.Schema, table.Name)
+	}
+	return affected, err
+}
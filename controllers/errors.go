@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"wuffnetCMS/middleware"
+
+	"github.com/lib/pq"
+)
+
+// Fehlercodes, auf die Clients reagieren können
+const (
+	CodeBadRequest       = "bad_request"
+	CodeValidation       = "validation_failed"
+	CodeNotFound         = "not_found"
+	CodeForbidden        = "forbidden"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeInternal         = "internal_error"
+	CodeTimeout          = "timeout"
+	CodeLocked           = "locked" // Datensatz wird von einem anderen Benutzer bearbeitet
+
+	CodeQueryTooExpensive = "query_too_expensive"
+	CodeUnknownTable      = "unknown_table"
+
+	// Codes für einzelne Felder
+	CodeRequired      = "required"
+	CodeUnique        = "unique"
+	CodeReference     = "reference"
+	CodeCheck         = "check"
+	CodeInvalidFormat = "invalid_format"
+	CodeUnknownColumn = "unknown_column"
+)
+
+// APIError ist der einheitliche Fehler-Body aller Controller
+type APIError struct {
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+}
+
+// FieldError ordnet einen Validierungsfehler einer Spalte bzw. einem Formularfeld zu
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// Extensions macht Code und Feldfehler auch in GraphQL-Antworten sichtbar
+func (e *APIError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": e.Code}
+	if len(e.Fields) > 0 {
+		extensions["fields"] = e.Fields
+	}
+	return extensions
+}
+
+func newError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+func badRequest(message string) *APIError {
+	return newError(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+// forbidden meldet einen fehlenden Scope des angemeldeten Benutzers
+func forbidden(scope string) *APIError {
+	return newError(http.StatusForbidden, CodeForbidden, "Missing permission: "+scope+".")
+}
+
+// fieldError erzeugt einen Validierungsfehler für genau ein Feld
+func fieldError(field, code, message string) *APIError {
+	return &APIError{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    CodeValidation,
+		Message: message,
+		Fields:  []FieldError{{Field: field, Code: code, Message: message}},
+	}
+}
+
+// errRecordNotFound wird geliefert, wenn der zu ändernde Datensatz nicht existiert
+var errRecordNotFound = newError(http.StatusNotFound, CodeNotFound, "Record not found")
+
+var errMethodNotAllowed = newError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+
+// Schlüsselspalten aus Details wie `Key (email)=(a@b.de) already exists.`
+var pqDetailKey = regexp.MustCompile(`^Key \((.+?)\)=`)
+
+// toAPIError wandelt beliebige Fehler in einen APIError um; Postgres-Fehler werden übersetzt,
+// alle übrigen ohne Details als interner Fehler gemeldet (die Ursache protokolliert logError)
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		copied := *apiErr
+		return &copied
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		if translated := translatePQError(pqErr); translated != nil {
+			return translated
+		}
+	}
+
+	return newError(http.StatusInternalServerError, CodeInternal, "Internal server error")
+}
+
+// translatePQError übersetzt Constraint- und Eingabefehler von Postgres in feldbezogene Meldungen
+func translatePQError(pqErr *pq.Error) *APIError {
+	columns := pqDetailColumns(pqErr.Detail)
+
+	switch pqErr.Code.Name() {
+	case "unique_violation":
+		apiErr := newError(http.StatusConflict, CodeConflict, "A record with this value already exists")
+		for _, column := range columns {
+			apiErr.Fields = append(apiErr.Fields, FieldError{Field: column, Code: CodeUnique, Message: "Value already exists"})
+		}
+		return apiErr
+	case "foreign_key_violation":
+		// Beim Löschen verweisen noch andere Datensätze auf diesen
+		if strings.Contains(pqErr.Detail, "is still referenced") {
+			return newError(http.StatusConflict, CodeConflict, "Record is still referenced by other records")
+		}
+		apiErr := newError(http.StatusUnprocessableEntity, CodeValidation, "Referenced record does not exist")
+		for _, column := range columns {
+			apiErr.Fields = append(apiErr.Fields, FieldError{Field: column, Code: CodeReference, Message: "Referenced record does not exist"})
+		}
+		return apiErr
+	case "not_null_violation":
+		return fieldError(pqErr.Column, CodeRequired, "Value is required")
+	case "check_violation":
+		apiErr := newError(http.StatusUnprocessableEntity, CodeValidation, "Value violates constraint "+pqErr.Constraint)
+		if column := checkConstraintColumn(pqErr); column != "" {
+			apiErr.Fields = []FieldError{{Field: column, Code: CodeCheck, Message: "Value is not allowed"}}
+		}
+		return apiErr
+	case "string_data_right_truncation":
+		return newError(http.StatusUnprocessableEntity, CodeValidation, "Value is too long")
+	case "numeric_value_out_of_range":
+		return newError(http.StatusUnprocessableEntity, CodeValidation, "Number is out of range")
+	case "invalid_text_representation", "invalid_datetime_format", "datetime_field_overflow":
+		return newError(http.StatusUnprocessableEntity, CodeValidation, "Value has an invalid format")
+	case "query_canceled":
+		// statement_timeout überschritten oder Anfrage vom Client abgebrochen
+		return newError(http.StatusServiceUnavailable, CodeTimeout, "Query took too long and was cancelled")
+	case "undefined_table":
+		return newError(http.StatusNotFound, CodeNotFound, "Table not found")
+	case "undefined_column":
+		return badRequest("Unknown column")
+	}
+	return nil
+}
+
+func pqDetailColumns(detail string) []string {
+	match := pqDetailKey.FindStringSubmatch(detail)
+	if match == nil {
+		return nil
+	}
+	columns := strings.Split(match[1], ", ")
+	for i, column := range columns {
+		columns[i] = strings.Trim(column, `"`)
+	}
+	return columns
+}
+
+// checkConstraintColumn leitet die Spalte aus dem Standardnamen <tabelle>_<spalte>_check ab
+func checkConstraintColumn(pqErr *pq.Error) string {
+	name := pqErr.Constraint
+	if pqErr.Table == "" || !strings.HasPrefix(name, pqErr.Table+"_") || !strings.HasSuffix(name, "_check") {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(name, pqErr.Table+"_"), "_check")
+}
+
+// writeError protokolliert den Fehler und sendet ihn als JSON-Body {"error": {...}} mit passendem Status.
+// Die Request-ID setzt die Middleware auch als Header, damit Meldungen dem Logeintrag zugeordnet werden können.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := toAPIError(err)
+	apiErr.RequestID = middleware.ID(r.Context())
+	logError(r.Context(), err, apiErr)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": apiErr})
+}
+
+// NotFound beantwortet unbekannte API-Pfade
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, newError(http.StatusNotFound, CodeNotFound, "Unknown API endpoint"))
+}
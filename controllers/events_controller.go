@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"wuffnetCMS/events"
+	"wuffnetCMS/middleware"
+	"wuffnetCMS/models"
+)
+
+// Events verteilt Änderungen an die Streams von /api/events; nil = ausgeschaltet
+var Events *events.Broker
+
+// EventsKeepAlive ist der Abstand der Kommentarzeilen in offenen Streams
+var EventsKeepAlive = 25 * time.Second
+
+// recordChanged meldet eine Änderung an einem Datensatz innerhalb der Transaktion an die Streams aller Instanzen
+// und legt die Zustellungen der Webhooks an; beides wird erst mit dem Commit wirksam
+func recordChanged(ctx context.Context, tx Queryer, operation string, table *models.Table, key interface{}) error {
+	if Events != nil {
+		event := events.Event{Type: operation, Schema: table.Schema, Table: table.Name}
+		if key != nil {
+			event.Key = recordKey(key)
+		}
+		if err := events.Notify(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+	return enqueueWebhooks(ctx, tx, operation, table, key)
+}
+
+// StreamEvents liefert Änderungen an Datensätzen als Server-Sent Events, optional nach schema und table gefiltert.
+// Der Event-Name ist insert, update, delete oder reload (Meldungen können verloren sein, alles neu laden),
+// die Daten sind das Ereignis als JSON.
+func StreamEvents(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	schema, tableName := r.URL.Query().Get("schema"), r.URL.Query().Get("table")
+	annotate(r, "events", schema, tableName)
+	if Events == nil {
+		writeError(w, r, newError(http.StatusNotFound, CodeNotFound, "Change events are disabled"))
+		return
+	}
+	switch {
+	case tableName != "":
+		if _, err := resolveTable(r.Context(), db, schema, tableName); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	case schema != "" && !schemaVisible(schema):
+		writeError(w, r, newError(http.StatusNotFound, CodeNotFound, "Schema not found"))
+		return
+	}
+	matches := func(e events.Event) bool {
+		if e.Type == events.Reload {
+			return true
+		}
+		return schemaVisible(e.Schema) && (schema == "" || e.Schema == schema) && (tableName == "" || e.Table == tableName)
+	}
+
+	// Der Stream läuft länger als Read- und WriteTimeout des Servers
+	rc := http.NewResponseController(w)
+	for _, err := range []error{rc.SetReadDeadline(time.Time{}), rc.SetWriteDeadline(time.Time{})} {
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			writeError(w, r, fmt.Errorf("failed to clear deadline: %w", err))
+			return
+		}
+	}
+
+	changes, unsubscribe := Events.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx puffert den Stream sonst
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if err := rc.Flush(); err != nil {
+		middleware.Logger(r.Context()).Warn("Event stream cannot be flushed", "error", err)
+		return
+	}
+
+	keepAlive := time.NewTicker(EventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-changes:
+			if !ok {
+				// Zu langsam oder Server fährt herunter; der Browser verbindet sich neu
+				return
+			}
+			if !matches(e) {
+				continue
+			}
+			data, _ := json.Marshal(e)
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
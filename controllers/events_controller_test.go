@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"wuffnetCMS/events"
+	"wuffnetCMS/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// Gemeldet wird der Schlüssel aus RETURNING, nicht der aus der Anfrage; nur dann fasst Postgres
+// die Meldung mit der gleichlautenden des Triggers notify_change zusammen
+func TestDeleteRecordNotifiesStoredKey(t *testing.T) {
+	useCatalog(t, []models.Table{{Schema: "public", Name: "posts", PrimaryKey: "id", Columns: []models.Column{{Name: "id", DataType: "integer"}}}})
+	defer func(broker *events.Broker) { Events = broker }(Events)
+	Events = events.NewBroker()
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM "public"."posts" WHERE "id" = $1 RETURNING "id"`)).WithArgs("007").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_notify($1`)).WithArgs(events.Channel, opDelete, "public", "posts", "7").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	// Nicht vorhandene Datensätze werden nicht gemeldet
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM "public"."posts"`)).WithArgs("8").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+
+	ctx := context.Background()
+	if affected, err := deleteRecord(ctx, db, DeleteRequest{Schema: "public", Table: "posts", PrimaryKey: "id", PrimaryKeyValue: "007"}); affected != 1 || err != nil {
+		t.Errorf("deleteRecord = %d, %v", affected, err)
+	}
+	if affected, err := deleteRecord(ctx, db, DeleteRequest{Schema: "public", Table: "posts", PrimaryKey: "id", PrimaryKeyValue: "8"}); affected != 0 || err != nil {
+		t.Errorf("missing record: deleteRecord = %d, %v", affected, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,588 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"wuffnetCMS/auth"
+	"wuffnetCMS/metrics"
+	"wuffnetCMS/middleware"
+	"wuffnetCMS/models"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+const (
+	graphQLDefaultLimit = 100
+	graphQLMaxLimit     = 1000
+)
+
+// GraphQL-Namen dürfen nur Buchstaben, Ziffern und Unterstriche enthalten
+var graphQLNameCleaner = regexp.MustCompile(`[^_0-9A-Za-z]`)
+
+// GraphQL beantwortet Anfragen gegen ein aus dem Datenbankkatalog erzeugtes Schema
+func GraphQL(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		params.Query = r.URL.Query().Get("query")
+		params.OperationName = r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &params.Variables); err != nil {
+				writeError(w, r, badRequest("Invalid variables"))
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			writeError(w, r, badRequest("Invalid input"))
+			return
+		}
+	default:
+		writeError(w, r, errMethodNotAllowed)
+		return
+	}
+
+	annotate(r, "graphql", "", "")
+	if params.OperationName != "" {
+		middleware.Annotate(r.Context(), "graphql_operation", params.OperationName)
+	}
+
+	if params.Query == "" {
+		writeError(w, r, badRequest("Query missing"))
+		return
+	}
+	// GET ist von der CSRF-Prüfung ausgenommen und das Sitzungs-Cookie wird auch bei Links mitgeschickt
+	if r.Method != http.MethodPost && hasGraphQLMutation(params.Query) {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, r, newError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Mutations require POST"))
+		return
+	}
+
+	// Resolver und Mutationen nutzen eigene Transaktionen, daher gilt das Limit hier für die ganze Anfrage
+	ctx := r.Context()
+	if timeout := statementTimeout(EndpointGraphQL); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	tables, err := LoadCatalog(ctx, db)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error reading catalog: %w", err))
+		return
+	}
+	schema, err := cachedGraphQLSchema(db, tables)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error building GraphQL schema: %w", err))
+		return
+	}
+
+	start := time.Now()
+	result := graphql.Do(graphql.Params{
+		Schema:         schema,
+		RequestString:  params.Query,
+		OperationName:  params.OperationName,
+		VariableValues: params.Variables,
+		Context:        ctx,
+	})
+	var resultErr error
+	if result.HasErrors() {
+		resultErr = result.Errors[0]
+	}
+	metrics.ObserveQuery(EndpointGraphQL, time.Since(start), resultErr)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		middleware.Logger(r.Context()).Warn("Failed to encode JSON response", "error", err)
+	}
+}
+
+// Das Schema wird nur neu erzeugt, wenn LoadCatalog einen neu gelesenen Katalog liefert
+var graphQLSchemaCache struct {
+	mu     sync.Mutex
+	db     *sql.DB
+	tables []models.Table // Katalogstand, aus dem schema erzeugt wurde
+	schema graphql.Schema
+}
+
+// cachedGraphQLSchema liefert das Schema zum Katalogstand tables; LoadCatalog gibt bis zum nächsten
+// Neuladen dieselbe Slice zurück, daher genügt der Vergleich des ersten Elements
+func cachedGraphQLSchema(db *sql.DB, tables []models.Table) (graphql.Schema, error) {
+	cache := &graphQLSchemaCache
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.db == db && len(tables) > 0 && len(cache.tables) == len(tables) && &cache.tables[0] == &tables[0] {
+		return cache.schema, nil
+	}
+	schema, err := buildGraphQLSchema(db, tables)
+	if err != nil {
+		return graphql.Schema{}, err
+	}
+	cache.db, cache.tables, cache.schema = db, tables, schema
+	return schema, nil
+}
+
+// hasGraphQLMutation prüft, ob das Dokument eine Mutation enthält; Syntaxfehler meldet später graphql.Do
+func hasGraphQLMutation(query string) bool {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return false
+	}
+	for _, def := range doc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok && op.Operation == ast.OperationTypeMutation {
+			return true
+		}
+	}
+	return false
+}
+
+// graphQLTable verbindet eine Katalogtabelle mit ihren erzeugten GraphQL-Typen
+type graphQLTable struct {
+	table  *models.Table
+	name   string
+	object *graphql.Object
+	where  *graphql.InputObject
+	input  *graphql.InputObject
+	// GraphQL-Feldname je Spalte, in der Reihenfolge von table.Columns
+	columns []string
+	// GraphQL-Feldname -> Spaltenname für Filter und Eingaben
+	fields map[string]string
+}
+
+// Aus dem Tabellennamen abgeleitete Typ- und Feldnamen; sie müssen alle frei sein
+var graphQLTableSuffixes = []string{"", "_count", "_by_pk", "_where", "_input"}
+
+// graphQLRelation beschreibt einen Fremdschlüssel zwischen zwei erzeugten Typen
+type graphQLRelation struct {
+	from   *graphQLTable
+	column models.Column
+	to     *graphQLTable
+}
+
+func buildGraphQLSchema(db *sql.DB, tables []models.Table) (graphql.Schema, error) {
+	byName := map[string]*graphQLTable{}
+	var gqlTables []*graphQLTable
+
+	typeNames := map[string]bool{"Query": true, "Mutation": true}
+	typeTaken := func(name string) bool {
+		for _, suffix := range graphQLTableSuffixes {
+			if typeNames[name+suffix] {
+				return true
+			}
+		}
+		return false
+	}
+	for i := range tables {
+		table := &tables[i]
+		gt := &graphQLTable{table: table, name: uniqueGraphQLName(graphQLName(table.Schema+"_"+table.Name), typeTaken), fields: map[string]string{}}
+		for _, suffix := range graphQLTableSuffixes {
+			typeNames[gt.name+suffix] = true
+		}
+		for _, col := range table.Columns {
+			fieldName := uniqueGraphQLName(graphQLName(col.Name), func(name string) bool {
+				_, exists := gt.fields[name]
+				return exists
+			})
+			gt.columns = append(gt.columns, fieldName)
+			gt.fields[fieldName] = col.Name
+		}
+		byName[table.Schema+"."+table.Name] = gt
+		gqlTables = append(gqlTables, gt)
+	}
+
+	// Fremdschlüssel in beide Richtungen sammeln
+	outgoing := map[*graphQLTable][]graphQLRelation{}
+	incoming := map[*graphQLTable][]graphQLRelation{}
+	for _, gt := range gqlTables {
+		for _, col := range gt.table.Columns {
+			if col.References == nil {
+				continue
+			}
+			target, ok := byName[col.References.Schema+"."+col.References.Table]
+			if !ok {
+				continue
+			}
+			rel := graphQLRelation{from: gt, column: col, to: target}
+			outgoing[gt] = append(outgoing[gt], rel)
+			incoming[target] = append(incoming[target], rel)
+		}
+	}
+
+	for _, gt := range gqlTables {
+		gt := gt
+		gt.object = graphql.NewObject(graphql.ObjectConfig{
+			Name:        gt.name,
+			Description: fmt.Sprintf("Datensatz aus %s.%s", gt.table.Schema, gt.table.Name),
+			Fields: graphql.FieldsThunk(func() graphql.Fields {
+				fields := graphql.Fields{}
+				for i, col := range gt.table.Columns {
+					fields[gt.columns[i]] = columnField(*gt.table, col)
+				}
+				for _, rel := range outgoing[gt] {
+					fields[uniqueFieldName(fields, forwardRelationName(rel.column.Name))] = forwardRelationField(db, rel)
+				}
+				for _, rel := range incoming[gt] {
+					fields[uniqueFieldName(fields, graphQLName(rel.from.table.Name+"_by_"+rel.column.Name))] = reverseRelationField(db, rel)
+				}
+				return fields
+			}),
+		})
+
+		whereFields := graphql.InputObjectConfigFieldMap{}
+		inputFields := graphql.InputObjectConfigFieldMap{}
+		for i, col := range gt.table.Columns {
+			whereFields[gt.columns[i]] = &graphql.InputObjectFieldConfig{
+				Type:        graphql.String,
+				Description: "Exakter Vergleich auf den Textwert der Spalte",
+			}
+			inputFields[gt.columns[i]] = &graphql.InputObjectFieldConfig{Type: graphQLScalar(*gt.table, col)}
+		}
+		gt.where = graphql.NewInputObject(graphql.InputObjectConfig{Name: gt.name + "_where", Fields: whereFields})
+		gt.input = graphql.NewInputObject(graphql.InputObjectConfig{Name: gt.name + "_input", Fields: inputFields})
+	}
+
+	queryFields := graphql.Fields{}
+	mutationFields := graphql.Fields{}
+	for _, gt := range gqlTables {
+		gt := gt
+		queryFields[gt.name] = &graphql.Field{
+			Type: graphql.NewList(gt.object),
+			Args: listArgs(gt),
+			Resolve: gqlResolve(func(p graphql.ResolveParams) (interface{}, error) {
+				return selectRows(p.Context, db, gt, p.Args, "", nil)
+			}),
+		}
+		queryFields[gt.name+"_count"] = &graphql.Field{
+			Type: graphql.Int,
+			Args: graphql.FieldConfigArgument{
+				"filter": &graphql.ArgumentConfig{Type: graphql.String},
+				"where":  &graphql.ArgumentConfig{Type: gt.where},
+			},
+			Resolve: gqlResolve(func(p graphql.ResolveParams) (interface{}, error) {
+				return countRows(p.Context, db, gt, p.Args)
+			}),
+		}
+
+		// Ohne Primärschlüssel gibt es weder Einzelabfrage noch Mutationen
+		if gt.table.PrimaryKey == "" {
+			continue
+		}
+		primaryKey := gt.table.PrimaryKey
+
+		queryFields[gt.name+"_by_pk"] = &graphql.Field{
+			Type: gt.object,
+			Args: graphql.FieldConfigArgument{
+				"pk": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+			},
+			Resolve: gqlResolve(func(p graphql.ResolveParams) (interface{}, error) {
+				return selectOne(p.Context, db, gt.table, gt.table.Column(primaryKey), p.Args["pk"])
+			}),
+		}
+
+		mutationFields["save_"+gt.name] = &graphql.Field{
+			Type:        gt.object,
+			Description: "Legt einen Datensatz an oder aktualisiert ihn, wenn der Primärschlüssel gesetzt ist; bei Tabellen mit Freigabe-Workflow als Entwurf",
+			Args: graphql.FieldConfigArgument{
+				"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(gt.input)},
+			},
+			Resolve: gqlResolve(func(p graphql.ResolveParams) (interface{}, error) {
+				if !auth.Allowed(p.Context, auth.ScopeWrite) {
+					return nil, forbidden(auth.ScopeWrite)
+				}
+				input, _ := p.Args["input"].(map[string]interface{})
+				data := SaveRequest{Schema: gt.table.Schema, Table: gt.table.Name, PrimaryKey: primaryKey}
+				for fieldName, value := range input {
+					data.Columns = append(data.Columns, RecordColumn{Name: gt.fields[fieldName], Value: value})
+				}
+				draft, err := saveRecord(p.Context, db, &data, saveAuto)
+				if err != nil {
+					return nil, err
+				}
+				if draft != nil {
+					return draftRecord(p.Context, db, gt.table, draft)
+				}
+
+				// Gespeicherten Datensatz vollständig neu laden
+				for _, col := range data.Columns {
+					if col.Name == primaryKey {
+						return selectOne(p.Context, db, gt.table, gt.table.Column(primaryKey), col.Value)
+					}
+				}
+				return nil, nil
+			}),
+		}
+
+		mutationFields["delete_"+gt.name] = &graphql.Field{
+			Type: graphql.Boolean,
+			Args: graphql.FieldConfigArgument{
+				"pk": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+			},
+			Resolve: gqlResolve(func(p graphql.ResolveParams) (interface{}, error) {
+				if !auth.Allowed(p.Context, auth.ScopeDelete) {
+					return nil, forbidden(auth.ScopeDelete)
+				}
+				affected, err := deleteRecord(p.Context, db, DeleteRequest{
+					Schema:          gt.table.Schema,
+					Table:           gt.table.Name,
+					PrimaryKey:      primaryKey,
+					PrimaryKeyValue: p.Args["pk"],
+				})
+				if err != nil {
+					return nil, err
+				}
+				return affected > 0, nil
+			}),
+		}
+	}
+
+	config := graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: queryFields}),
+	}
+	if len(mutationFields) > 0 {
+		config.Mutation = graphql.NewObject(graphql.ObjectConfig{Name: "Mutation", Fields: mutationFields})
+	}
+	return graphql.NewSchema(config)
+}
+
+// gqlResolve übersetzt Fehler eines Resolvers wie writeError, damit keine Datenbankdetails nach außen gelangen
+func gqlResolve(resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		result, err := resolve(p)
+		if err != nil {
+			apiErr := toAPIError(err)
+			logError(p.Context, fmt.Errorf("resolving %s: %w", p.Info.FieldName, err), apiErr)
+			return nil, apiErr
+		}
+		return result, nil
+	}
+}
+
+func listArgs(gt *graphQLTable) graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"filter":   &graphql.ArgumentConfig{Type: graphql.String, Description: "Suchbegriff über alle Spalten (ILIKE)"},
+		"where":    &graphql.ArgumentConfig{Type: gt.where},
+		"order_by": &graphql.ArgumentConfig{Type: graphql.String},
+		"order":    &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: "asc"},
+		"limit":    &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: graphQLDefaultLimit},
+		"offset":   &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+	}
+}
+
+// columnField liefert das Feld für eine Spalte, gelesen aus der von scanRows erzeugten Map
+func columnField(table models.Table, col models.Column) *graphql.Field {
+	name := col.Name
+	return &graphql.Field{
+		Type: graphQLScalar(table, col),
+		Resolve: gqlResolve(func(p graphql.ResolveParams) (interface{}, error) {
+			row, _ := p.Source.(map[string]interface{})
+			if raw, ok := row[name].([]byte); ok {
+				return string(raw), nil
+			}
+			return row[name], nil
+		}),
+	}
+}
+
+func forwardRelationField(db *sql.DB, rel graphQLRelation) *graphql.Field {
+	return &graphql.Field{
+		Type:        rel.to.object,
+		Description: fmt.Sprintf("Referenzierter Datensatz über %s", rel.column.Name),
+		Resolve: gqlResolve(func(p graphql.ResolveParams) (interface{}, error) {
+			row, _ := p.Source.(map[string]interface{})
+			value := row[rel.column.Name]
+			if value == nil {
+				return nil, nil
+			}
+			return selectOne(p.Context, db, rel.to.table, rel.to.table.Column(rel.column.References.Column), value)
+		}),
+	}
+}
+
+func reverseRelationField(db *sql.DB, rel graphQLRelation) *graphql.Field {
+	return &graphql.Field{
+		Type:        graphql.NewList(rel.from.object),
+		Description: fmt.Sprintf("Datensätze aus %s.%s, die über %s hierher verweisen", rel.from.table.Schema, rel.from.table.Name, rel.column.Name),
+		Args:        listArgs(rel.from),
+		Resolve: gqlResolve(func(p graphql.ResolveParams) (interface{}, error) {
+			row, _ := p.Source.(map[string]interface{})
+			value := row[rel.column.References.Column]
+			if value == nil {
+				return []map[string]interface{}{}, nil
+			}
+			return selectRows(p.Context, db, rel.from, p.Args, rel.column.Name, value)
+		}),
+	}
+}
+
+// selectRows liest Datensätze mit Filter, Sortierung und Paging; parentColumn schränkt optional auf einen Fremdschlüssel ein
+func selectRows(ctx context.Context, db Queryer, gt *graphQLTable, args map[string]interface{}, parentColumn string, parentValue interface{}) ([]map[string]interface{}, error) {
+	query := &sqlBuilder{}
+	query.SQL("SELECT * FROM ").Table(gt.table)
+	if err := graphQLWhere(query, gt, args, parentColumn, parentValue); err != nil {
+		return nil, err
+	}
+
+	if orderBy, _ := args["order_by"].(string); orderBy != "" {
+		column, err := graphQLColumn(gt, orderBy)
+		if err != nil {
+			return nil, err
+		}
+		order, _ := args["order"].(string)
+		query.SQL(" ORDER BY ").Column(column).Order(order)
+	}
+
+	limit, _ := args["limit"].(int)
+	if limit <= 0 || limit > graphQLMaxLimit {
+		limit = graphQLDefaultLimit
+	}
+	offset, _ := args["offset"].(int)
+	if offset < 0 {
+		offset = 0
+	}
+	query.SQL(" LIMIT ").Arg(limit).SQL(" OFFSET ").Arg(offset)
+
+	rows, err := db.QueryContext(ctx, query.String(), query.Args()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch table content: %w", err)
+	}
+	defer rows.Close()
+	return scanRows(rows)
+}
+
+func countRows(ctx context.Context, db Queryer, gt *graphQLTable, args map[string]interface{}) (int, error) {
+	query := &sqlBuilder{}
+	query.SQL("SELECT COUNT(*) FROM ").Table(gt.table)
+	if err := graphQLWhere(query, gt, args, "", nil); err != nil {
+		return 0, err
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, query.String(), query.Args()...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting rows: %w", err)
+	}
+	return count, nil
+}
+
+// graphQLColumn löst einen GraphQL-Feldnamen in die Katalogspalte auf
+func graphQLColumn(gt *graphQLTable, fieldName string) (*models.Column, error) {
+	name, ok := gt.fields[fieldName]
+	if !ok {
+		return nil, newError(http.StatusBadRequest, CodeUnknownColumn, fmt.Sprintf("Unknown column: %s", fieldName))
+	}
+	return resolveColumn(gt.table, name)
+}
+
+// graphQLWhere hängt die WHERE-Klausel aus Suchbegriff, exakten Vergleichen und optionaler Relation an
+func graphQLWhere(query *sqlBuilder, gt *graphQLTable, args map[string]interface{}, parentColumn string, parentValue interface{}) error {
+	conditions := 0
+	and := func() *sqlBuilder {
+		if conditions++; conditions == 1 {
+			return query.SQL(" WHERE ")
+		}
+		return query.SQL(" AND ")
+	}
+
+	if parentColumn != "" {
+		column, err := resolveColumn(gt.table, parentColumn)
+		if err != nil {
+			return err
+		}
+		and().Column(column).SQL(" = ").Arg(parentValue)
+	}
+
+	if where, ok := args["where"].(map[string]interface{}); ok {
+		for fieldName, value := range where {
+			column, err := graphQLColumn(gt, fieldName)
+			if err != nil {
+				return err
+			}
+			if value == nil {
+				and().Column(column).SQL(" IS NULL")
+				continue
+			}
+			and().SQL("CAST(").Column(column).SQL(" AS TEXT) = ").Arg(value)
+		}
+	}
+
+	if search, _ := args["filter"].(string); search != "" && len(gt.table.Columns) > 0 {
+		and().SQL("(")
+		for i := range gt.table.Columns {
+			if i > 0 {
+				query.SQL(" OR ")
+			}
+			query.SQL("CAST(").Column(&gt.table.Columns[i]).SQL(" AS TEXT) ILIKE ").Arg("%" + search + "%")
+		}
+		query.SQL(")")
+	}
+	return nil
+}
+
+// graphQLScalar bildet PostgreSQL-Datentypen auf GraphQL-Skalare ab
+func graphQLScalar(table models.Table, col models.Column) *graphql.Scalar {
+	if col.Name == table.PrimaryKey {
+		return graphql.ID
+	}
+	switch strings.ToLower(col.DataType) {
+	case "smallint", "integer":
+		return graphql.Int
+	case "real", "double precision", "numeric":
+		return graphql.Float
+	case "boolean":
+		return graphql.Boolean
+	default:
+		// bigint wird als String geliefert, da GraphQL-Int nur 32 Bit umfasst
+		return graphql.String
+	}
+}
+
+func graphQLName(name string) string {
+	name = graphQLNameCleaner.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') || strings.HasPrefix(name, "__") {
+		name = "t_" + name
+	}
+	return name
+}
+
+// forwardRelationName leitet aus author_id den Feldnamen author ab
+func forwardRelationName(column string) string {
+	if trimmed := strings.TrimSuffix(column, "_id"); trimmed != column && trimmed != "" {
+		return graphQLName(trimmed)
+	}
+	return graphQLName(column + "_ref")
+}
+
+// uniqueGraphQLName hängt _2, _3 … an, solange taken den Namen kennt; graphQLName bildet verschiedene
+// Namen auf denselben ab (Schema a_b mit Tabelle c und Schema a mit Tabelle b_c, "first name" und first_name)
+func uniqueGraphQLName(name string, taken func(string) bool) string {
+	if !taken(name) {
+		return name
+	}
+	for i := 2; ; i++ {
+		if candidate := fmt.Sprintf("%s_%d", name, i); !taken(candidate) {
+			return candidate
+		}
+	}
+}
+
+func uniqueFieldName(fields graphql.Fields, name string) string {
+	for {
+		if _, exists := fields[name]; !exists {
+			return name
+		}
+		name += "_rel"
+	}
+}
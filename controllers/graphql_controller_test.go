@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"testing"
+	"wuffnetCMS/auth"
+	"wuffnetCMS/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/graphql-go/graphql"
+)
+
+// graphQLFixture ist ein Katalog aus Autoren und Beiträgen mit Fremdschlüssel posts.author_id
+func graphQLFixture() []models.Table {
+	return []models.Table{
+		{Schema: "public", Name: "authors", PrimaryKey: "id", Columns: []models.Column{
+			{Name: "id", DataType: "integer", HasDefault: true},
+			{Name: "name", DataType: "text"},
+		}},
+		{Schema: "public", Name: "posts", PrimaryKey: "id", Columns: []models.Column{
+			{Name: "id", DataType: "integer", HasDefault: true},
+			{Name: "title", DataType: "text"},
+			{Name: "author_id", DataType: "integer", IsNullable: true, References: &models.ForeignKey{Schema: "public", Table: "authors", Column: "id"}},
+		}},
+	}
+}
+
+// mockGraphQLSchema baut das Schema gegen eine Mock-Datenbank; offene Erwartungen lassen den Test fehlschlagen
+func mockGraphQLSchema(t *testing.T, tables []models.Table) (graphql.Schema, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	schema, err := buildGraphQLSchema(db, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema, mock
+}
+
+// resultJSON vergleicht Daten unabhängig von den Go-Typen, die graphql.Do liefert
+func resultJSON(t *testing.T, result *graphql.Result) string {
+	t.Helper()
+	if result.HasErrors() {
+		t.Fatalf("errors: %v", result.Errors)
+	}
+	data, err := json.Marshal(result.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// Mutationen per GET umgingen die CSRF-Prüfung; sie werden vor jedem Datenbankzugriff abgewiesen
+func TestGraphQLRejectsMutationOverGet(t *testing.T) {
+	for _, query := range []string{
+		`mutation { delete_public_posts(id: "1") }`,
+		`query q { public_posts { id } } mutation m { delete_public_posts(id: "1") }`,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/graphql?query="+url.QueryEscape(query), nil)
+		rec := httptest.NewRecorder()
+		GraphQL(nil, rec, r)
+		if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != http.MethodPost {
+			t.Errorf("%s: status = %d, Allow %q", query, rec.Code, rec.Header().Get("Allow"))
+		}
+	}
+	if hasGraphQLMutation(`{ public_posts { id } }`) || hasGraphQLMutation(`query { mutation`) {
+		t.Error("query without mutation rejected")
+	}
+}
+
+// Verschiedene Katalognamen können nach graphQLName gleich lauten; das Schema muss sich trotzdem bauen lassen
+func TestBuildGraphQLSchemaNameCollisions(t *testing.T) {
+	tables := []models.Table{
+		{Schema: "a_b", Name: "c", PrimaryKey: "id", Columns: []models.Column{{Name: "id", DataType: "integer"}}},
+		{Schema: "a", Name: "b_c", PrimaryKey: "id", Columns: []models.Column{
+			{Name: "id", DataType: "integer"},
+			{Name: "first name", DataType: "text"},
+			{Name: "first_name", DataType: "text"},
+		}},
+		{Schema: "a", Name: "b_c_count", Columns: []models.Column{{Name: "n", DataType: "integer"}}},
+	}
+	schema, err := buildGraphQLSchema(nil, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a_b_c", "a_b_c_2", "a_b_c_2_where", "a_b_c_count_2"} {
+		if schema.Type(name) == nil {
+			t.Errorf("type %s missing", name)
+		}
+	}
+	fields := schema.Type("a_b_c_2").(*graphql.Object).Fields()
+	if fields["first_name"] == nil || fields["first_name_2"] == nil {
+		t.Errorf("fields = %v", slices.Sorted(maps.Keys(fields)))
+	}
+	query := schema.QueryType().Fields()
+	for _, name := range []string{"a_b_c", "a_b_c_count", "a_b_c_2", "a_b_c_2_by_pk", "a_b_c_count_2"} {
+		if query[name] == nil {
+			t.Errorf("query field %s missing", name)
+		}
+	}
+}
+
+func TestCachedGraphQLSchema(t *testing.T) {
+	tables := []models.Table{{Schema: "public", Name: "posts", PrimaryKey: "id", Columns: []models.Column{{Name: "id", DataType: "integer"}}}}
+	first, err := cachedGraphQLSchema(nil, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := cachedGraphQLSchema(nil, tables); again.QueryType() != first.QueryType() {
+		t.Error("schema rebuilt for the same catalog")
+	}
+	// Neu gelesener Katalog mit gleichem Inhalt
+	reloaded, _ := cachedGraphQLSchema(nil, slices.Clone(tables))
+	if reloaded.QueryType() == first.QueryType() {
+		t.Error("schema not rebuilt after catalog reload")
+	}
+}
+
+func TestGraphQLSchemaGeneration(t *testing.T) {
+	schema, mock := mockGraphQLSchema(t, graphQLFixture())
+
+	fieldNames := func(typeName string) []string {
+		return slices.Sorted(maps.Keys(schema.Type(typeName).(*graphql.Object).Fields()))
+	}
+	if got, want := fieldNames("public_posts"), []string{"author", "author_id", "id", "title"}; !slices.Equal(got, want) {
+		t.Errorf("public_posts fields = %v, want %v", got, want)
+	}
+	if got, want := fieldNames("public_authors"), []string{"id", "name", "posts_by_author_id"}; !slices.Equal(got, want) {
+		t.Errorf("public_authors fields = %v, want %v", got, want)
+	}
+	where := slices.Sorted(maps.Keys(schema.Type("public_posts_where").(*graphql.InputObject).Fields()))
+	if want := []string{"author_id", "id", "title"}; !slices.Equal(where, want) {
+		t.Errorf("public_posts_where fields = %v, want %v", where, want)
+	}
+	var args []string
+	for _, arg := range schema.QueryType().Fields()["public_posts"].Args {
+		args = append(args, arg.Name())
+	}
+	if want := []string{"filter", "limit", "offset", "order", "order_by", "where"}; !slices.Equal(slices.Sorted(slices.Values(args)), want) {
+		t.Errorf("list arguments = %v, want %v", args, want)
+	}
+	for _, name := range []string{"save_public_posts", "delete_public_posts", "save_public_authors", "delete_public_authors"} {
+		if schema.MutationType().Fields()[name] == nil {
+			t.Errorf("mutation %s missing", name)
+		}
+	}
+
+	t.Run("filter, order and limit with forward relation", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT * FROM "public"."posts" WHERE CAST("title" AS TEXT) = $1 AND (CAST("id" AS TEXT) ILIKE $2 OR CAST("title" AS TEXT) ILIKE $3 OR CAST("author_id" AS TEXT) ILIKE $4) ORDER BY "title" DESC LIMIT $5 OFFSET $6`).
+			WithArgs("Hello", "%ell%", "%ell%", "%ell%", graphQLDefaultLimit, 0).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title", "author_id"}).AddRow(1, "Hello", 7))
+		mock.ExpectQuery(`SELECT * FROM "public"."authors" WHERE "id" = $1 LIMIT 1`).WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(7, "Ada"))
+
+		// Zu große Limits und negative Offsets werden auf die Vorgaben zurückgesetzt
+		result := graphql.Do(graphql.Params{Schema: schema, Context: context.Background(), RequestString: `{
+			public_posts(where: {title: "Hello"}, filter: "ell", order_by: "title", order: "desc", limit: 5000, offset: -3) {
+				id title author { name }
+			}
+		}`})
+		if got, want := resultJSON(t, result), `{"public_posts":[{"author":{"name":"Ada"},"id":"1","title":"Hello"}]}`; got != want {
+			t.Errorf("data = %s, want %s", got, want)
+		}
+	})
+
+	t.Run("reverse relation with paging", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT * FROM "public"."authors" WHERE "id" = $1 LIMIT 1`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(7, "Ada"))
+		mock.ExpectQuery(`SELECT * FROM "public"."posts" WHERE "author_id" = $1 LIMIT $2 OFFSET $3`).WithArgs(7, 2, 4).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title", "author_id"}).AddRow(5, "Later", 7))
+
+		result := graphql.Do(graphql.Params{Schema: schema, Context: context.Background(), RequestString: `{
+			public_authors_by_pk(pk: "7") { name posts_by_author_id(limit: 2, offset: 4) { title } }
+		}`})
+		if got, want := resultJSON(t, result), `{"public_authors_by_pk":{"name":"Ada","posts_by_author_id":[{"title":"Later"}]}}`; got != want {
+			t.Errorf("data = %s, want %s", got, want)
+		}
+	})
+
+	// Felder derselben Ebene führt graphql-go in beliebiger Reihenfolge aus, daher eine eigene Anfrage
+	t.Run("count with where", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT COUNT(*) FROM "public"."posts" WHERE CAST("author_id" AS TEXT) = $1`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+		result := graphql.Do(graphql.Params{Schema: schema, Context: context.Background(), RequestString: `{ public_posts_count(where: {author_id: "7"}) }`})
+		if got, want := resultJSON(t, result), `{"public_posts_count":3}`; got != want {
+			t.Errorf("data = %s, want %s", got, want)
+		}
+	})
+
+	t.Run("unknown sort column", func(t *testing.T) {
+		result := graphql.Do(graphql.Params{Schema: schema, Context: context.Background(), RequestString: `{ public_posts(order_by: "secret") { id } }`})
+		if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != CodeUnknownColumn {
+			t.Errorf("errors = %v", result.Errors)
+		}
+	})
+}
+
+// Mutationen prüfen den Scope selbst, weil /graphql nur read verlangt
+func TestGraphQLMutationRequiresScope(t *testing.T) {
+	schema, _ := mockGraphQLSchema(t, graphQLFixture())
+	ctx := auth.NewContext(context.Background(), &auth.Principal{UserID: 42, Name: "alice", Scopes: []string{auth.ScopeRead}})
+
+	result := graphql.Do(graphql.Params{Schema: schema, Context: ctx, RequestString: `mutation {
+		save_public_posts(input: {title: "Hello"}) { id }
+		delete_public_posts(pk: "1")
+	}`})
+	var codes []interface{}
+	for _, err := range result.Errors {
+		codes = append(codes, err.Extensions["code"])
+	}
+	if !reflect.DeepEqual(codes, []interface{}{CodeForbidden, CodeForbidden}) {
+		t.Errorf("errors = %v", result.Errors)
+	}
+}
+
+// Validierungsfehler aus saveRecord erscheinen mit Code und Feldern als GraphQL-Fehler
+func TestGraphQLSaveValidationError(t *testing.T) {
+	tables := graphQLFixture()
+	useCatalog(t, tables)
+
+	schema, mock := mockGraphQLSchema(t, tables)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS (SELECT 1 FROM "cms"."workflow_tables" WHERE table_schema = $1 AND table_name = $2)`).
+		WithArgs("public", "posts").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(`SELECT column_name, rule, COALESCE(argument, ''), COALESCE(message, '') FROM "cms"."column_rules" WHERE table_schema = $1 AND table_name = $2 ORDER BY id`).
+		WithArgs("public", "posts").WillReturnRows(sqlmock.NewRows([]string{"column_name", "rule", "argument", "message"}))
+	mock.ExpectRollback()
+
+	result := graphql.Do(graphql.Params{Schema: schema, Context: context.Background(), RequestString: `mutation {
+		save_public_posts(input: {author_id: 7}) { id }
+	}`})
+	if len(result.Errors) != 1 {
+		t.Fatalf("errors = %v", result.Errors)
+	}
+	err := result.Errors[0]
+	fields, _ := err.Extensions["fields"].([]FieldError)
+	if err.Message != "Validation failed" || err.Extensions["code"] != CodeValidation ||
+		!reflect.DeepEqual(fields, []FieldError{{Field: "title", Code: CodeRequired, Message: "Value is required"}}) {
+		t.Errorf("error = %q %v", err.Message, err.Extensions)
+	}
+}
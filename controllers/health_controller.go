@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+	"wuffnetCMS/middleware"
+	"wuffnetCMS/migrations"
+)
+
+// Obergrenze für die Prüfungen in Readyz, damit Orchestrierungs-Proben nicht hängen
+const readinessTimeout = 2 * time.Second
+
+// Healthz meldet nur, dass der Prozess läuft und Anfragen annimmt (Liveness)
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readyz prüft, ob die Datenbank erreichbar ist und alle Migrationen angewendet sind (Readiness)
+func Readyz(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := map[string]string{"database": "ok", "migrations": "ok"}
+	status := http.StatusOK
+
+	if err := db.PingContext(ctx); err != nil {
+		middleware.Logger(r.Context()).Warn("Readiness check failed", "check", "database", "error", err)
+		checks["database"] = "unreachable"
+		checks["migrations"] = "unknown"
+		status = http.StatusServiceUnavailable
+	} else if pending, err := migrations.Pending(ctx, db, MetadataSchema); err != nil {
+		middleware.Logger(r.Context()).Warn("Readiness check failed", "check", "migrations", "error", err)
+		checks["migrations"] = "unknown"
+		status = http.StatusServiceUnavailable
+	} else if len(pending) > 0 {
+		checks["migrations"] = "pending"
+		status = http.StatusServiceUnavailable
+	}
+
+	state := "ok"
+	if status != http.StatusOK {
+		state = "unavailable"
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, map[string]interface{}{"status": state, "checks": checks})
+}
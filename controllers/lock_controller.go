@@ -0,0 +1,362 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"wuffnetCMS/auth"
+	"wuffnetCMS/middleware"
+	"wuffnetCMS/models"
+
+	"github.com/lib/pq"
+)
+
+// EditLockTTL bestimmt, wie lange eine Bearbeitungssperre ohne Heartbeat gilt
+var EditLockTTL = 2 * time.Minute
+
+// EditLock ist die Sperre eines Datensatzes, der gerade im Formular bearbeitet wird
+type EditLock struct {
+	Schema     string    `json:"schema"`
+	Table      string    `json:"table"`
+	RecordKey  string    `json:"recordKey"`
+	UserID     int64     `json:"userId"`
+	UserName   string    `json:"userName"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// Spalten von EditLock; l ist edit_locks, u der Benutzer
+const lockColumns = "l.table_schema, l.table_name, l.record_key, l.user_id, u.name, l.acquired_at, l.expires_at"
+
+func scanLock(row rowScanner) (*EditLock, error) {
+	var lock EditLock
+	if err := row.Scan(&lock.Schema, &lock.Table, &lock.RecordKey, &lock.UserID, &lock.UserName, &lock.AcquiredAt, &lock.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+// lockedError meldet, dass ein anderer Benutzer den Datensatz bearbeitet
+func lockedError(lock *EditLock) *APIError {
+	return newError(http.StatusConflict, CodeLocked, fmt.Sprintf("Record is being edited by %s.", lock.UserName))
+}
+
+// lockOwner liefert den angemeldeten Benutzer; ohne Anmeldung gibt es keine Bearbeitungssperren
+func lockOwner(r *http.Request) (*auth.Principal, error) {
+	p := auth.FromContext(r.Context())
+	if p == nil {
+		return nil, newError(http.StatusForbidden, CodeForbidden, "Edit locks require a signed-in user.")
+	}
+	return p, nil
+}
+
+// lockRequest löst {schema}/{table}/{pk} auf und liefert Tabelle und Schlüssel des Datensatzes in der Form
+// von recordKey, damit z. B. "007" und "7" dieselbe Sperre treffen. Für gelöschte Datensätze bleibt {pk} der Schlüssel.
+func lockRequest(db *sql.DB, w http.ResponseWriter, r *http.Request, operation string) (*models.Table, string, bool) {
+	annotate(r, operation, r.PathValue("schema"), r.PathValue("table"))
+	table, ok := resourceKeyTable(db, w, r)
+	if !ok {
+		return nil, "", false
+	}
+	key, found, err := lockedRecordKey(r.Context(), db, table, r.PathValue("pk"), "")
+	if err != nil {
+		writeError(w, r, err)
+		return nil, "", false
+	}
+	if !found {
+		key = r.PathValue("pk")
+	}
+	return table, key, true
+}
+
+// lockedRecordKey liest den Primärschlüssel eines Datensatzes und liefert ihn über recordKey.
+// lock (z. B. FOR SHARE) sperrt die Zeile bis zum Ende der Transaktion; found ist false, wenn es ihn nicht gibt.
+func lockedRecordKey(ctx context.Context, db Queryer, table *models.Table, value interface{}, lock string) (key string, found bool, err error) {
+	column := table.Column(table.PrimaryKey)
+	query := &sqlBuilder{}
+	query.SQL("SELECT ").Column(column).SQL(" FROM ").Table(table).SQL(" WHERE ").Column(column).SQL(" = ").Arg(value)
+	if lock != "" {
+		query.SQL(" " + lock)
+	}
+	rows, err := db.QueryContext(ctx, query.String(), query.Args()...)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to fetch record: %w", err)
+	}
+	defer rows.Close()
+	content, err := scanRows(rows)
+	if err != nil || len(content) == 0 {
+		return "", false, err
+	}
+	return recordKey(content[0][table.PrimaryKey]), true, nil
+}
+
+// activeLock liefert die gültige Sperre eines Datensatzes, nil wenn er frei ist
+func activeLock(ctx context.Context, db Queryer, table *models.Table, key string) (*EditLock, error) {
+	query := &sqlBuilder{}
+	query.SQL("SELECT " + lockColumns + " FROM ").MetaTable("edit_locks").SQL(" l JOIN ").MetaTable("users").SQL(" u ON u.id = l.user_id").
+		SQL(" WHERE l.table_schema = ").Arg(table.Schema).SQL(" AND l.table_name = ").Arg(table.Name).
+		SQL(" AND l.record_key = ").Arg(key).SQL(" AND l.expires_at > now()")
+	lock, err := scanLock(db.QueryRowContext(ctx, query.String(), query.Args()...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read edit lock: %w", err)
+	}
+	return lock, nil
+}
+
+// AcquireLock sperrt einen Datensatz für den angemeldeten Benutzer bis expiresAt.
+// Hält er die Sperre schon, wird sie verlängert; hält sie ein anderer, antwortet es mit 409 (locked).
+func AcquireLock(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	table, key, ok := lockRequest(db, w, r, "acquire_lock")
+	if !ok {
+		return
+	}
+	p, err := lockOwner(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var lock *EditLock
+	ctx := r.Context()
+	err = withStatementTimeout(ctx, db, EndpointSave, false, func(tx Queryer) error {
+		// Die geteilte Zeilensperre wartet auf laufende Speichervorgänge (siehe checkEditLock)
+		_, found, err := lockedRecordKey(ctx, tx, table, key, "FOR SHARE")
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errRecordNotFound
+		}
+
+		// Eine abgelaufene Sperre eines anderen wird übernommen, die eigene behält ihren Beginn
+		query := &sqlBuilder{}
+		query.SQL("WITH l AS (INSERT INTO ").MetaTable("edit_locks").SQL(" AS e (table_schema, table_name, record_key, user_id, expires_at) VALUES (").
+			Arg(table.Schema).SQL(", ").Arg(table.Name).SQL(", ").Arg(key).SQL(", ").Arg(p.UserID).
+			SQL(", now() + make_interval(secs => ").Arg(EditLockTTL.Seconds()).SQL("))").
+			SQL(" ON CONFLICT (table_schema, table_name, record_key) DO UPDATE SET expires_at = EXCLUDED.expires_at,").
+			SQL(" acquired_at = CASE WHEN e.user_id = EXCLUDED.user_id THEN e.acquired_at ELSE now() END, user_id = EXCLUDED.user_id").
+			SQL(" WHERE e.user_id = EXCLUDED.user_id OR e.expires_at <= now() RETURNING *)").
+			SQL(" SELECT " + lockColumns + " FROM l JOIN ").MetaTable("users").SQL(" u ON u.id = l.user_id")
+		lock, err = scanLock(tx.QueryRowContext(ctx, query.String(), query.Args()...))
+		if errors.Is(err, sql.ErrNoRows) {
+			holder, err := activeLock(ctx, tx, table, key)
+			if err != nil {
+				return err
+			}
+			if holder == nil {
+				// Zwischen INSERT und Abfrage freigegeben; der Client versucht es erneut
+				return newError(http.StatusConflict, CodeConflict, "Edit lock changed, please retry.")
+			}
+			return lockedError(holder)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to acquire edit lock: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lock)
+}
+
+// HeartbeatLock verlängert die eigene Sperre. Wurde sie freigegeben oder von einem Administrator aufgehoben,
+// antwortet es mit 409 (locked); der Client muss die Sperre dann neu anfordern.
+func HeartbeatLock(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	table, key, ok := lockRequest(db, w, r, "heartbeat_lock")
+	if !ok {
+		return
+	}
+	p, err := lockOwner(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var lock *EditLock
+	ctx := r.Context()
+	err = withStatementTimeout(ctx, db, EndpointSave, false, func(tx Queryer) error {
+		query := &sqlBuilder{}
+		query.SQL("WITH l AS (UPDATE ").MetaTable("edit_locks").
+			SQL(" SET expires_at = now() + make_interval(secs => ").Arg(EditLockTTL.Seconds()).SQL(")").
+			SQL(" WHERE table_schema = ").Arg(table.Schema).SQL(" AND table_name = ").Arg(table.Name).
+			SQL(" AND record_key = ").Arg(key).SQL(" AND user_id = ").Arg(p.UserID).SQL(" RETURNING *)").
+			SQL(" SELECT " + lockColumns + " FROM l JOIN ").MetaTable("users").SQL(" u ON u.id = l.user_id")
+		lock, err = scanLock(tx.QueryRowContext(ctx, query.String(), query.Args()...))
+		if errors.Is(err, sql.ErrNoRows) {
+			return newError(http.StatusConflict, CodeLocked, "Edit lock is no longer held.")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to extend edit lock: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lock)
+}
+
+// ReleaseLock gibt die eigene Sperre frei; ist sie schon frei, ist das kein Fehler
+func ReleaseLock(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	table, key, ok := lockRequest(db, w, r, "release_lock")
+	if !ok {
+		return
+	}
+	p, err := lockOwner(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	query := &sqlBuilder{}
+	query.SQL("DELETE FROM ").MetaTable("edit_locks").
+		SQL(" WHERE table_schema = ").Arg(table.Schema).SQL(" AND table_name = ").Arg(table.Name).
+		SQL(" AND record_key = ").Arg(key).SQL(" AND user_id = ").Arg(p.UserID)
+	if _, err := db.ExecContext(r.Context(), query.String(), query.Args()...); err != nil {
+		writeError(w, r, fmt.Errorf("failed to release edit lock: %w", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BreakLock hebt die Sperre eines anderen Benutzers auf (Scope admin), z. B. wenn er das Formular
+// offen gelassen hat; dessen nächster Heartbeat scheitert dann
+func BreakLock(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	table, key, ok := lockRequest(db, w, r, "break_lock")
+	if !ok {
+		return
+	}
+	query := &sqlBuilder{}
+	query.SQL("DELETE FROM ").MetaTable("edit_locks").
+		SQL(" WHERE table_schema = ").Arg(table.Schema).SQL(" AND table_name = ").Arg(table.Name).
+		SQL(" AND record_key = ").Arg(key).SQL(" RETURNING user_id")
+	var holder int64
+	err := db.QueryRowContext(r.Context(), query.String(), query.Args()...).Scan(&holder)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, newError(http.StatusNotFound, CodeNotFound, "Record is not locked"))
+		return
+	}
+	if err != nil {
+		writeError(w, r, fmt.Errorf("failed to break edit lock: %w", err))
+		return
+	}
+	middleware.Logger(r.Context()).Info("Edit lock broken", "record_key", key, "holder", holder)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListLocks liefert die gültigen Sperren, optional nach schema und table gefiltert
+func ListLocks(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	annotate(r, "list_locks", params.Get("schema"), params.Get("table"))
+	query := &sqlBuilder{}
+	query.SQL("SELECT " + lockColumns + " FROM ").MetaTable("edit_locks").SQL(" l JOIN ").MetaTable("users").SQL(" u ON u.id = l.user_id").
+		SQL(" WHERE l.expires_at > now()")
+	if err := filterSchema(query, "l.table_schema", params.Get("schema")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if table := params.Get("table"); table != "" {
+		query.SQL(" AND l.table_name = ").Arg(table)
+	}
+	query.SQL(" ORDER BY l.acquired_at")
+
+	locks := []*EditLock{}
+	ctx := r.Context()
+	err := withStatementTimeout(ctx, db, EndpointContent, true, func(tx Queryer) error {
+		rows, err := tx.QueryContext(ctx, query.String(), query.Args()...)
+		if err != nil {
+			return fmt.Errorf("failed to list edit locks: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			lock, err := scanLock(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan edit lock: %w", err)
+			}
+			locks = append(locks, lock)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, locks)
+}
+
+// checkEditLock lehnt das Ändern eines Datensatzes ab, den ein anderer Benutzer gesperrt hat.
+// Neue Datensätze (ohne Primärschlüssel) sind nie gesperrt. Die Zeile bleibt bis zum Ende der
+// Transaktion gesperrt, damit AcquireLock nicht zwischen Prüfung und Speichern zugreifen kann.
+func checkEditLock(ctx context.Context, db Queryer, table *models.Table, data *SaveRequest, mode saveMode) error {
+	if mode == saveInsert || table.PrimaryKey == "" {
+		return nil
+	}
+	value := columnValue(data.Columns, table.PrimaryKey)
+	if isEmpty(value) {
+		return nil
+	}
+	key, found, err := lockedRecordKey(ctx, db, table, value, "FOR NO KEY UPDATE")
+	if err != nil || !found {
+		return err
+	}
+	lock, err := activeLock(ctx, db, table, key)
+	if err != nil || lock == nil {
+		return err
+	}
+	if p := auth.FromContext(ctx); p != nil && p.UserID == lock.UserID {
+		return nil
+	}
+	return lockedError(lock)
+}
+
+// applyLocks markiert gesperrte Datensätze einer Seite mit _lock (Benutzer und Ablauf der Sperre)
+func applyLocks(ctx context.Context, db Queryer, table *models.Table, rows []map[string]interface{}) error {
+	if table.PrimaryKey == "" || len(rows) == 0 {
+		return nil
+	}
+	byKey := map[string]map[string]interface{}{}
+	keys := []string{}
+	for _, row := range rows {
+		key := recordKey(row[table.PrimaryKey])
+		byKey[key] = row
+		keys = append(keys, key)
+	}
+
+	query := &sqlBuilder{}
+	query.SQL("SELECT " + lockColumns + " FROM ").MetaTable("edit_locks").SQL(" l JOIN ").MetaTable("users").SQL(" u ON u.id = l.user_id").
+		SQL(" WHERE l.table_schema = ").Arg(table.Schema).SQL(" AND l.table_name = ").Arg(table.Name).
+		SQL(" AND l.record_key = ANY(").Arg(pq.Array(keys)).SQL(") AND l.expires_at > now()")
+	result, err := db.QueryContext(ctx, query.String(), query.Args()...)
+	if err != nil {
+		return fmt.Errorf("failed to read edit locks: %w", err)
+	}
+	defer result.Close()
+	for result.Next() {
+		lock, err := scanLock(result)
+		if err != nil {
+			return fmt.Errorf("failed to scan edit lock: %w", err)
+		}
+		if row := byKey[lock.RecordKey]; row != nil {
+			row["_lock"] = map[string]interface{}{"userId": lock.UserID, "userName": lock.UserName, "expiresAt": lock.ExpiresAt}
+		}
+	}
+	return result.Err()
+}
+
+// PurgeEditLocks entfernt abgelaufene Sperren; läuft als Job des Schedulers
+func PurgeEditLocks(ctx context.Context, db *sql.DB) error {
+	query := &sqlBuilder{}
+	query.SQL("DELETE FROM ").MetaTable("edit_locks").SQL(" WHERE expires_at <= now()")
+	if _, err := db.ExecContext(ctx, query.String(), query.Args()...); err != nil {
+		return fmt.Errorf("failed to purge edit locks: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"wuffnetCMS/middleware"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// annotate hält Vorgang, Schema und Tabelle für alle Logeinträge der Anfrage fest (inkl. Access-Log)
+func annotate(r *http.Request, operation, schema, table string) {
+	args := []any{"operation", operation}
+	if schema != "" || table != "" {
+		args = append(args, "schema", schema, "table", table)
+	}
+	middleware.Annotate(r.Context(), args...)
+
+	trace.SpanFromContext(r.Context()).SetAttributes(
+		attribute.String("cms.operation", operation),
+		attribute.String("cms.schema", schema),
+		attribute.String("cms.table", table),
+	)
+}
+
+// logError protokolliert einen Fehler, der an den Client geht; bei 5xx mit der eigentlichen Ursache
+func logError(ctx context.Context, err error, apiErr *APIError) {
+	logger := middleware.Logger(ctx)
+	if apiErr.Status >= http.StatusInternalServerError {
+		logger.Error("Request failed", "status", apiErr.Status, "code", apiErr.Code, "error", err)
+		return
+	}
+	logger.Info("Request rejected", "status", apiErr.Status, "code", apiErr.Code, "message", apiErr.Message)
+}
@@ -0,0 +1,776 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"wuffnetCMS/events"
+	"wuffnetCMS/middleware"
+	"wuffnetCMS/models"
+	"wuffnetCMS/webhooks"
+)
+
+// Komponentennamen dürfen laut OpenAPI nur diese Zeichen enthalten
+var componentNameCleaner = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// GetOpenAPISpec erzeugt zur Laufzeit eine OpenAPI-3-Beschreibung der Tabellen-API
+func GetOpenAPISpec(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	annotate(r, "openapi", "", "")
+	tables, err := LoadCatalog(r.Context(), db)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error reading catalog: %w", err))
+		return
+	}
+
+	spec := buildOpenAPISpec(tables)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(spec); err != nil {
+		middleware.Logger(r.Context()).Warn("Failed to encode JSON response", "error", err)
+	}
+}
+
+func buildOpenAPISpec(tables []models.Table) map[string]interface{} {
+	schemas := map[string]interface{}{}
+	var schemaNames, tableNames []string
+	var recordRefs, saveRefs []interface{}
+	seenSchemas := map[string]bool{}
+	seenTables := map[string]bool{}
+
+	for _, table := range tables {
+		if !seenSchemas[table.Schema] {
+			seenSchemas[table.Schema] = true
+			schemaNames = append(schemaNames, table.Schema)
+		}
+		if !seenTables[table.Name] {
+			seenTables[table.Name] = true
+			tableNames = append(tableNames, table.Name)
+		}
+
+		name := componentName(table)
+		schemas[name] = recordSchema(table)
+		schemas[name+".SaveRequest"] = saveRequestSchema(table, name)
+		recordRefs = append(recordRefs, ref(name))
+		saveRefs = append(saveRefs, ref(name+".SaveRequest"))
+	}
+
+	schemas["DeleteRequest"] = map[string]interface{}{
+		"type":     "object",
+		"required": []string{"schema", "table", "primaryKey", "primaryKeyValue"},
+		"properties": map[string]interface{}{
+			"schema":          map[string]interface{}{"type": "string", "enum": schemaNames},
+			"table":           map[string]interface{}{"type": "string", "enum": tableNames},
+			"primaryKey":      map[string]interface{}{"type": "string"},
+			"primaryKeyValue": map[string]interface{}{"description": "Wert des Primärschlüssels"},
+		},
+	}
+	schemas["Draft"] = map[string]interface{}{
+		"type":        "object",
+		"description": "Entwurf einer Änderung an einer Tabelle mit Freigabe-Workflow",
+		"properties": map[string]interface{}{
+			"id":            map[string]interface{}{"type": "integer", "format": "int64"},
+			"schema":        map[string]interface{}{"type": "string"},
+			"table":         map[string]interface{}{"type": "string"},
+			"recordKey":     map[string]interface{}{"type": "string", "nullable": true, "description": "Primärschlüssel des Live-Datensatzes; leer bei neuen Datensätzen bis zur Veröffentlichung"},
+			"columns":       map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "object", "properties": map[string]interface{}{"name": map[string]interface{}{"type": "string"}, "value": map[string]interface{}{}}}},
+			"status":        map[string]interface{}{"type": "string", "enum": draftStatuses},
+			"comment":       map[string]interface{}{"type": "string", "nullable": true},
+			"createdBy":     map[string]interface{}{"type": "integer", "format": "int64", "nullable": true},
+			"reviewedBy":    map[string]interface{}{"type": "integer", "format": "int64", "nullable": true},
+			"createdAt":     map[string]interface{}{"type": "string", "format": "date-time"},
+			"updatedAt":     map[string]interface{}{"type": "string", "format": "date-time"},
+			"reviewedAt":    map[string]interface{}{"type": "string", "format": "date-time", "nullable": true},
+			"publishedAt":   map[string]interface{}{"type": "string", "format": "date-time", "nullable": true},
+			"publishAt":     map[string]interface{}{"type": "string", "format": "date-time", "nullable": true, "description": "Frühester Zeitpunkt der Veröffentlichung nach der Freigabe"},
+			"unpublishAt":   map[string]interface{}{"type": "string", "format": "date-time", "nullable": true, "description": "Zeitpunkt, zu dem der veröffentlichte Datensatz wieder aus der Tabelle genommen wird"},
+			"scheduleError": map[string]interface{}{"type": "string", "nullable": true, "description": "Fehler des Schedulers; bis zum nächsten Setzen des Zeitplans kein neuer Versuch"},
+		},
+	}
+	schemas["EditLock"] = map[string]interface{}{
+		"type":        "object",
+		"description": "Bearbeitungssperre eines Datensatzes; gilt bis expiresAt und wird per Heartbeat verlängert",
+		"properties": map[string]interface{}{
+			"schema":     map[string]interface{}{"type": "string"},
+			"table":      map[string]interface{}{"type": "string"},
+			"recordKey":  map[string]interface{}{"type": "string"},
+			"userId":     map[string]interface{}{"type": "integer", "format": "int64"},
+			"userName":   map[string]interface{}{"type": "string"},
+			"acquiredAt": map[string]interface{}{"type": "string", "format": "date-time"},
+			"expiresAt":  map[string]interface{}{"type": "string", "format": "date-time"},
+		},
+	}
+	schemas["UnpublishSchedule"] = map[string]interface{}{
+		"type":        "object",
+		"description": "Live-Datensatz, der zu unpublishAt aus seiner Tabelle genommen und als Entwurf (unpublished) aufbewahrt wird",
+		"properties": map[string]interface{}{
+			"schema":        map[string]interface{}{"type": "string"},
+			"table":         map[string]interface{}{"type": "string"},
+			"recordKey":     map[string]interface{}{"type": "string"},
+			"unpublishAt":   map[string]interface{}{"type": "string", "format": "date-time"},
+			"scheduleError": map[string]interface{}{"type": "string", "nullable": true},
+		},
+	}
+	schemas["Webhook"] = map[string]interface{}{
+		"type":        "object",
+		"description": "Konfigurierter Webhook; leere Felder schema, table und events bedeuten alle",
+		"properties": map[string]interface{}{
+			"name":   map[string]interface{}{"type": "string"},
+			"url":    map[string]interface{}{"type": "string"},
+			"schema": map[string]interface{}{"type": "string"},
+			"table":  map[string]interface{}{"type": "string"},
+			"events": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "enum": webhooks.Events}},
+		},
+	}
+	schemas["WebhookDelivery"] = map[string]interface{}{
+		"type":        "object",
+		"description": "Zustellung aus der Outbox; payload und attemptLog nur in der Einzelansicht",
+		"properties": map[string]interface{}{
+			"id":            map[string]interface{}{"type": "integer", "format": "int64", "description": "Wird als X-CMS-Delivery mitgesendet"},
+			"webhook":       map[string]interface{}{"type": "string"},
+			"event":         map[string]interface{}{"type": "string", "enum": webhooks.Events},
+			"schema":        map[string]interface{}{"type": "string"},
+			"table":         map[string]interface{}{"type": "string"},
+			"recordKey":     map[string]interface{}{"type": "string", "nullable": true},
+			"status":        map[string]interface{}{"type": "string", "enum": deliveryStatuses},
+			"attempts":      map[string]interface{}{"type": "integer", "description": "Versuche seit dem Anlegen bzw. dem letzten redeliver"},
+			"nextAttemptAt": map[string]interface{}{"type": "string", "format": "date-time"},
+			"lastStatus":    map[string]interface{}{"type": "integer", "nullable": true, "description": "HTTP-Status des letzten Versuchs"},
+			"lastError":     map[string]interface{}{"type": "string", "nullable": true},
+			"createdAt":     map[string]interface{}{"type": "string", "format": "date-time"},
+			"deliveredAt":   map[string]interface{}{"type": "string", "format": "date-time", "nullable": true},
+			"payload":       map[string]interface{}{"type": "object", "description": "Gesendeter Inhalt: event, schema, table, key, record (null beim Löschen), occurredAt"},
+			"attemptLog": map[string]interface{}{"type": "array", "items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"attemptedAt": map[string]interface{}{"type": "string", "format": "date-time"},
+					"status":      map[string]interface{}{"type": "integer", "nullable": true},
+					"error":       map[string]interface{}{"type": "string", "nullable": true},
+					"durationMs":  map[string]interface{}{"type": "integer"},
+				},
+			}},
+		},
+	}
+	schemas["TableList"] = map[string]interface{}{
+		"type": "array",
+		"items": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"schema": map[string]interface{}{"type": "string"},
+				"tables": map[string]interface{}{
+					"type": "array",
+					"items": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"tableName":        map[string]interface{}{"type": "string"},
+							"primaryKeyColumn": map[string]interface{}{"type": "string"},
+						},
+					},
+				},
+			},
+		},
+	}
+	schemas["ColumnInfo"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name":      map[string]interface{}{"type": "string"},
+			"type":      map[string]interface{}{"type": "string"},
+			"readonly":  map[string]interface{}{"type": "boolean"},
+			"required":  map[string]interface{}{"type": "boolean"},
+			"maxLength": map[string]interface{}{"type": "integer"},
+			"minLength": map[string]interface{}{"type": "integer"},
+			"min":       map[string]interface{}{"type": "number"},
+			"max":       map[string]interface{}{"type": "number"},
+			"pattern":   map[string]interface{}{"type": "string"},
+			"format":    map[string]interface{}{"type": "string", "enum": []string{"email", "url"}},
+			"unique":    map[string]interface{}{"type": "boolean"},
+			"auto":      map[string]interface{}{"type": "boolean"},
+			"default":   map[string]interface{}{"type": "string"},
+			"identity":  map[string]interface{}{"type": "string", "enum": []string{"ALWAYS", "BY DEFAULT"}},
+			"generated": map[string]interface{}{"type": "boolean"},
+			"options": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"value": map[string]interface{}{},
+						"label": map[string]interface{}{"type": "string"},
+					},
+				},
+			},
+		},
+	}
+
+	schemaParam := map[string]interface{}{
+		"name": "schema", "in": "query", "required": true,
+		"schema": map[string]interface{}{"type": "string", "enum": schemaNames},
+	}
+	tableParam := map[string]interface{}{
+		"name": "table", "in": "query", "required": true,
+		"schema": map[string]interface{}{"type": "string", "enum": tableNames},
+	}
+	textResponse := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": description,
+			"content": map[string]interface{}{
+				"text/plain": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+			},
+		}
+	}
+	jsonResponse := func(description string, schema interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"description": description,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schema},
+			},
+		}
+	}
+	errorResponse := func(description string) map[string]interface{} {
+		return jsonResponse(description, ref("Error"))
+	}
+	schemas["Error"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"error": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"status":    map[string]interface{}{"type": "integer"},
+					"code":      map[string]interface{}{"type": "string"},
+					"message":   map[string]interface{}{"type": "string"},
+					"requestId": map[string]interface{}{"type": "string"},
+					"fields": map[string]interface{}{
+						"type": "array",
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"field":   map[string]interface{}{"type": "string"},
+								"code":    map[string]interface{}{"type": "string"},
+								"message": map[string]interface{}{"type": "string"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	paths := map[string]interface{}{
+		"/api/tables": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":   "Listet alle Schemas und Tabellen",
+				"responses": map[string]interface{}{"200": jsonResponse("Schemas mit Tabellen", ref("TableList"))},
+			},
+		},
+		"/api/table-content": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary": "Liefert den Inhalt einer Tabelle; gesperrte Datensätze tragen _lock (userId, userName, expiresAt)",
+				"parameters": []interface{}{
+					schemaParam,
+					tableParam,
+					map[string]interface{}{
+						"name": "filter", "in": "query", "description": "Suchbegriff über alle Spalten (ILIKE)",
+						"schema": map[string]interface{}{"type": "string"},
+					},
+					map[string]interface{}{
+						"name": "sort_by", "in": "query", "description": "Spalte der gewählten Tabelle",
+						"schema": map[string]interface{}{"type": "string"},
+					},
+					map[string]interface{}{
+						"name": "order", "in": "query",
+						"schema": map[string]interface{}{"type": "string", "enum": []string{"asc", "desc"}, "default": "asc"},
+					},
+					map[string]interface{}{
+						"name": "limit", "in": "query",
+						"schema": map[string]interface{}{"type": "integer", "default": 100},
+					},
+					map[string]interface{}{
+						"name": "offset", "in": "query",
+						"schema": map[string]interface{}{"type": "integer", "default": 0},
+					},
+					map[string]interface{}{
+						"name": "view", "in": "query", "description": "draft überlagert die Datensätze mit offenen Entwürfen (_draft) und liefert neue unter drafts",
+						"schema": map[string]interface{}{"type": "string", "enum": []string{viewLive, viewDraft}, "default": viewLive},
+					},
+				},
+				"responses": map[string]interface{}{
+					"200": jsonResponse("Datensätze mit Paging-Informationen", map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"data":        map[string]interface{}{"type": "array", "items": map[string]interface{}{"oneOf": recordRefs}},
+							"totalCount":  map[string]interface{}{"type": "integer"},
+							"hasNextPage": map[string]interface{}{"type": "boolean"},
+							"drafts":      map[string]interface{}{"type": "array", "items": map[string]interface{}{"oneOf": recordRefs}},
+						},
+					}),
+					"400": errorResponse("Ungültige Parameter"),
+				},
+			},
+		},
+		"/api/table-fields": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":    "Liefert die Formularfelder einer Tabelle",
+				"parameters": []interface{}{schemaParam, tableParam},
+				"responses": map[string]interface{}{
+					"200": jsonResponse("Spalteninformationen", map[string]interface{}{"type": "array", "items": ref("ColumnInfo")}),
+					"400": errorResponse("Ungültige Parameter"),
+				},
+			},
+		},
+		"/api/save-record": map[string]interface{}{
+			"post": map[string]interface{}{
+				"summary":     "Legt einen Datensatz an oder aktualisiert ihn (Update bei gesetztem Primärschlüssel)",
+				"requestBody": map[string]interface{}{"required": true, "content": map[string]interface{}{"application/json": map[string]interface{}{"schema": map[string]interface{}{"oneOf": saveRefs}}}},
+				"responses": map[string]interface{}{
+					"200": jsonResponse("Gespeicherter Datensatz", map[string]interface{}{"oneOf": saveRefs}),
+					"202": jsonResponse("Als Entwurf gespeichert (Tabelle mit Freigabe-Workflow)", ref("Draft")),
+					"400": errorResponse("Ungültige Eingabe"),
+					"409": errorResponse("Konflikt, z. B. doppelter Wert oder von einem anderen Benutzer gesperrt (locked)"),
+					"422": errorResponse("Validierungsfehler mit Feldangaben"),
+				},
+			},
+		},
+		"/api/delete-record": map[string]interface{}{
+			"post": map[string]interface{}{
+				"summary":     "Löscht einen Datensatz anhand des Primärschlüssels",
+				"requestBody": map[string]interface{}{"required": true, "content": map[string]interface{}{"application/json": map[string]interface{}{"schema": ref("DeleteRequest")}}},
+				"responses": map[string]interface{}{
+					"200": textResponse("Datensatz gelöscht"),
+					"400": errorResponse("Fehlende Parameter"),
+					"404": errorResponse("Nicht gefunden"),
+				},
+			},
+		},
+	}
+
+	// Freigabe-Workflow
+	draftResponse := jsonResponse("Als Entwurf gespeichert (Tabelle mit Freigabe-Workflow), Location verweist auf den Entwurf", ref("Draft"))
+	idParam := map[string]interface{}{
+		"name": "id", "in": "path", "required": true,
+		"schema": map[string]interface{}{"type": "integer", "format": "int64"},
+	}
+	commentBody := map[string]interface{}{"content": map[string]interface{}{"application/json": map[string]interface{}{"schema": map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"comment": map[string]interface{}{"type": "string"}},
+	}}}}
+	reviewStep := func(summary string) map[string]interface{} {
+		return map[string]interface{}{
+			"parameters": []interface{}{idParam},
+			"post": map[string]interface{}{
+				"summary":     summary,
+				"requestBody": commentBody,
+				"responses": map[string]interface{}{
+					"200": jsonResponse("Entwurf mit neuem Status", ref("Draft")),
+					"404": errorResponse("Nicht gefunden"),
+					"409": errorResponse("Entwurf hat nicht den passenden Status"),
+				},
+			},
+		}
+	}
+	paths["/api/drafts"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary": "Listet Entwürfe, ohne status alle offenen",
+			"parameters": []interface{}{
+				map[string]interface{}{"name": "schema", "in": "query", "schema": map[string]interface{}{"type": "string"}},
+				map[string]interface{}{"name": "table", "in": "query", "schema": map[string]interface{}{"type": "string"}},
+				map[string]interface{}{"name": "status", "in": "query", "schema": map[string]interface{}{"type": "string", "enum": draftStatuses}},
+				map[string]interface{}{"name": "limit", "in": "query", "schema": map[string]interface{}{"type": "integer", "default": 100}},
+				map[string]interface{}{"name": "offset", "in": "query", "schema": map[string]interface{}{"type": "integer", "default": 0}},
+			},
+			"responses": map[string]interface{}{
+				"200": jsonResponse("Entwürfe, zuletzt geänderte zuerst", map[string]interface{}{"type": "array", "items": ref("Draft")}),
+				"404": errorResponse("Schema nicht gefunden"),
+			},
+		},
+	}
+	paths["/api/drafts/{id}"] = map[string]interface{}{
+		"parameters": []interface{}{idParam},
+		"get": map[string]interface{}{
+			"summary": "Liefert einen Entwurf mit dem aktuellen Live-Datensatz",
+			"responses": map[string]interface{}{
+				"200": jsonResponse("Entwurf und Live-Datensatz", map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"draft": ref("Draft"), "live": map[string]interface{}{"type": "object", "nullable": true}},
+				}),
+				"404": errorResponse("Nicht gefunden"),
+			},
+		},
+	}
+	paths["/api/drafts/{id}/approve"] = reviewStep("Gibt einen Entwurf frei (nicht durch den Autor)")
+	paths["/api/drafts/{id}/reject"] = reviewStep("Schickt einen Entwurf zur Überarbeitung zurück")
+	paths["/api/drafts/{id}/publish"] = reviewStep("Überträgt einen freigegebenen Entwurf in die Tabelle")
+	dateTime := map[string]interface{}{"type": "string", "format": "date-time", "nullable": true}
+	paths["/api/drafts/{id}/schedule"] = map[string]interface{}{
+		"parameters": []interface{}{idParam},
+		"put": map[string]interface{}{
+			"summary": "Plant Veröffentlichen und Entfernen eines Entwurfs; null entfernt den Zeitpunkt. Ohne Scope publish geht ein freigegebener Entwurf zurück in die Prüfung",
+			"requestBody": map[string]interface{}{"required": true, "content": map[string]interface{}{"application/json": map[string]interface{}{"schema": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"publishAt": dateTime, "unpublishAt": dateTime},
+			}}}},
+			"responses": map[string]interface{}{
+				"200": jsonResponse("Entwurf mit neuem Zeitplan", ref("Draft")),
+				"400": errorResponse("unpublishAt liegt nicht nach publishAt"),
+				"404": errorResponse("Nicht gefunden"),
+				"409": errorResponse("Entwurf ist bereits veröffentlicht"),
+			},
+		},
+	}
+	paths["/api/schedules"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary": "Listet geplante Veröffentlichungen und Entfernungen, die nächsten zuerst",
+			"parameters": []interface{}{
+				map[string]interface{}{"name": "schema", "in": "query", "schema": map[string]interface{}{"type": "string"}},
+				map[string]interface{}{"name": "table", "in": "query", "schema": map[string]interface{}{"type": "string"}},
+			},
+			"responses": map[string]interface{}{
+				"200": jsonResponse("Zeitpläne", map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"publish":   map[string]interface{}{"type": "array", "items": ref("Draft")},
+						"unpublish": map[string]interface{}{"type": "array", "items": ref("UnpublishSchedule")},
+					},
+				}),
+				"404": errorResponse("Schema nicht gefunden"),
+			},
+		},
+	}
+	paths["/api/schedules/{schema}/{table}/{pk}"] = map[string]interface{}{
+		"parameters": []interface{}{
+			map[string]interface{}{"name": "schema", "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"}},
+			map[string]interface{}{"name": "table", "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"}},
+			map[string]interface{}{"name": "pk", "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"}},
+		},
+		"put": map[string]interface{}{
+			"summary": "Plant das Entfernen eines Live-Datensatzes; unpublishAt null hebt den Zeitplan auf",
+			"requestBody": map[string]interface{}{"required": true, "content": map[string]interface{}{"application/json": map[string]interface{}{"schema": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"unpublishAt": dateTime},
+			}}}},
+			"responses": map[string]interface{}{
+				"204": map[string]interface{}{"description": "Zeitplan gespeichert"},
+				"404": errorResponse("Nicht gefunden"),
+				"409": errorResponse("Tabelle ohne Freigabe-Workflow"),
+			},
+		},
+	}
+
+	// Änderungen als Server-Sent Events
+	paths["/api/events"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary": "Meldet Änderungen an Datensätzen als Server-Sent Events (insert, update, delete; reload = alles neu laden)",
+			"parameters": []interface{}{
+				map[string]interface{}{"name": "schema", "in": "query", "schema": map[string]interface{}{"type": "string"}},
+				map[string]interface{}{"name": "table", "in": "query", "schema": map[string]interface{}{"type": "string"}},
+			},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "Stream; data ist das Ereignis als JSON",
+					"content": map[string]interface{}{"text/event-stream": map[string]interface{}{"schema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"type":   map[string]interface{}{"type": "string", "enum": []string{opInsert, opUpdate, opDelete, events.Reload}},
+							"schema": map[string]interface{}{"type": "string"},
+							"table":  map[string]interface{}{"type": "string"},
+							"key":    map[string]interface{}{"type": "string", "description": "Primärschlüssel als Text"},
+						},
+					}}},
+				},
+				"404": errorResponse("Unbekannte Tabelle oder Ereignisse ausgeschaltet"),
+			},
+		},
+	}
+
+	// Bearbeitungssperren
+	lockParams := []interface{}{
+		map[string]interface{}{"name": "schema", "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"}},
+		map[string]interface{}{"name": "table", "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"}},
+		map[string]interface{}{"name": "pk", "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"}},
+	}
+	lockStep := func(summary string, responses map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"parameters": lockParams,
+			"post":       map[string]interface{}{"summary": summary, "responses": responses},
+		}
+	}
+	paths["/api/locks"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary": "Listet die gültigen Bearbeitungssperren",
+			"parameters": []interface{}{
+				map[string]interface{}{"name": "schema", "in": "query", "schema": map[string]interface{}{"type": "string"}},
+				map[string]interface{}{"name": "table", "in": "query", "schema": map[string]interface{}{"type": "string"}},
+			},
+			"responses": map[string]interface{}{
+				"200": jsonResponse("Sperren, älteste zuerst", map[string]interface{}{"type": "array", "items": ref("EditLock")}),
+				"404": errorResponse("Schema nicht gefunden"),
+			},
+		},
+	}
+	paths["/api/locks/{schema}/{table}/{pk}"] = lockStep("Sperrt einen Datensatz für den angemeldeten Benutzer bzw. verlängert die eigene Sperre", map[string]interface{}{
+		"200": jsonResponse("Sperre", ref("EditLock")),
+		"403": errorResponse("Ohne Anmeldung keine Sperren"),
+		"404": errorResponse("Nicht gefunden"),
+		"409": errorResponse("Von einem anderen Benutzer gesperrt (locked)"),
+	})
+	paths["/api/locks/{schema}/{table}/{pk}/heartbeat"] = lockStep("Verlängert die eigene Sperre", map[string]interface{}{
+		"200": jsonResponse("Sperre", ref("EditLock")),
+		"409": errorResponse("Sperre wurde freigegeben oder aufgehoben (locked)"),
+	})
+	paths["/api/locks/{schema}/{table}/{pk}/release"] = lockStep("Gibt die eigene Sperre frei", map[string]interface{}{
+		"204": map[string]interface{}{"description": "Freigegeben"},
+	})
+	paths["/api/locks/{schema}/{table}/{pk}/break"] = lockStep("Hebt die Sperre eines anderen Benutzers auf (Scope admin)", map[string]interface{}{
+		"204": map[string]interface{}{"description": "Aufgehoben"},
+		"404": errorResponse("Datensatz ist nicht gesperrt"),
+	})
+
+	// Webhooks (Scope admin)
+	paths["/api/webhooks"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary":   "Listet die konfigurierten Webhooks ohne Secrets",
+			"responses": map[string]interface{}{"200": jsonResponse("Webhooks", map[string]interface{}{"type": "array", "items": ref("Webhook")})},
+		},
+	}
+	paths["/api/webhooks/deliveries"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary": "Listet Zustellungen, neueste zuerst",
+			"parameters": []interface{}{
+				map[string]interface{}{"name": "webhook", "in": "query", "schema": map[string]interface{}{"type": "string"}},
+				map[string]interface{}{"name": "status", "in": "query", "schema": map[string]interface{}{"type": "string", "enum": deliveryStatuses}},
+				map[string]interface{}{"name": "schema", "in": "query", "schema": map[string]interface{}{"type": "string"}},
+				map[string]interface{}{"name": "table", "in": "query", "schema": map[string]interface{}{"type": "string"}},
+				map[string]interface{}{"name": "limit", "in": "query", "schema": map[string]interface{}{"type": "integer", "default": 100}},
+				map[string]interface{}{"name": "offset", "in": "query", "schema": map[string]interface{}{"type": "integer", "default": 0}},
+			},
+			"responses": map[string]interface{}{
+				"200": jsonResponse("Zustellungen", map[string]interface{}{"type": "array", "items": ref("WebhookDelivery")}),
+				"404": errorResponse("Schema nicht gefunden"),
+			},
+		},
+	}
+	paths["/api/webhooks/deliveries/{id}"] = map[string]interface{}{
+		"parameters": []interface{}{idParam},
+		"get": map[string]interface{}{
+			"summary": "Liefert eine Zustellung mit Inhalt und allen Versuchen",
+			"responses": map[string]interface{}{
+				"200": jsonResponse("Zustellung", ref("WebhookDelivery")),
+				"404": errorResponse("Nicht gefunden"),
+			},
+		},
+	}
+	paths["/api/webhooks/deliveries/{id}/redeliver"] = map[string]interface{}{
+		"parameters": []interface{}{idParam},
+		"post": map[string]interface{}{
+			"summary": "Stellt eine Zustellung mit ihrem ursprünglichen Inhalt beim nächsten Durchlauf des Schedulers erneut zu",
+			"responses": map[string]interface{}{
+				"202": jsonResponse("Zustellung, wieder ausstehend", ref("WebhookDelivery")),
+				"404": errorResponse("Nicht gefunden"),
+				"409": errorResponse("Webhook ist nicht mehr konfiguriert"),
+			},
+		},
+	}
+
+	// REST-Pfade je Tabelle unter /api/v2
+	for _, table := range tables {
+		name := componentName(table)
+		record := ref(name)
+		body := map[string]interface{}{"required": true, "content": map[string]interface{}{"application/json": map[string]interface{}{"schema": record}}}
+		// Namen mit Leerzeichen, Schrägstrichen oder Klammern würden sonst den Pfad bzw. die Vorlage {pk} verfälschen
+		base := fmt.Sprintf("/api/v2/tables/%s/%s/rows", url.PathEscape(table.Schema), url.PathEscape(table.Name))
+		tag := []string{table.Schema + "." + table.Name}
+
+		list := map[string]interface{}{
+			"get": map[string]interface{}{
+				"tags":    tag,
+				"summary": fmt.Sprintf("Listet Datensätze aus %s.%s", table.Schema, table.Name),
+				"parameters": []interface{}{
+					map[string]interface{}{"name": "filter", "in": "query", "schema": map[string]interface{}{"type": "string"}},
+					map[string]interface{}{"name": "sort_by", "in": "query", "schema": map[string]interface{}{"type": "string", "enum": columnNames(table)}},
+					map[string]interface{}{"name": "order", "in": "query", "schema": map[string]interface{}{"type": "string", "enum": []string{"asc", "desc"}}},
+					map[string]interface{}{"name": "limit", "in": "query", "schema": map[string]interface{}{"type": "integer", "default": 100}},
+					map[string]interface{}{"name": "offset", "in": "query", "schema": map[string]interface{}{"type": "integer", "default": 0}},
+				},
+				"responses": map[string]interface{}{
+					"200": jsonResponse("Datensätze mit Paging-Informationen", map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"data":        map[string]interface{}{"type": "array", "items": record},
+							"totalCount":  map[string]interface{}{"type": "integer"},
+							"hasNextPage": map[string]interface{}{"type": "boolean"},
+						},
+					}),
+					"400": errorResponse("Ungültige Parameter"),
+				},
+			},
+		}
+		paths[base] = list
+
+		if table.PrimaryKey == "" {
+			continue
+		}
+		list["post"] = map[string]interface{}{
+			"tags":        tag,
+			"summary":     fmt.Sprintf("Legt einen Datensatz in %s.%s an", table.Schema, table.Name),
+			"requestBody": body,
+			"responses": map[string]interface{}{
+				"201": jsonResponse("Angelegter Datensatz, Location verweist auf die neue Ressource", record),
+				"202": draftResponse,
+				"400": errorResponse("Ungültige Eingabe"),
+			},
+		}
+
+		pkParam := map[string]interface{}{
+			"name": "pk", "in": "path", "required": true,
+			"description": "Wert von " + table.PrimaryKey,
+			"schema":      map[string]interface{}{"type": "string"},
+		}
+		paths[base+"/{pk}"] = map[string]interface{}{
+			"parameters": []interface{}{pkParam},
+			"get": map[string]interface{}{
+				"tags":      tag,
+				"summary":   "Liefert einen Datensatz",
+				"responses": map[string]interface{}{"200": jsonResponse("Datensatz", record), "404": errorResponse("Nicht gefunden")},
+			},
+			"put": map[string]interface{}{
+				"tags":        tag,
+				"summary":     "Ersetzt einen Datensatz, fehlende Spalten werden NULL",
+				"requestBody": body,
+				"responses":   map[string]interface{}{"200": jsonResponse("Datensatz", record), "202": draftResponse, "400": errorResponse("Ungültige Eingabe"), "404": errorResponse("Nicht gefunden")},
+			},
+			"patch": map[string]interface{}{
+				"tags":        tag,
+				"summary":     "Aktualisiert die übergebenen Spalten",
+				"requestBody": body,
+				"responses":   map[string]interface{}{"200": jsonResponse("Datensatz", record), "202": draftResponse, "400": errorResponse("Ungültige Eingabe"), "404": errorResponse("Nicht gefunden")},
+			},
+			"delete": map[string]interface{}{
+				"tags":      tag,
+				"summary":   "Löscht einen Datensatz",
+				"responses": map[string]interface{}{"204": map[string]interface{}{"description": "Gelöscht"}, "404": errorResponse("Nicht gefunden")},
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "wuffnetCMS API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			// Persönliche API-Tokens aus /api/tokens; ohne konfigurierte Anmeldung wird der Header ignoriert
+			"securitySchemes": map[string]interface{}{
+				"apiToken": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"apiToken": []string{}}},
+	}
+}
+
+// recordSchema beschreibt einen Datensatz einer Tabelle, so wie GetTableContent ihn liefert
+func recordSchema(table models.Table) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for _, col := range table.Columns {
+		property := openAPIType(col)
+		// Werte generierter Spalten werden beim Speichern ignoriert
+		if col.Generated || col.Identity == "ALWAYS" {
+			property["readOnly"] = true
+		}
+		properties[col.Name] = property
+	}
+	schema := map[string]interface{}{
+		"type":        "object",
+		"description": fmt.Sprintf("Datensatz aus %s.%s", table.Schema, table.Name),
+		"properties":  properties,
+	}
+	if table.PrimaryKey != "" {
+		schema["x-primary-key"] = table.PrimaryKey
+	}
+	return schema
+}
+
+// saveRequestSchema beschreibt die Nutzlast von /api/save-record für eine Tabelle
+func saveRequestSchema(table models.Table, name string) map[string]interface{} {
+	primaryKey := map[string]interface{}{"type": "string"}
+	if table.PrimaryKey != "" {
+		primaryKey["enum"] = []string{table.PrimaryKey}
+	}
+	return map[string]interface{}{
+		"type":        "object",
+		"description": fmt.Sprintf("Speichern eines Datensatzes in %s.%s, siehe %s", table.Schema, table.Name, name),
+		"required":    []string{"schema", "table", "primaryKey", "columns"},
+		"properties": map[string]interface{}{
+			"schema":     map[string]interface{}{"type": "string", "enum": []string{table.Schema}},
+			"table":      map[string]interface{}{"type": "string", "enum": []string{table.Name}},
+			"primaryKey": primaryKey,
+			"draftId":    map[string]interface{}{"type": "integer", "format": "int64", "description": "Bestehenden Entwurf ergänzen (Tabellen mit Freigabe-Workflow)"},
+			"columns": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"name", "value"},
+					"properties": map[string]interface{}{
+						"name":  map[string]interface{}{"type": "string", "enum": columnNames(table)},
+						"value": map[string]interface{}{},
+					},
+				},
+			},
+		},
+	}
+}
+
+// openAPIType bildet PostgreSQL-Datentypen auf OpenAPI-Typen ab
+func openAPIType(col models.Column) map[string]interface{} {
+	var schema map[string]interface{}
+	switch strings.ToLower(col.DataType) {
+	case "smallint", "integer":
+		schema = map[string]interface{}{"type": "integer", "format": "int32"}
+	case "bigint":
+		schema = map[string]interface{}{"type": "integer", "format": "int64"}
+	case "real":
+		schema = map[string]interface{}{"type": "number", "format": "float"}
+	case "double precision":
+		schema = map[string]interface{}{"type": "number", "format": "double"}
+	case "numeric":
+		schema = map[string]interface{}{"type": "number"}
+	case "boolean":
+		schema = map[string]interface{}{"type": "boolean"}
+	case "date":
+		schema = map[string]interface{}{"type": "string", "format": "date"}
+	case "timestamp without time zone", "timestamp with time zone":
+		schema = map[string]interface{}{"type": "string", "format": "date-time"}
+	case "time without time zone", "time with time zone":
+		schema = map[string]interface{}{"type": "string", "pattern": "^[0-9]{2}:[0-9]{2}(:[0-9]{2})?$"}
+	case "json", "jsonb":
+		schema = map[string]interface{}{}
+	default:
+		schema = map[string]interface{}{"type": "string"}
+	}
+	if col.IsNullable {
+		schema["nullable"] = true
+	}
+	if col.References != nil {
+		schema["description"] = fmt.Sprintf("Fremdschlüssel auf %s.%s.%s", col.References.Schema, col.References.Table, col.References.Column)
+	}
+	return schema
+}
+
+func columnNames(table models.Table) []string {
+	names := make([]string, 0, len(table.Columns))
+	for _, col := range table.Columns {
+		names = append(names, col.Name)
+	}
+	return names
+}
+
+func componentName(table models.Table) string {
+	return componentNameCleaner.ReplaceAllString(table.Schema+"."+table.Name, "_")
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"wuffnetCMS/models"
+)
+
+// openAPIFixture enthält Namen, die im Pfad escaped und im Komponentennamen ersetzt werden müssen
+func openAPIFixture() []models.Table {
+	return []models.Table{
+		{Schema: "shop", Name: "order items", PrimaryKey: "id", Columns: []models.Column{
+			{Name: "id", DataType: "integer", HasDefault: true, Identity: "ALWAYS"},
+			{Name: "sku", DataType: "text"},
+			{Name: "unit price", DataType: "numeric", IsNullable: true},
+			{Name: "order_id", DataType: "bigint", References: &models.ForeignKey{Schema: "shop", Table: "orders", Column: "id"}},
+		}},
+		{Schema: "shop", Name: "log", Columns: []models.Column{{Name: "message", DataType: "text"}}},
+	}
+}
+
+// specValue folgt path durch die als JSON gelesene Spezifikation
+func specValue(t *testing.T, spec interface{}, path ...string) interface{} {
+	t.Helper()
+	value := spec
+	for _, key := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok || object[key] == nil {
+			t.Fatalf("%v: %q missing", path, key)
+		}
+		value = object[key]
+	}
+	return value
+}
+
+func TestBuildOpenAPISpec(t *testing.T) {
+	raw, err := json.Marshal(buildOpenAPISpec(openAPIFixture()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		t.Fatal(err)
+	}
+	check := func(name string, got, want interface{}) {
+		t.Helper()
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+	columns := []interface{}{"id", "sku", "unit price", "order_id"}
+
+	t.Run("component schema", func(t *testing.T) {
+		record := specValue(t, spec, "components", "schemas", "shop.order_items")
+		check("x-primary-key", specValue(t, record, "x-primary-key"), "id")
+		check("id", specValue(t, record, "properties", "id"), map[string]interface{}{"type": "integer", "format": "int32", "readOnly": true})
+		check("unit price", specValue(t, record, "properties", "unit price"), map[string]interface{}{"type": "number", "nullable": true})
+		check("order_id", specValue(t, record, "properties", "order_id"), map[string]interface{}{
+			"type": "integer", "format": "int64", "description": "Fremdschlüssel auf shop.orders.id",
+		})
+	})
+
+	t.Run("escaped paths with filter and sort parameters", func(t *testing.T) {
+		paths := specValue(t, spec, "paths").(map[string]interface{})
+		if _, ok := paths["/api/v2/tables/shop/order items/rows"]; ok {
+			t.Error("unescaped table name in path")
+		}
+		parameters := map[string]interface{}{}
+		for _, param := range specValue(t, paths, "/api/v2/tables/shop/order%20items/rows", "get", "parameters").([]interface{}) {
+			parameters[param.(map[string]interface{})["name"].(string)] = param.(map[string]interface{})["schema"]
+		}
+		check("filter", parameters["filter"], map[string]interface{}{"type": "string"})
+		check("sort_by", parameters["sort_by"], map[string]interface{}{"type": "string", "enum": columns})
+		check("order", parameters["order"], map[string]interface{}{"type": "string", "enum": []interface{}{"asc", "desc"}})
+		check("limit", parameters["limit"], map[string]interface{}{"type": "integer", "default": float64(100)})
+		specValue(t, paths, "/api/v2/tables/shop/order%20items/rows/{pk}", "delete")
+
+		// Ohne Primärschlüssel nur lesen
+		log := specValue(t, paths, "/api/v2/tables/shop/log/rows").(map[string]interface{})
+		if log["post"] != nil || paths["/api/v2/tables/shop/log/rows/{pk}"] != nil {
+			t.Error("write operations for table without primary key")
+		}
+	})
+
+	t.Run("save and delete payloads", func(t *testing.T) {
+		save := specValue(t, spec, "components", "schemas", "shop.order_items.SaveRequest")
+		check("save required", specValue(t, save, "required"), []interface{}{"schema", "table", "primaryKey", "columns"})
+		check("save schema", specValue(t, save, "properties", "schema", "enum"), []interface{}{"shop"})
+		check("save table", specValue(t, save, "properties", "table", "enum"), []interface{}{"order items"})
+		check("save primary key", specValue(t, save, "properties", "primaryKey", "enum"), []interface{}{"id"})
+		check("save columns", specValue(t, save, "properties", "columns", "items", "properties", "name", "enum"), columns)
+		check("save-record body", specValue(t, spec, "paths", "/api/save-record", "post", "requestBody", "content", "application/json", "schema", "oneOf"), []interface{}{
+			map[string]interface{}{"$ref": "#/components/schemas/shop.order_items.SaveRequest"},
+			map[string]interface{}{"$ref": "#/components/schemas/shop.log.SaveRequest"},
+		})
+
+		remove := specValue(t, spec, "components", "schemas", "DeleteRequest")
+		check("delete required", specValue(t, remove, "required"), []interface{}{"schema", "table", "primaryKey", "primaryKeyValue"})
+		check("delete schema", specValue(t, remove, "properties", "schema", "enum"), []interface{}{"shop"})
+		check("delete table", specValue(t, remove, "properties", "table", "enum"), []interface{}{"order items", "log"})
+		check("delete-record body", specValue(t, spec, "paths", "/api/delete-record", "post", "requestBody", "content", "application/json", "schema"),
+			map[string]interface{}{"$ref": "#/components/schemas/DeleteRequest"})
+	})
+}
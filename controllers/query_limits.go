@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+	"wuffnetCMS/metrics"
+)
+
+// Queryer wird von *sql.DB und *sql.Tx erfüllt, damit Abfragen auch innerhalb einer Transaktion laufen können
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Endpunkt-Gruppen, für die eigene Statement-Timeouts gesetzt werden können
+const (
+	EndpointContent = "content" // Tabelleninhalte (/api/table-content, GET /api/v2/.../rows)
+	EndpointFields  = "fields"  // Formularfelder inkl. Fremdschlüssel-Optionen
+	EndpointSave    = "save"
+	EndpointDelete  = "delete"
+	EndpointGraphQL = "graphql" // Gilt für die gesamte GraphQL-Anfrage
+)
+
+// StatementTimeout gilt für alle Endpunkt-Gruppen ohne eigenen Eintrag in StatementTimeouts; 0 = kein Limit
+var StatementTimeout time.Duration
+
+var StatementTimeouts = map[string]time.Duration{}
+
+// MaxQueryCost begrenzt die von EXPLAIN geschätzten Kosten von Tabelleninhalt-Abfragen; 0 = keine Prüfung
+var MaxQueryCost float64
+
+func statementTimeout(endpoint string) time.Duration {
+	if timeout, ok := StatementTimeouts[endpoint]; ok {
+		return timeout
+	}
+	return StatementTimeout
+}
+
+// withStatementTimeout führt fn in einer Transaktion aus, deren Statements nach dem Timeout
+// der Endpunkt-Gruppe von Postgres abgebrochen werden
+func withStatementTimeout(ctx context.Context, db *sql.DB, endpoint string, readOnly bool, fn func(tx Queryer) error) (err error) {
+	start := time.Now()
+	defer func() { metrics.ObserveQuery(endpoint, time.Since(start), err) }()
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: readOnly})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if timeout := statementTimeout(endpoint); timeout > 0 {
+		// SET LOCAL gilt nur bis zum Ende der Transaktion; Parameter sind hier nicht erlaubt
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout.Milliseconds())); err != nil {
+			return fmt.Errorf("failed to set statement timeout: %w", err)
+		}
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkQueryCost lässt Postgres die Abfrage planen und lehnt sie ab, wenn die geschätzten Kosten MaxQueryCost übersteigen
+func checkQueryCost(ctx context.Context, db Queryer, query string, args []interface{}) error {
+	if MaxQueryCost <= 0 {
+		return nil
+	}
+
+	var plan []byte
+	if err := db.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) "+query, args...).Scan(&plan); err != nil {
+		return fmt.Errorf("failed to explain query: %w", err)
+	}
+	var explained []struct {
+		Plan struct {
+			TotalCost float64 `json:"Total Cost"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &explained); err != nil || len(explained) == 0 {
+		return fmt.Errorf("failed to parse query plan: %v", err)
+	}
+
+	if cost := explained[0].Plan.TotalCost; cost > MaxQueryCost {
+		return newError(http.StatusBadRequest, CodeQueryTooExpensive, fmt.Sprintf(
+			"Query is too expensive (estimated cost %.0f, limit %.0f). Use a more specific filter, sort by an indexed column or request fewer rows.",
+			cost, MaxQueryCost))
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"wuffnetCMS/models"
+)
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// resourceTable löst {schema}/{table} aus dem Pfad auf und beantwortet unbekannte Tabellen mit 404
+func resourceTable(db *sql.DB, w http.ResponseWriter, r *http.Request) (*models.Table, bool) {
+	table, err := LoadTable(r.Context(), db, r.PathValue("schema"), r.PathValue("table"))
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error reading catalog: %w", err))
+		return nil, false
+	}
+	if table == nil {
+		writeError(w, r, newError(http.StatusNotFound, CodeNotFound, "Table not found"))
+		return nil, false
+	}
+	return table, true
+}
+
+// resourceKeyTable wie resourceTable, setzt aber zusätzlich einen Primärschlüssel voraus
+func resourceKeyTable(db *sql.DB, w http.ResponseWriter, r *http.Request) (*models.Table, bool) {
+	table, ok := resourceTable(db, w, r)
+	if !ok {
+		return nil, false
+	}
+	if table.ReadOnly {
+		writeError(w, r, newError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Table has a composite primary key and is read-only"))
+		return nil, false
+	}
+	if table.PrimaryKey == "" {
+		writeError(w, r, newError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Table has no primary key"))
+		return nil, false
+	}
+	return table, true
+}
+
+func rowLocation(table *models.Table, pk interface{}) string {
+	return fmt.Sprintf("/api/v2/tables/%s/%s/rows/%s",
+		url.PathEscape(table.Schema), url.PathEscape(table.Name), url.PathEscape(fmt.Sprintf("%v", pk)))
+}
+
+// writeDraft beantwortet Änderungen an Tabellen mit Freigabe-Workflow mit 202 und dem Entwurf
+func writeDraft(w http.ResponseWriter, draft *Draft) {
+	w.Header().Set("Location", fmt.Sprintf("/api/drafts/%d", draft.ID))
+	writeJSON(w, http.StatusAccepted, draft)
+}
+
+// decodeRow liest einen Datensatz als JSON-Objekt {spalte: wert}
+func decodeRow(r *http.Request) (map[string]interface{}, error) {
+	var row map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&row); err != nil {
+		return nil, badRequest("Invalid input")
+	}
+	return row, nil
+}
+
+// ListRows liefert die Datensätze einer Tabelle mit Filter, Sortierung und Paging
+func ListRows(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	annotate(r, "list_rows", r.PathValue("schema"), r.PathValue("table"))
+	table, ok := resourceTable(db, w, r)
+	if !ok {
+		return
+	}
+
+	q, err := parseContentQuery(r, table)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response, err := loadTableContent(r.Context(), db, q)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// GetRow liefert einen einzelnen Datensatz anhand des Primärschlüssels
+func GetRow(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	annotate(r, "get_row", r.PathValue("schema"), r.PathValue("table"))
+	table, ok := resourceKeyTable(db, w, r)
+	if !ok {
+		return
+	}
+
+	row, err := selectOne(r.Context(), db, table, table.Column(table.PrimaryKey), r.PathValue("pk"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if row == nil {
+		writeError(w, r, errRecordNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, row)
+}
+
+// CreateRow legt einen Datensatz an und antwortet mit 201 und Location-Header
+func CreateRow(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	annotate(r, "create_row", r.PathValue("schema"), r.PathValue("table"))
+	table, ok := resourceKeyTable(db, w, r)
+	if !ok {
+		return
+	}
+
+	row, err := decodeRow(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	data := SaveRequest{Schema: table.Schema, Table: table.Name, PrimaryKey: table.PrimaryKey}
+	for name, value := range row {
+		data.Columns = append(data.Columns, RecordColumn{Name: name, Value: value})
+	}
+	draft, err := saveRecord(r.Context(), db, &data, saveInsert)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if draft != nil {
+		writeDraft(w, draft)
+		return
+	}
+
+	var pk interface{}
+	for _, col := range data.Columns {
+		if col.Name == table.PrimaryKey {
+			pk = col.Value
+		}
+	}
+
+	created, err := selectOne(r.Context(), db, table, table.Column(table.PrimaryKey), pk)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", rowLocation(table, pk))
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// ReplaceRow ersetzt einen Datensatz vollständig; nicht übergebene Spalten werden auf NULL gesetzt
+func ReplaceRow(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	updateRow(db, w, r, true)
+}
+
+// PatchRow aktualisiert nur die übergebenen Spalten eines Datensatzes
+func PatchRow(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	updateRow(db, w, r, false)
+}
+
+func updateRow(db *sql.DB, w http.ResponseWriter, r *http.Request, replace bool) {
+	operation := "patch_row"
+	if replace {
+		operation = "replace_row"
+	}
+	annotate(r, operation, r.PathValue("schema"), r.PathValue("table"))
+
+	table, ok := resourceKeyTable(db, w, r)
+	if !ok {
+		return
+	}
+
+	row, err := decodeRow(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	pk := r.PathValue("pk")
+	data := SaveRequest{Schema: table.Schema, Table: table.Name, PrimaryKey: table.PrimaryKey}
+	data.Columns = append(data.Columns, RecordColumn{Name: table.PrimaryKey, Value: pk})
+	for name, value := range row {
+		if name == table.PrimaryKey {
+			if fmt.Sprintf("%v", value) != pk {
+				writeError(w, r, fieldError(table.PrimaryKey, CodeInvalidFormat, "Primary key in body does not match the URL"))
+				return
+			}
+			continue
+		}
+		data.Columns = append(data.Columns, RecordColumn{Name: name, Value: value})
+	}
+	if replace {
+		for _, col := range table.Columns {
+			if _, given := row[col.Name]; !given && col.Name != table.PrimaryKey {
+				data.Columns = append(data.Columns, RecordColumn{Name: col.Name, Value: nil})
+			}
+		}
+	}
+
+	draft, err := saveRecord(r.Context(), db, &data, saveUpdate)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if draft != nil {
+		writeDraft(w, draft)
+		return
+	}
+
+	updated, err := selectOne(r.Context(), db, table, table.Column(table.PrimaryKey), pk)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DeleteRow löscht einen Datensatz und antwortet mit 204, bzw. 404 wenn er nicht existiert
+func DeleteRow(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	annotate(r, "delete_row", r.PathValue("schema"), r.PathValue("table"))
+	table, ok := resourceKeyTable(db, w, r)
+	if !ok {
+		return
+	}
+
+	affected, err := deleteRecord(r.Context(), db, DeleteRequest{
+		Schema:          table.Schema,
+		Table:           table.Name,
+		PrimaryKey:      table.PrimaryKey,
+		PrimaryKeyValue: r.PathValue("pk"),
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if affected == 0 {
+		writeError(w, r, errRecordNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,392 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+	"wuffnetCMS/auth"
+	"wuffnetCMS/metrics"
+	"wuffnetCMS/models"
+)
+
+// Höchstens so viele fällige Einträge je Durchlauf des Schedulers
+const scheduleBatch = 100
+
+// unpublishSchedule ist ein Live-Datensatz, der zu UnpublishAt aus seiner Tabelle genommen wird
+type unpublishSchedule struct {
+	Schema        string    `json:"schema"`
+	Table         string    `json:"table"`
+	RecordKey     string    `json:"recordKey"`
+	UnpublishAt   time.Time `json:"unpublishAt"`
+	ScheduleError *string   `json:"scheduleError"`
+}
+
+// SetDraftSchedule legt fest, wann ein Entwurf nach der Freigabe frühestens veröffentlicht und wann der
+// Datensatz wieder aus der Tabelle genommen wird; null entfernt den jeweiligen Zeitpunkt.
+// Ein freigegebener Entwurf geht ohne Scope publish bei einer Änderung zurück in die Prüfung.
+func SetDraftSchedule(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	annotate(r, "schedule_draft", "", "")
+	id, err := draftID(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var request struct {
+		PublishAt   *time.Time `json:"publishAt"`
+		UnpublishAt *time.Time `json:"unpublishAt"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, r, badRequest("Invalid input"))
+		return
+	}
+	if request.PublishAt != nil && request.UnpublishAt != nil && !request.UnpublishAt.After(*request.PublishAt) {
+		writeError(w, r, fieldError("unpublishAt", CodeCheck, "unpublishAt must be after publishAt"))
+		return
+	}
+
+	var draft *Draft
+	ctx := r.Context()
+	err = withStatementTimeout(ctx, db, EndpointSave, false, func(tx Queryer) error {
+		existing, err := loadDraft(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return errDraftNotFound
+		}
+		annotate(r, "schedule_draft", existing.Schema, existing.Table)
+		if existing.Status == statusPublished {
+			return newError(http.StatusConflict, CodeConflict, "Published drafts cannot be rescheduled")
+		}
+
+		query := &sqlBuilder{}
+		query.SQL("UPDATE ").MetaTable("drafts").SQL(" SET publish_at = ").Arg(request.PublishAt).
+			SQL(", unpublish_at = ").Arg(request.UnpublishAt)
+		// Der Zeitplan ist Teil der Freigabe: ändert ihn jemand ohne Scope publish, muss der Entwurf erneut geprüft werden
+		if existing.Status == statusApproved && !auth.Allowed(ctx, auth.ScopePublish) &&
+			(!sameTime(existing.PublishAt, request.PublishAt) || !sameTime(existing.UnpublishAt, request.UnpublishAt)) {
+			query.SQL(", status = ").Arg(statusDraft).SQL(", reviewed_by = NULL, reviewed_at = NULL")
+		}
+		query.SQL(", schedule_error = NULL, updated_at = now() WHERE id = ").Arg(id).
+			SQL(" RETURNING " + draftColumns)
+		if draft, err = scanDraft(tx.QueryRowContext(ctx, query.String(), query.Args()...)); err != nil {
+			return fmt.Errorf("failed to schedule draft: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, draft)
+}
+
+// sameTime vergleicht zwei optionale Zeitpunkte
+func sameTime(a, b *time.Time) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && a.Equal(*b))
+}
+
+// SetRecordSchedule legt fest, wann ein Live-Datensatz einer Tabelle mit Freigabe-Workflow aus der Tabelle
+// genommen wird; unpublishAt null entfernt den Zeitplan
+func SetRecordSchedule(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	annotate(r, "schedule_row", r.PathValue("schema"), r.PathValue("table"))
+	table, ok := resourceKeyTable(db, w, r)
+	if !ok {
+		return
+	}
+	var request struct {
+		UnpublishAt *time.Time `json:"unpublishAt"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, r, badRequest("Invalid input"))
+		return
+	}
+
+	ctx := r.Context()
+	err := withStatementTimeout(ctx, db, EndpointSave, false, func(tx Queryer) error {
+		if workflow, err := workflowEnabled(ctx, tx, table); err != nil {
+			return err
+		} else if !workflow {
+			return newError(http.StatusConflict, CodeConflict, "Table does not use the publishing workflow")
+		}
+		live, err := selectOne(ctx, tx, table, table.Column(table.PrimaryKey), r.PathValue("pk"))
+		if err != nil {
+			return err
+		}
+		if live == nil {
+			return errRecordNotFound
+		}
+		return scheduleUnpublish(ctx, tx, table, recordKey(live[table.PrimaryKey]), request.UnpublishAt, currentUser(ctx))
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListSchedules liefert die geplanten Veröffentlichungen (Entwürfe mit publishAt) und Entfernungen,
+// optional nach schema und table gefiltert, jeweils die nächsten zuerst
+func ListSchedules(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	annotate(r, "list_schedules", params.Get("schema"), params.Get("table"))
+	filter := func(query *sqlBuilder) error {
+		if err := filterSchema(query, "table_schema", params.Get("schema")); err != nil {
+			return err
+		}
+		if table := params.Get("table"); table != "" {
+			query.SQL(" AND table_name = ").Arg(table)
+		}
+		return nil
+	}
+
+	publish := []*Draft{}
+	unpublish := []unpublishSchedule{}
+	ctx := r.Context()
+	err := withStatementTimeout(ctx, db, EndpointContent, true, func(tx Queryer) error {
+		query := &sqlBuilder{}
+		query.SQL("SELECT " + draftColumns + " FROM ").MetaTable("drafts").
+			SQL(" WHERE publish_at IS NOT NULL AND status IN (").Arg(statusDraft).SQL(", ").Arg(statusApproved).SQL(", ").Arg(statusRejected).SQL(")")
+		if err := filter(query); err != nil {
+			return err
+		}
+		query.SQL(" ORDER BY publish_at")
+		rows, err := tx.QueryContext(ctx, query.String(), query.Args()...)
+		if err != nil {
+			return fmt.Errorf("failed to list scheduled drafts: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			draft, err := scanDraft(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan draft: %w", err)
+			}
+			publish = append(publish, draft)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		query = &sqlBuilder{}
+		query.SQL("SELECT table_schema, table_name, record_key, unpublish_at, schedule_error FROM ").MetaTable("unpublish_schedules").SQL(" WHERE true")
+		if err := filter(query); err != nil {
+			return err
+		}
+		query.SQL(" ORDER BY unpublish_at")
+		rows, err = tx.QueryContext(ctx, query.String(), query.Args()...)
+		if err != nil {
+			return fmt.Errorf("failed to list unpublish schedules: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var schedule unpublishSchedule
+			var scheduleError sql.NullString
+			if err := rows.Scan(&schedule.Schema, &schedule.Table, &schedule.RecordKey, &schedule.UnpublishAt, &scheduleError); err != nil {
+				return fmt.Errorf("failed to scan unpublish schedule: %w", err)
+			}
+			if scheduleError.Valid {
+				schedule.ScheduleError = &scheduleError.String
+			}
+			unpublish = append(unpublish, schedule)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"publish": publish, "unpublish": unpublish})
+}
+
+// scheduleUnpublish setzt bzw. entfernt (at nil) den Zeitpunkt, zu dem ein Live-Datensatz aus der Tabelle genommen wird
+func scheduleUnpublish(ctx context.Context, db Queryer, table *models.Table, key string, at *time.Time, createdBy interface{}) error {
+	query := &sqlBuilder{}
+	if at == nil {
+		query.SQL("DELETE FROM ").MetaTable("unpublish_schedules").
+			SQL(" WHERE table_schema = ").Arg(table.Schema).SQL(" AND table_name = ").Arg(table.Name).SQL(" AND record_key = ").Arg(key)
+	} else {
+		query.SQL("INSERT INTO ").MetaTable("unpublish_schedules").SQL(" (table_schema, table_name, record_key, unpublish_at, created_by) VALUES (").
+			Arg(table.Schema).SQL(", ").Arg(table.Name).SQL(", ").Arg(key).SQL(", ").Arg(*at).SQL(", ").Arg(createdBy).
+			SQL(") ON CONFLICT (table_schema, table_name, record_key) DO UPDATE SET unpublish_at = EXCLUDED.unpublish_at, schedule_error = NULL")
+	}
+	if _, err := db.ExecContext(ctx, query.String(), query.Args()...); err != nil {
+		return fmt.Errorf("failed to save unpublish schedule: %w", err)
+	}
+	return nil
+}
+
+// RunSchedules veröffentlicht fällige freigegebene Entwürfe und nimmt fällige Datensätze aus ihren Tabellen.
+// Jeder Eintrag läuft in einer eigenen Transaktion; ein Fehler wird am Eintrag vermerkt und nicht wiederholt,
+// bis der Zeitplan neu gesetzt wird.
+func RunSchedules(ctx context.Context, db *sql.DB) error {
+	if err := publishDue(ctx, db); err != nil {
+		return err
+	}
+	return unpublishDue(ctx, db)
+}
+
+func publishDue(ctx context.Context, db *sql.DB) error {
+	query := &sqlBuilder{}
+	query.SQL("SELECT id FROM ").MetaTable("drafts").
+		SQL(" WHERE status = ").Arg(statusApproved).SQL(" AND publish_at <= now() AND schedule_error IS NULL ORDER BY publish_at LIMIT ").Arg(scheduleBatch)
+	rows, err := db.QueryContext(ctx, query.String(), query.Args()...)
+	if err != nil {
+		return fmt.Errorf("failed to read due drafts: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan draft id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		var published bool
+		err := withStatementTimeout(ctx, db, EndpointSave, false, func(tx Queryer) error {
+			draft, err := loadDraft(ctx, tx, id)
+			// Inzwischen geändert, abgelehnt oder von Hand veröffentlicht
+			if err != nil || draft == nil || draft.Status != statusApproved || draft.PublishAt == nil || draft.PublishAt.After(time.Now()) {
+				return err
+			}
+			published = true
+			return publishDraftTx(ctx, tx, draft)
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Scheduled publishing failed", "draft_id", id, "error", err)
+			query := &sqlBuilder{}
+			query.SQL("UPDATE ").MetaTable("drafts").SQL(" SET schedule_error = ").Arg(toAPIError(err).Message).SQL(" WHERE id = ").Arg(id)
+			if _, err := db.ExecContext(ctx, query.String(), query.Args()...); err != nil {
+				return fmt.Errorf("failed to record schedule error: %w", err)
+			}
+			continue
+		}
+		if published {
+			slog.InfoContext(ctx, "Published scheduled draft", "draft_id", id)
+		}
+	}
+	return nil
+}
+
+func unpublishDue(ctx context.Context, db *sql.DB) error {
+	query := &sqlBuilder{}
+	query.SQL("SELECT table_schema, table_name, record_key FROM ").MetaTable("unpublish_schedules").
+		SQL(" WHERE unpublish_at <= now() AND schedule_error IS NULL ORDER BY unpublish_at LIMIT ").Arg(scheduleBatch)
+	rows, err := db.QueryContext(ctx, query.String(), query.Args()...)
+	if err != nil {
+		return fmt.Errorf("failed to read due unpublish schedules: %w", err)
+	}
+	var due []unpublishSchedule
+	for rows.Next() {
+		var schedule unpublishSchedule
+		if err := rows.Scan(&schedule.Schema, &schedule.Table, &schedule.RecordKey); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan unpublish schedule: %w", err)
+		}
+		due = append(due, schedule)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, schedule := range due {
+		logger := slog.With("schema", schedule.Schema, "table", schedule.Table, "record_key", schedule.RecordKey)
+		var unpublished bool
+		err := withStatementTimeout(ctx, db, EndpointSave, false, func(tx Queryer) error {
+			var err error
+			unpublished, err = unpublishRecord(ctx, tx, schedule)
+			return err
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			logger.ErrorContext(ctx, "Scheduled unpublishing failed", "error", err)
+			query := &sqlBuilder{}
+			query.SQL("UPDATE ").MetaTable("unpublish_schedules").SQL(" SET schedule_error = ").Arg(toAPIError(err).Message).
+				SQL(" WHERE table_schema = ").Arg(schedule.Schema).SQL(" AND table_name = ").Arg(schedule.Table).
+				SQL(" AND record_key = ").Arg(schedule.RecordKey)
+			if _, err := db.ExecContext(ctx, query.String(), query.Args()...); err != nil {
+				return fmt.Errorf("failed to record schedule error: %w", err)
+			}
+			continue
+		}
+		if unpublished {
+			logger.InfoContext(ctx, "Unpublished scheduled record")
+		}
+	}
+	return nil
+}
+
+// unpublishRecord nimmt einen fälligen Datensatz aus der Tabelle. Sein Inhalt bleibt als Entwurf mit Status
+// unpublished erhalten, damit er überarbeitet und erneut veröffentlicht werden kann.
+func unpublishRecord(ctx context.Context, tx Queryer, schedule unpublishSchedule) (bool, error) {
+	// Ist der Eintrag schon weg oder verschoben, hat ihn eine andere Transaktion erledigt bzw. geändert
+	query := &sqlBuilder{}
+	query.SQL("DELETE FROM ").MetaTable("unpublish_schedules").
+		SQL(" WHERE table_schema = ").Arg(schedule.Schema).SQL(" AND table_name = ").Arg(schedule.Table).
+		SQL(" AND record_key = ").Arg(schedule.RecordKey).SQL(" AND unpublish_at <= now() RETURNING created_by")
+	var createdBy sql.NullInt64
+	err := tx.QueryRowContext(ctx, query.String(), query.Args()...).Scan(&createdBy)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to remove unpublish schedule: %w", err)
+	}
+
+	table, err := resolveTable(ctx, tx, schedule.Schema, schedule.Table)
+	if err != nil {
+		return false, err
+	}
+	primaryKey, err := resolvePrimaryKey(table, table.PrimaryKey)
+	if err != nil {
+		return false, err
+	}
+	live, err := selectOne(ctx, tx, table, primaryKey, schedule.RecordKey)
+	if err != nil || live == nil {
+		return false, err
+	}
+
+	columns := make([]RecordColumn, 0, len(table.Columns))
+	for _, col := range table.Columns {
+		columns = append(columns, RecordColumn{Name: col.Name, Value: live[col.Name]})
+	}
+	encoded, err := json.Marshal(columns)
+	if err != nil {
+		return false, err
+	}
+	query = &sqlBuilder{}
+	query.SQL("INSERT INTO ").MetaTable("drafts").SQL(" (table_schema, table_name, data, status, comment, created_by) VALUES (").
+		Arg(table.Schema).SQL(", ").Arg(table.Name).SQL(", ").Arg(string(encoded)).SQL(", ").Arg(statusUnpublished).
+		SQL(", ").Arg("Unpublished by schedule").SQL(", ").Arg(createdBy).SQL(")")
+	if _, err := tx.ExecContext(ctx, query.String(), query.Args()...); err != nil {
+		return false, fmt.Errorf("failed to archive record: %w", err)
+	}
+
+	query = &sqlBuilder{}
+	query.SQL("DELETE FROM ").Table(table).SQL(" WHERE ").Column(primaryKey).SQL(" = ").Arg(schedule.RecordKey)
+	if _, err := tx.ExecContext(ctx, query.String(), query.Args()...); err != nil {
+		return false, fmt.Errorf("failed to unpublish record: %w", err)
+	}
+	if err := recordChanged(ctx, tx, opDelete, table, schedule.RecordKey); err != nil {
+		return false, err
+	}
+	metrics.RecordChange(opDelete, table.Schema, table.Name)
+	return true, nil
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"strconv"
+	"strings"
+	"wuffnetCMS/models"
+
+	"github.com/lib/pq"
+)
+
+// sqlBuilder setzt alle dynamischen Statements der Controller zusammen. Bezeichner stammen
+// ausschließlich aus dem Katalog (bzw. dem geprüften Metadaten-Schema) und werden immer gequotet,
+// Werte werden immer als $n-Parameter übergeben. SQL nimmt nur konstante Schlüsselwörter auf.
+type sqlBuilder struct {
+	sb   strings.Builder
+	args []interface{}
+}
+
+// SQL hängt festen SQL-Text an; niemals Eingaben des Clients
+func (b *sqlBuilder) SQL(text string) *sqlBuilder {
+	b.sb.WriteString(text)
+	return b
+}
+
+// Table hängt schema.tabelle einer Katalogtabelle an
+func (b *sqlBuilder) Table(table *models.Table) *sqlBuilder {
+	b.sb.WriteString(pq.QuoteIdentifier(table.Schema) + "." + pq.QuoteIdentifier(table.Name))
+	return b
+}
+
+// MetaTable hängt eine CMS-eigene Tabelle im Metadaten-Schema an
+func (b *sqlBuilder) MetaTable(name string) *sqlBuilder {
+	b.sb.WriteString(pq.QuoteIdentifier(MetadataSchema) + "." + pq.QuoteIdentifier(name))
+	return b
+}
+
+// Column hängt eine Spalte einer Katalogtabelle an
+func (b *sqlBuilder) Column(column *models.Column) *sqlBuilder {
+	b.sb.WriteString(pq.QuoteIdentifier(column.Name))
+	return b
+}
+
+// Columns hängt eine kommagetrennte Spaltenliste an
+func (b *sqlBuilder) Columns(columns []*models.Column) *sqlBuilder {
+	for i, column := range columns {
+		if i > 0 {
+			b.sb.WriteString(", ")
+		}
+		b.Column(column)
+	}
+	return b
+}
+
+// Arg übergibt einen Wert als Parameter; sqlDefault wird als DEFAULT eingesetzt
+func (b *sqlBuilder) Arg(value interface{}) *sqlBuilder {
+	if value == sqlDefault {
+		b.sb.WriteString("DEFAULT")
+		return b
+	}
+	b.args = append(b.args, value)
+	b.sb.WriteString("$" + strconv.Itoa(len(b.args)))
+	return b
+}
+
+// Order hängt ASC oder DESC an; alles außer "desc" gilt als aufsteigend
+func (b *sqlBuilder) Order(order string) *sqlBuilder {
+	if strings.EqualFold(order, "desc") {
+		return b.SQL(" DESC")
+	}
+	return b.SQL(" ASC")
+}
+
+func (b *sqlBuilder) String() string {
+	return b.sb.String()
+}
+
+func (b *sqlBuilder) Args() []interface{} {
+	return b.args
+}
+
+// sqlDefault steht für das Schlüsselwort DEFAULT anstelle eines Parameters
+var sqlDefault = struct{ name string }{"DEFAULT"}
@@ -0,0 +1,381 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+	"wuffnetCMS/models"
+)
+
+// MetadataSchema ist das Schema für die CMS-eigenen Tabellen (Migrationen, Regeln usw.)
+var MetadataSchema = "cms"
+
+// Zusätzliche Codes für Feldfehler aus der Validierung
+const (
+	CodeTooLong  = "too_long"
+	CodeTooShort = "too_short"
+	CodeRange    = "out_of_range"
+	CodePattern  = "pattern"
+	CodeEmail    = "email"
+	CodeURL      = "url"
+)
+
+// ColumnRule ist eine von Administratoren gepflegte Zusatzregel aus <MetadataSchema>.column_rules
+type ColumnRule struct {
+	Rule     string `json:"rule"` // regex, email, url, range
+	Argument string `json:"argument,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// FieldConstraints sind die aus Katalog und Zusatzregeln abgeleiteten Vorgaben für ein Formularfeld
+type FieldConstraints struct {
+	Required  bool     `json:"required"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+	MinLength *int     `json:"minLength,omitempty"`
+	Min       *float64 `json:"min,omitempty"`
+	Max       *float64 `json:"max,omitempty"`
+	Pattern   string   `json:"pattern,omitempty"`
+	Format    string   `json:"format,omitempty"` // email oder url
+	Unique    bool     `json:"unique,omitempty"`
+
+	// Nur serverseitig ausgewertet
+	generated bool // Wert vergibt ausschließlich die Datenbank
+	patterns  []fieldPattern
+	formats   []ColumnRule
+}
+
+type fieldPattern struct {
+	re      *regexp.Regexp
+	message string
+}
+
+var (
+	emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+	// Teile eines CHECK-Constraints wie `price >= 0` oder `char_length(title) <= 80`
+	checkBound = regexp.MustCompile(`^(char_length|length)?\s*"?([^"\s<>=]+)"?\s*(>=|>|<=|<)\s*(-?[0-9]+(?:\.[0-9]+)?)$`)
+	// CHECK-Constraint mit genau einem regulären Ausdruck: CHECK ((code ~ '^[A-Z]+$'::text))
+	checkPattern = regexp.MustCompile(`^CHECK \(+"?([^"\s)]+)"?\)?(?:::[a-z ]+)?\s+~\s+'((?:[^']|'')*)'(?:::text)?\)+$`)
+	checkCasts   = regexp.MustCompile(`::(?:character varying|double precision|[a-z_]+)`)
+)
+
+// loadColumnRules liest die Zusatzregeln einer Tabelle, gruppiert nach Spalte
+func loadColumnRules(ctx context.Context, db Queryer, schema, table string) (map[string][]ColumnRule, error) {
+	query := &sqlBuilder{}
+	query.SQL("SELECT column_name, rule, COALESCE(argument, ''), COALESCE(message, '') FROM ").MetaTable("column_rules").
+		SQL(" WHERE table_schema = ").Arg(schema).SQL(" AND table_name = ").Arg(table).SQL(" ORDER BY id")
+
+	rows, err := db.QueryContext(ctx, query.String(), query.Args()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read column rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := map[string][]ColumnRule{}
+	for rows.Next() {
+		var column string
+		var rule ColumnRule
+		if err := rows.Scan(&column, &rule.Rule, &rule.Argument, &rule.Message); err != nil {
+			return nil, fmt.Errorf("failed to scan column rules: %w", err)
+		}
+		rules[column] = append(rules[column], rule)
+	}
+	return rules, rows.Err()
+}
+
+// tableConstraints leitet für jede Spalte die Vorgaben aus Katalog und Zusatzregeln ab
+func tableConstraints(table *models.Table, rules map[string][]ColumnRule) map[string]*FieldConstraints {
+	constraints := map[string]*FieldConstraints{}
+	for _, col := range table.Columns {
+		c := &FieldConstraints{
+			// Der Primärschlüssel wird in der Regel von der Datenbank vergeben
+			Required:  !col.IsNullable && !col.HasDefault && col.Name != table.PrimaryKey,
+			MaxLength: col.MaxLength,
+			Unique:    col.Unique,
+			generated: col.Generated || col.Identity == "ALWAYS",
+		}
+
+		switch strings.ToLower(col.DataType) {
+		case "smallint":
+			c.Min, c.Max = floatPtr(math.MinInt16), floatPtr(math.MaxInt16)
+		case "integer":
+			c.Min, c.Max = floatPtr(math.MinInt32), floatPtr(math.MaxInt32)
+		case "numeric":
+			if col.NumericPrecision != nil && col.NumericScale != nil {
+				limit := math.Pow10(*col.NumericPrecision-*col.NumericScale) - math.Pow10(-*col.NumericScale)
+				c.Min, c.Max = floatPtr(-limit), floatPtr(limit)
+			}
+		}
+
+		for _, check := range col.Checks {
+			applyCheck(c, col.Name, check)
+		}
+		for _, rule := range rules[col.Name] {
+			applyRule(c, rule)
+		}
+		constraints[col.Name] = c
+	}
+	return constraints
+}
+
+// applyCheck übernimmt einfache CHECK-Constraints (Bereiche, Längen, Muster); alle übrigen prüft nur die Datenbank
+func applyCheck(c *FieldConstraints, column, definition string) {
+	if match := checkPattern.FindStringSubmatch(definition); match != nil && match[1] == column {
+		source := strings.ReplaceAll(match[2], "''", "'")
+		if re, err := regexp.Compile(source); err == nil {
+			c.patterns = append(c.patterns, fieldPattern{re: re})
+			if c.Pattern == "" {
+				c.Pattern = source
+			}
+		}
+		return
+	}
+
+	// Nur reine UND-Verknüpfungen ohne Zeichenketten auswerten
+	if strings.Contains(definition, "'") || strings.Contains(definition, " OR ") {
+		return
+	}
+	body := strings.TrimPrefix(definition, "CHECK ")
+	body = checkCasts.ReplaceAllString(body, "")
+	body = strings.NewReplacer("(", " ", ")", " ").Replace(body)
+
+	for _, part := range strings.Split(body, " AND ") {
+		part = strings.Join(strings.Fields(part), " ")
+		// Ohne Klammern steht hier z. B. `price >= 0` oder `char_length title <= 80`
+		match := checkBound.FindStringSubmatch(part)
+		if match == nil || match[2] != column {
+			continue
+		}
+		value, err := strconv.ParseFloat(match[4], 64)
+		if err != nil {
+			continue
+		}
+		if match[1] != "" {
+			length := int(value)
+			switch match[3] {
+			case ">":
+				length++
+				c.MinLength = maxInt(c.MinLength, length)
+			case ">=":
+				c.MinLength = maxInt(c.MinLength, length)
+			case "<":
+				length--
+				c.MaxLength = minInt(c.MaxLength, length)
+			case "<=":
+				c.MaxLength = minInt(c.MaxLength, length)
+			}
+			continue
+		}
+		// Echte Ungleichungen werden für die Formularvorgabe wie >= bzw. <= behandelt
+		switch match[3] {
+		case ">", ">=":
+			if c.Min == nil || *c.Min < value {
+				c.Min = floatPtr(value)
+			}
+		case "<", "<=":
+			if c.Max == nil || *c.Max > value {
+				c.Max = floatPtr(value)
+			}
+		}
+	}
+}
+
+func applyRule(c *FieldConstraints, rule ColumnRule) {
+	switch rule.Rule {
+	case "regex":
+		re, err := regexp.Compile(rule.Argument)
+		if err != nil {
+			return
+		}
+		c.patterns = append(c.patterns, fieldPattern{re: re, message: rule.Message})
+		if c.Pattern == "" {
+			c.Pattern = rule.Argument
+		}
+	case "email", "url":
+		c.formats = append(c.formats, rule)
+		c.Format = rule.Rule
+	case "range":
+		lower, upper, _ := strings.Cut(rule.Argument, ",")
+		if value, err := strconv.ParseFloat(strings.TrimSpace(lower), 64); err == nil {
+			c.Min = floatPtr(value)
+		}
+		if value, err := strconv.ParseFloat(strings.TrimSpace(upper), 64); err == nil {
+			c.Max = floatPtr(value)
+		}
+	}
+}
+
+// validateRecord prüft die übergebenen Werte gegen die Vorgaben der Tabelle, bevor SQL ausgeführt wird.
+// Beim Anlegen müssen alle Pflichtfelder vorhanden sein, beim Aktualisieren nur die übergebenen.
+func validateRecord(ctx context.Context, db Queryer, table *models.Table, data *SaveRequest, isUpdate bool, primaryKeyValue interface{}) error {
+	rules, err := loadColumnRules(ctx, db, table.Schema, table.Name)
+	if err != nil {
+		return err
+	}
+	constraints := tableConstraints(table, rules)
+
+	var fields []FieldError
+	given := map[string]bool{}
+	for _, column := range data.Columns {
+		given[column.Name] = true
+		if column.Name == data.PrimaryKey {
+			continue
+		}
+		c, ok := constraints[column.Name]
+		if !ok || c.generated {
+			continue
+		}
+		if fieldErr := validateValue(column.Name, column.Value, c); fieldErr != nil {
+			fields = append(fields, *fieldErr)
+			continue
+		}
+		if c.Unique && !isEmpty(column.Value) {
+			taken, err := valueTaken(ctx, db, table, column.Name, column.Value, primaryKeyValue, isUpdate)
+			if err != nil {
+				return err
+			}
+			if taken {
+				fields = append(fields, FieldError{Field: column.Name, Code: CodeUnique, Message: "Value already exists"})
+			}
+		}
+	}
+
+	if !isUpdate {
+		for _, col := range table.Columns {
+			if constraints[col.Name].Required && !given[col.Name] {
+				fields = append(fields, FieldError{Field: col.Name, Code: CodeRequired, Message: "Value is required"})
+			}
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &APIError{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    CodeValidation,
+		Message: "Validation failed",
+		Fields:  fields,
+	}
+}
+
+func validateValue(name string, value interface{}, c *FieldConstraints) *FieldError {
+	if isEmpty(value) {
+		if c.Required {
+			return &FieldError{Field: name, Code: CodeRequired, Message: "Value is required"}
+		}
+		return nil
+	}
+
+	text, isText := value.(string)
+	if isText {
+		length := utf8.RuneCountInString(text)
+		if c.MaxLength != nil && length > *c.MaxLength {
+			return &FieldError{Field: name, Code: CodeTooLong, Message: fmt.Sprintf("Value must not exceed %d characters", *c.MaxLength)}
+		}
+		if c.MinLength != nil && length < *c.MinLength {
+			return &FieldError{Field: name, Code: CodeTooShort, Message: fmt.Sprintf("Value must have at least %d characters", *c.MinLength)}
+		}
+		for _, pattern := range c.patterns {
+			if !pattern.re.MatchString(text) {
+				return &FieldError{Field: name, Code: CodePattern, Message: messageOr(pattern.message, "Value does not match the required pattern")}
+			}
+		}
+		for _, format := range c.formats {
+			if format.Rule == "email" && !emailPattern.MatchString(text) {
+				return &FieldError{Field: name, Code: CodeEmail, Message: messageOr(format.Message, "Value is not a valid e-mail address")}
+			}
+			if format.Rule == "url" && !validURL(text) {
+				return &FieldError{Field: name, Code: CodeURL, Message: messageOr(format.Message, "Value is not a valid URL")}
+			}
+		}
+	}
+
+	if c.Min != nil || c.Max != nil {
+		var number float64
+		var err error
+		switch v := value.(type) {
+		case float64:
+			number = v
+		case int:
+			number = float64(v)
+		case string:
+			number, err = strconv.ParseFloat(strings.Replace(v, ",", ".", 1), 64)
+		default:
+			err = fmt.Errorf("not a number")
+		}
+		// Nicht-numerische Werte prüft die Typkonvertierung bzw. die Datenbank
+		if err == nil {
+			if c.Min != nil && number < *c.Min {
+				return &FieldError{Field: name, Code: CodeRange, Message: fmt.Sprintf("Value must be at least %v", *c.Min)}
+			}
+			if c.Max != nil && number > *c.Max {
+				return &FieldError{Field: name, Code: CodeRange, Message: fmt.Sprintf("Value must be at most %v", *c.Max)}
+			}
+		}
+	}
+	return nil
+}
+
+// valueTaken prüft einen eindeutigen Index vorab, damit der Fehler dem Feld zugeordnet werden kann.
+// Der Vergleich nutzt den Typ der Spalte und damit den Index; gleichzeitige Speichervorgänge
+// fängt erst der Constraint ab (unique_violation, siehe translatePQError).
+func valueTaken(ctx context.Context, db Queryer, table *models.Table, column string, value, primaryKeyValue interface{}, isUpdate bool) (bool, error) {
+	col, err := resolveColumn(table, column)
+	if err != nil {
+		return false, err
+	}
+	query := &sqlBuilder{}
+	query.SQL("SELECT EXISTS (SELECT 1 FROM ").Table(table).
+		SQL(" WHERE ").Column(col).SQL(" = ").Arg(value)
+	if primaryKey := table.Column(table.PrimaryKey); isUpdate && primaryKey != nil {
+		query.SQL(" AND ").Column(primaryKey).SQL(" <> ").Arg(primaryKeyValue)
+	}
+	query.SQL(")")
+
+	var taken bool
+	if err := db.QueryRowContext(ctx, query.String(), query.Args()...).Scan(&taken); err != nil {
+		return false, fmt.Errorf("failed to check unique value: %w", err)
+	}
+	return taken, nil
+}
+
+func validURL(value string) bool {
+	u, err := url.ParseRequestURI(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func isEmpty(value interface{}) bool {
+	return value == nil || value == ""
+}
+
+func messageOr(message, fallback string) string {
+	if message != "" {
+		return message
+	}
+	return fallback
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+func maxInt(current *int, value int) *int {
+	if current != nil && *current >= value {
+		return current
+	}
+	return &value
+}
+
+func minInt(current *int, value int) *int {
+	if current != nil && *current <= value {
+		return current
+	}
+	return &value
+}
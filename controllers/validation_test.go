@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+	"wuffnetCMS/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func intPtr(value int) *int {
+	return &value
+}
+
+func equalPtr[T comparable](got, want *T) bool {
+	return (got == nil && want == nil) || (got != nil && want != nil && *got == *want)
+}
+
+// Definitionen wie sie pg_get_constraintdef liefert
+func TestApplyCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		column     string
+		definition string
+		min, max   *float64
+		minLength  *int
+		maxLength  *int
+		pattern    string
+	}{
+		{"lower bound with cast", "price", "CHECK ((price >= (0)::numeric))", floatPtr(0), nil, nil, nil, ""},
+		{"strict bounds", "qty", "CHECK (((qty > 0) AND (qty < 100)))", floatPtr(0), floatPtr(100), nil, nil, ""},
+		{"quoted literal ignored", "temp", "CHECK ((temp >= '-40.5'::numeric))", nil, nil, nil, nil, ""},
+		{"negative bound", "delta", "CHECK ((delta >= -10))", floatPtr(-10), nil, nil, nil, ""},
+		{"quoted column", "Price", `CHECK (("Price" <= (999)::numeric))`, nil, floatPtr(999), nil, nil, ""},
+		{"max length", "title", "CHECK ((char_length((title)::text) <= 80))", nil, nil, nil, intPtr(80), ""},
+		{"strict lengths", "title", "CHECK (((length(title) > 2) AND (length(title) < 81)))", nil, nil, intPtr(3), intPtr(80), ""},
+		{"pattern", "code", "CHECK ((code ~ '^[A-Z]+$'::text))", nil, nil, nil, nil, "^[A-Z]+$"},
+		{"pattern on varchar", "code", "CHECK (((code)::text ~ '^[a-z]{2}$'::text))", nil, nil, nil, nil, "^[a-z]{2}$"},
+		{"pattern with quote", "name", `CHECK ((name ~ '^[^'']+$'::text))`, nil, nil, nil, nil, "^[^']+$"},
+		{"other column", "price", "CHECK ((discount >= 0))", nil, nil, nil, nil, ""},
+		{"disjunction ignored", "price", "CHECK (((price > 0) OR (price IS NULL)))", nil, nil, nil, nil, ""},
+		{"enumeration ignored", "status", "CHECK ((status = ANY (ARRAY['draft'::text, 'live'::text])))", nil, nil, nil, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &FieldConstraints{}
+			applyCheck(c, tt.column, tt.definition)
+			if !equalPtr(c.Min, tt.min) || !equalPtr(c.Max, tt.max) {
+				t.Errorf("range = %v..%v, want %v..%v", deref(c.Min), deref(c.Max), deref(tt.min), deref(tt.max))
+			}
+			if !equalPtr(c.MinLength, tt.minLength) || !equalPtr(c.MaxLength, tt.maxLength) {
+				t.Errorf("length = %v..%v, want %v..%v", deref(c.MinLength), deref(c.MaxLength), deref(tt.minLength), deref(tt.maxLength))
+			}
+			if c.Pattern != tt.pattern {
+				t.Errorf("pattern = %q, want %q", c.Pattern, tt.pattern)
+			}
+		})
+	}
+}
+
+func deref[T any](value *T) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+func TestTableConstraints(t *testing.T) {
+	table := &models.Table{Schema: "public", Name: "products", PrimaryKey: "id", Columns: []models.Column{
+		{Name: "id", DataType: "integer", Identity: "ALWAYS", HasDefault: true},
+		{Name: "title", DataType: "character varying", MaxLength: intPtr(100), Checks: []string{"CHECK ((char_length((title)::text) <= 80))"}},
+		{Name: "price", DataType: "numeric", NumericPrecision: intPtr(5), NumericScale: intPtr(2), Checks: []string{"CHECK ((price >= (0)::numeric))"}},
+		{Name: "stock", DataType: "smallint", IsNullable: true},
+		{Name: "sku", DataType: "text", Unique: true, HasDefault: true},
+		{Name: "slug", DataType: "text", Generated: true, HasDefault: true},
+	}}
+	constraints := tableConstraints(table, map[string][]ColumnRule{
+		"stock": {{Rule: "range", Argument: "0, 500"}},
+	})
+
+	if c := constraints["id"]; c.Required || !c.generated {
+		t.Errorf("id: required = %v, generated = %v", c.Required, c.generated)
+	}
+	if c := constraints["title"]; !c.Required || *c.MaxLength != 80 {
+		t.Errorf("title: required = %v, maxLength = %v", c.Required, deref(c.MaxLength))
+	}
+	if c := constraints["price"]; *c.Min != 0 || *c.Max != 999.99 {
+		t.Errorf("price: range = %v..%v, want 0..999.99", *c.Min, *c.Max)
+	}
+	if c := constraints["stock"]; c.Required || *c.Min != 0 || *c.Max != 500 {
+		t.Errorf("stock: required = %v, range = %v..%v", c.Required, *c.Min, *c.Max)
+	}
+	if c := constraints["sku"]; c.Required || !c.Unique {
+		t.Errorf("sku: required = %v, unique = %v", c.Required, c.Unique)
+	}
+	if c := constraints["slug"]; !c.generated {
+		t.Error("slug: generated column not marked")
+	}
+}
+
+func TestColumnRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []ColumnRule
+		value interface{}
+		code  string // leer = gültig
+		msg   string
+	}{
+		{"regex match", []ColumnRule{{Rule: "regex", Argument: `^\d{5}$`}}, "12345", "", ""},
+		{"regex mismatch", []ColumnRule{{Rule: "regex", Argument: `^\d{5}$`}}, "1234", CodePattern, "Value does not match the required pattern"},
+		{"regex custom message", []ColumnRule{{Rule: "regex", Argument: `^\d{5}$`, Message: "Five digits"}}, "abc", CodePattern, "Five digits"},
+		{"invalid regex ignored", []ColumnRule{{Rule: "regex", Argument: `(`}}, "anything", "", ""},
+		{"email valid", []ColumnRule{{Rule: "email"}}, "alice@example.org", "", ""},
+		{"email invalid", []ColumnRule{{Rule: "email"}}, "alice@example", CodeEmail, "Value is not a valid e-mail address"},
+		{"url valid", []ColumnRule{{Rule: "url"}}, "https://example.org/path", "", ""},
+		{"url without scheme", []ColumnRule{{Rule: "url"}}, "example.org", CodeURL, "Value is not a valid URL"},
+		{"url other scheme", []ColumnRule{{Rule: "url", Message: "Web address only"}}, "ftp://example.org", CodeURL, "Web address only"},
+		{"range inside", []ColumnRule{{Rule: "range", Argument: "1,10"}}, 5.0, "", ""},
+		{"range below", []ColumnRule{{Rule: "range", Argument: "1,10"}}, 0.5, CodeRange, "Value must be at least 1"},
+		{"range above as text", []ColumnRule{{Rule: "range", Argument: "1, 10"}}, "10,5", CodeRange, "Value must be at most 10"},
+		{"range upper only", []ColumnRule{{Rule: "range", Argument: ",5"}}, -100.0, "", ""},
+		{"range not a number", []ColumnRule{{Rule: "range", Argument: "1,10"}}, "abc", "", ""},
+		{"empty value skips rules", []ColumnRule{{Rule: "email"}}, "", "", ""},
+		{"unknown rule ignored", []ColumnRule{{Rule: "uppercase"}}, "abc", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &FieldConstraints{}
+			for _, rule := range tt.rules {
+				applyRule(c, rule)
+			}
+			fieldErr := validateValue("field", tt.value, c)
+			switch {
+			case tt.code == "" && fieldErr != nil:
+				t.Errorf("unexpected error %+v", *fieldErr)
+			case tt.code != "" && fieldErr == nil:
+				t.Errorf("expected %s error", tt.code)
+			case tt.code != "" && (fieldErr.Code != tt.code || fieldErr.Message != tt.msg || fieldErr.Field != "field"):
+				t.Errorf("error = %+v, want %s %q", *fieldErr, tt.code, tt.msg)
+			}
+		})
+	}
+}
+
+func TestValueTakenComparesTyped(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	table := &models.Table{Schema: "public", Name: "products", PrimaryKey: "id", Columns: []models.Column{
+		{Name: "id", DataType: "integer"},
+		{Name: "ean", DataType: "bigint", Unique: true},
+	}}
+
+	// Kein CAST auf text, damit der eindeutige Index genutzt wird; der Wert behält seinen Typ
+	query := regexp.QuoteMeta(`SELECT EXISTS (SELECT 1 FROM "public"."products" WHERE "ean" = $1 AND "id" <> $2)`)
+	mock.ExpectQuery(query).WithArgs(4006381333931.0, 7.0).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	taken, err := valueTaken(context.Background(), db, table, "ean", 4006381333931.0, 7.0, true)
+	if err != nil || !taken {
+		t.Errorf("valueTaken = %v, %v", taken, err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE "ean" = $1)`)).WithArgs("4006381333931").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	taken, err = valueTaken(context.Background(), db, table, "ean", "4006381333931", nil, false)
+	if err != nil || taken {
+		t.Errorf("valueTaken = %v, %v", taken, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Zwischen Vorabprüfung und Speichern kann ein anderer Request denselben Wert schreiben;
+// der Constraint-Fehler muss dann ebenfalls dem Feld zugeordnet werden
+func TestUniqueViolationMapsToField(t *testing.T) {
+	err := toAPIError(&pq.Error{
+		Code:   "23505",
+		Detail: `Key (ean)=(4006381333931) already exists.`,
+	})
+	if err.Status != http.StatusConflict || len(err.Fields) != 1 || err.Fields[0].Field != "ean" || err.Fields[0].Code != CodeUnique {
+		t.Errorf("toAPIError = %+v", err)
+	}
+}
@@ -0,0 +1,460 @@
+package controllers
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	"wuffnetCMS/models"
+	"wuffnetCMS/webhooks"
+
+	"github.com/lib/pq"
+)
+
+// Webhooks enthält die konfigurierten Webhooks und Regeln für Zustellversuche; ohne Webhooks entstehen keine Zustellungen
+var Webhooks webhooks.Options
+
+// Status einer Zustellung: pending wartet auf den (nächsten) Versuch, failed hat alle Versuche aufgebraucht
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+)
+
+var deliveryStatuses = []string{deliveryPending, deliveryDelivered, deliveryFailed}
+
+// Zustellungen je Durchlauf des Schedulers
+const webhookBatch = 100
+
+// WebhookDelivery ist eine Zustellung aus der Outbox
+type WebhookDelivery struct {
+	ID            int64      `json:"id"`
+	Webhook       string     `json:"webhook"`
+	Event         string     `json:"event"`
+	Schema        string     `json:"schema"`
+	Table         string     `json:"table"`
+	RecordKey     *string    `json:"recordKey"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"` // Versuche seit dem Anlegen bzw. dem letzten redeliver
+	NextAttemptAt time.Time  `json:"nextAttemptAt"`
+	LastStatus    *int       `json:"lastStatus"` // HTTP-Status des letzten Versuchs, nil ohne Antwort
+	LastError     *string    `json:"lastError"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	DeliveredAt   *time.Time `json:"deliveredAt"`
+
+	// Nur in der Einzelansicht: der zugestellte Inhalt und alle Versuche
+	Payload    json.RawMessage  `json:"payload,omitempty"`
+	AttemptLog []WebhookAttempt `json:"attemptLog,omitempty"`
+}
+
+// WebhookAttempt ist ein Eintrag im Protokoll der Zustellversuche
+type WebhookAttempt struct {
+	AttemptedAt time.Time `json:"attemptedAt"`
+	Status      *int      `json:"status"`
+	Error       *string   `json:"error"`
+	DurationMs  int64     `json:"durationMs"`
+}
+
+// webhookPayload ist der Inhalt einer Zustellung
+type webhookPayload struct {
+	Event      string                 `json:"event"`
+	Schema     string                 `json:"schema"`
+	Table      string                 `json:"table"`
+	Key        string                 `json:"key,omitempty"`
+	Record     map[string]interface{} `json:"record"` // Datensatz nach der Änderung, nil beim Löschen
+	OccurredAt time.Time              `json:"occurredAt"`
+}
+
+const deliveryColumns = "id, webhook, event, table_schema, table_name, record_key, status, attempts, next_attempt_at, " +
+	"last_status, last_error, created_at, delivered_at"
+
+var errDeliveryNotFound = newError(http.StatusNotFound, CodeNotFound, "Webhook delivery not found")
+
+// scanDelivery liest eine Zustellung in der Spaltenfolge von deliveryColumns, gefolgt von den Spalten für extra
+func scanDelivery(row rowScanner, extra ...interface{}) (*WebhookDelivery, error) {
+	d := &WebhookDelivery{}
+	var recordKey, lastError sql.NullString
+	var lastStatus sql.NullInt64
+	var deliveredAt sql.NullTime
+	dest := []interface{}{&d.ID, &d.Webhook, &d.Event, &d.Schema, &d.Table, &recordKey, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&lastStatus, &lastError, &d.CreatedAt, &deliveredAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	if recordKey.Valid {
+		d.RecordKey = &recordKey.String
+	}
+	if lastStatus.Valid {
+		status := int(lastStatus.Int64)
+		d.LastStatus = &status
+	}
+	if lastError.Valid {
+		d.LastError = &lastError.String
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return d, nil
+}
+
+// enqueueWebhooks legt innerhalb der Transaktion der Änderung je passendem Webhook eine Zustellung an;
+// wird die Transaktion zurückgerollt, entfallen auch die Zustellungen
+func enqueueWebhooks(ctx context.Context, tx Queryer, operation string, table *models.Table, key interface{}) error {
+	names := []string{}
+	for _, endpoint := range Webhooks.Endpoints {
+		if endpoint.Matches(operation, table.Schema, table.Name) {
+			names = append(names, endpoint.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	payload := webhookPayload{Event: operation, Schema: table.Schema, Table: table.Name, OccurredAt: time.Now().UTC()}
+	if key != nil {
+		payload.Key = recordKey(key)
+	}
+	if operation != opDelete && key != nil {
+		primaryKey, err := resolvePrimaryKey(table, table.PrimaryKey)
+		if err != nil {
+			return err
+		}
+		if payload.Record, err = selectOne(ctx, tx, table, primaryKey, key); err != nil {
+			return err
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	query := &sqlBuilder{}
+	query.SQL("INSERT INTO ").MetaTable("webhook_deliveries").SQL(" (webhook, event, table_schema, table_name, record_key, payload)").
+		SQL(" SELECT name, ").Arg(operation).SQL("::text, ").Arg(table.Schema).SQL("::text, ").Arg(table.Name).
+		SQL("::text, NULLIF(").Arg(payload.Key).SQL("::text, ''), ").Arg(string(body)).SQL("::jsonb FROM unnest(").
+		Arg(pq.Array(names)).SQL("::text[]) AS name")
+	if _, err := tx.ExecContext(ctx, query.String(), query.Args()...); err != nil {
+		return fmt.Errorf("failed to enqueue webhooks: %w", err)
+	}
+	return nil
+}
+
+// dueDelivery ist eine fällige Zustellung mit dem Inhalt, der unverändert gesendet und signiert wird
+type dueDelivery struct {
+	ID       int64
+	Webhook  string
+	Event    string
+	Payload  []byte
+	Attempts int
+}
+
+// DeliverWebhooks stellt fällige Zustellungen zu und räumt das Protokoll auf; läuft als Job des Schedulers.
+// Die Webhooks werden parallel beliefert, die Zustellungen eines Webhooks nacheinander. Scheitert ein Versuch,
+// wartet der Rest dieses Webhooks auf den nächsten Durchlauf, damit ein ausgefallenes Ziel nicht den Job aufhält.
+func DeliverWebhooks(ctx context.Context, db *sql.DB) error {
+	if Webhooks.Retention > 0 {
+		query := &sqlBuilder{}
+		query.SQL("DELETE FROM ").MetaTable("webhook_deliveries").SQL(" WHERE status <> ").Arg(deliveryPending).
+			SQL(" AND created_at < now() - make_interval(secs => ").Arg(Webhooks.Retention.Seconds()).SQL(")")
+		if _, err := db.ExecContext(ctx, query.String(), query.Args()...); err != nil {
+			return fmt.Errorf("failed to purge webhook deliveries: %w", err)
+		}
+	}
+
+	query := &sqlBuilder{}
+	query.SQL("SELECT id, webhook, event, payload::text, attempts FROM ").MetaTable("webhook_deliveries").
+		SQL(" WHERE status = ").Arg(deliveryPending).SQL(" AND next_attempt_at <= now() ORDER BY id LIMIT ").Arg(webhookBatch)
+	rows, err := db.QueryContext(ctx, query.String(), query.Args()...)
+	if err != nil {
+		return fmt.Errorf("failed to read due webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+	byWebhook := map[string][]dueDelivery{}
+	for rows.Next() {
+		var d dueDelivery
+		if err := rows.Scan(&d.ID, &d.Webhook, &d.Event, &d.Payload, &d.Attempts); err != nil {
+			return fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		byWebhook[d.Webhook] = append(byWebhook[d.Webhook], d)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(byWebhook))
+	for _, due := range byWebhook {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, d := range due {
+				delivered, err := deliverWebhook(ctx, db, d)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !delivered || ctx.Err() != nil {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	var all []error
+	for err := range errs {
+		all = append(all, err)
+	}
+	return errors.Join(all...)
+}
+
+// deliverWebhook sendet eine Zustellung, protokolliert den Versuch und plant bei einem Fehlschlag den nächsten
+func deliverWebhook(ctx context.Context, db *sql.DB, d dueDelivery) (bool, error) {
+	endpoint, ok := Webhooks.Endpoint(d.Webhook)
+	if !ok {
+		// Aus der Konfiguration entfernt; ein erneuter Versuch kann nicht mehr gelingen
+		query := &sqlBuilder{}
+		query.SQL("UPDATE ").MetaTable("webhook_deliveries").SQL(" SET status = ").Arg(deliveryFailed).
+			SQL(", last_error = ").Arg("Webhook is no longer configured").SQL(" WHERE id = ").Arg(d.ID)
+		if _, err := db.ExecContext(ctx, query.String(), query.Args()...); err != nil {
+			return false, fmt.Errorf("failed to update webhook delivery: %w", err)
+		}
+		return true, nil
+	}
+
+	started := time.Now()
+	status, sendErr := Webhooks.Send(ctx, endpoint, d.ID, d.Event, d.Payload)
+	if ctx.Err() != nil {
+		// Beim Herunterfahren abgebrochen; zählt nicht als Versuch
+		return false, nil
+	}
+	duration := time.Since(started).Milliseconds()
+	attempts := d.Attempts + 1
+
+	next, lastStatus, lastError := deliveryDelivered, sql.NullInt64{Int64: int64(status), Valid: status != 0}, sql.NullString{}
+	if sendErr != nil {
+		lastError = sql.NullString{String: sendErr.Error(), Valid: true}
+		next = deliveryPending
+		if attempts >= Webhooks.MaxAttempts {
+			next = deliveryFailed
+		}
+		slog.Warn("Webhook delivery failed", "webhook", d.Webhook, "delivery", d.ID, "attempt", attempts,
+			"final", next == deliveryFailed, "error", sendErr)
+	}
+
+	err := withStatementTimeout(ctx, db, EndpointSave, false, func(tx Queryer) error {
+		query := &sqlBuilder{}
+		query.SQL("INSERT INTO ").MetaTable("webhook_attempts").SQL(" (delivery_id, status, error, duration_ms) VALUES (").
+			Arg(d.ID).SQL(", ").Arg(lastStatus).SQL(", ").Arg(lastError).SQL(", ").Arg(duration).SQL(")")
+		if _, err := tx.ExecContext(ctx, query.String(), query.Args()...); err != nil {
+			return fmt.Errorf("failed to log webhook attempt: %w", err)
+		}
+
+		// Ein zwischenzeitliches redeliver setzt attempts zurück und gewinnt
+		query = &sqlBuilder{}
+		query.SQL("UPDATE ").MetaTable("webhook_deliveries").SQL(" SET status = ").Arg(next).
+			SQL(", attempts = ").Arg(attempts).SQL(", last_status = ").Arg(lastStatus).SQL(", last_error = ").Arg(lastError).
+			SQL(", next_attempt_at = now() + make_interval(secs => ").Arg(Webhooks.Delay(attempts).Seconds()).SQL(")")
+		if next == deliveryDelivered {
+			query.SQL(", delivered_at = now()")
+		}
+		query.SQL(" WHERE id = ").Arg(d.ID).SQL(" AND status = ").Arg(deliveryPending).SQL(" AND attempts = ").Arg(d.Attempts)
+		if _, err := tx.ExecContext(ctx, query.String(), query.Args()...); err != nil {
+			return fmt.Errorf("failed to update webhook delivery: %w", err)
+		}
+		return nil
+	})
+	return sendErr == nil, err
+}
+
+// ListWebhooks liefert die konfigurierten Webhooks ohne ihre Secrets
+func ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	annotate(r, "list_webhooks", "", "")
+	endpoints := Webhooks.Endpoints
+	if endpoints == nil {
+		endpoints = []webhooks.Endpoint{}
+	}
+	writeJSON(w, http.StatusOK, endpoints)
+}
+
+// ListWebhookDeliveries liefert das Protokoll der Zustellungen, neueste zuerst, optional nach webhook, status,
+// schema und table gefiltert
+func ListWebhookDeliveries(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	annotate(r, "list_webhook_deliveries", params.Get("schema"), params.Get("table"))
+
+	query := &sqlBuilder{}
+	query.SQL("SELECT " + deliveryColumns + " FROM ").MetaTable("webhook_deliveries").SQL(" WHERE true")
+	if webhook := params.Get("webhook"); webhook != "" {
+		query.SQL(" AND webhook = ").Arg(webhook)
+	}
+	if status := params.Get("status"); status != "" {
+		if !slices.Contains(deliveryStatuses, status) {
+			writeError(w, r, badRequest("Invalid status parameter"))
+			return
+		}
+		query.SQL(" AND status = ").Arg(status)
+	}
+	if err := filterSchema(query, "table_schema", params.Get("schema")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if table := params.Get("table"); table != "" {
+		query.SQL(" AND table_name = ").Arg(table)
+	}
+	limit, err := strconv.Atoi(cmp.Or(params.Get("limit"), "100"))
+	if err != nil || limit < 0 {
+		writeError(w, r, badRequest("Invalid limit parameter"))
+		return
+	}
+	offset, err := strconv.Atoi(cmp.Or(params.Get("offset"), "0"))
+	if err != nil || offset < 0 {
+		writeError(w, r, badRequest("Invalid offset parameter"))
+		return
+	}
+	query.SQL(" ORDER BY id DESC LIMIT ").Arg(limit).SQL(" OFFSET ").Arg(offset)
+
+	deliveries := []*WebhookDelivery{}
+	ctx := r.Context()
+	err = withStatementTimeout(ctx, db, EndpointContent, true, func(tx Queryer) error {
+		rows, err := tx.QueryContext(ctx, query.String(), query.Args()...)
+		if err != nil {
+			return fmt.Errorf("failed to list webhook deliveries: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			delivery, err := scanDelivery(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan webhook delivery: %w", err)
+			}
+			deliveries = append(deliveries, delivery)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+// GetWebhookDelivery liefert eine Zustellung mit Inhalt und allen Versuchen
+func GetWebhookDelivery(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	annotate(r, "read_webhook_delivery", "", "")
+	id, err := deliveryID(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var delivery *WebhookDelivery
+	ctx := r.Context()
+	err = withStatementTimeout(ctx, db, EndpointContent, true, func(tx Queryer) error {
+		query := &sqlBuilder{}
+		query.SQL("SELECT " + deliveryColumns + ", payload FROM ").MetaTable("webhook_deliveries").SQL(" WHERE id = ").Arg(id)
+		var payload []byte
+		delivery, err = scanDelivery(tx.QueryRowContext(ctx, query.String(), query.Args()...), &payload)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errDeliveryNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read webhook delivery: %w", err)
+		}
+		// Wie in der Liste: Zustellungen verborgener Schemas gibt es nach außen nicht
+		if !schemaVisible(delivery.Schema) {
+			return errDeliveryNotFound
+		}
+		delivery.Payload = payload
+
+		query = &sqlBuilder{}
+		query.SQL("SELECT attempted_at, status, error, duration_ms FROM ").MetaTable("webhook_attempts").
+			SQL(" WHERE delivery_id = ").Arg(id).SQL(" ORDER BY attempted_at")
+		rows, err := tx.QueryContext(ctx, query.String(), query.Args()...)
+		if err != nil {
+			return fmt.Errorf("failed to read webhook attempts: %w", err)
+		}
+		defer rows.Close()
+		delivery.AttemptLog = []WebhookAttempt{}
+		for rows.Next() {
+			var attempt WebhookAttempt
+			var status sql.NullInt64
+			var message sql.NullString
+			if err := rows.Scan(&attempt.AttemptedAt, &status, &message, &attempt.DurationMs); err != nil {
+				return fmt.Errorf("failed to scan webhook attempt: %w", err)
+			}
+			if status.Valid {
+				code := int(status.Int64)
+				attempt.Status = &code
+			}
+			if message.Valid {
+				attempt.Error = &message.String
+			}
+			delivery.AttemptLog = append(delivery.AttemptLog, attempt)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, delivery)
+}
+
+// RedeliverWebhook stellt eine Zustellung mit ihrem ursprünglichen Inhalt erneut zu, auch eine bereits
+// erfolgreiche oder gescheiterte. Sie wird beim nächsten Durchlauf des Schedulers gesendet, mit allen Versuchen.
+func RedeliverWebhook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	annotate(r, "redeliver_webhook", "", "")
+	id, err := deliveryID(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var delivery *WebhookDelivery
+	ctx := r.Context()
+	err = withStatementTimeout(ctx, db, EndpointSave, false, func(tx Queryer) error {
+		query := &sqlBuilder{}
+		query.SQL("SELECT webhook, table_schema FROM ").MetaTable("webhook_deliveries").SQL(" WHERE id = ").Arg(id).SQL(" FOR UPDATE")
+		var webhook, schema string
+		if err := tx.QueryRowContext(ctx, query.String(), query.Args()...).Scan(&webhook, &schema); errors.Is(err, sql.ErrNoRows) || (err == nil && !schemaVisible(schema)) {
+			return errDeliveryNotFound
+		} else if err != nil {
+			return fmt.Errorf("failed to read webhook delivery: %w", err)
+		}
+		if _, ok := Webhooks.Endpoint(webhook); !ok {
+			return newError(http.StatusConflict, CodeConflict, fmt.Sprintf("Webhook %q is no longer configured", webhook))
+		}
+
+		query = &sqlBuilder{}
+		query.SQL("UPDATE ").MetaTable("webhook_deliveries").SQL(" SET status = ").Arg(deliveryPending).
+			SQL(", attempts = 0, next_attempt_at = now(), delivered_at = NULL WHERE id = ").Arg(id).
+			SQL(" RETURNING " + deliveryColumns)
+		delivery, err = scanDelivery(tx.QueryRowContext(ctx, query.String(), query.Args()...))
+		if err != nil {
+			return fmt.Errorf("failed to schedule redelivery: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, delivery)
+}
+
+func deliveryID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return 0, badRequest("Invalid delivery id")
+	}
+	return id, nil
+}
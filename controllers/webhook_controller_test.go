@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// Zustellungen verborgener Schemas fehlen in der Liste und sind auch über ihre ID nicht erreichbar
+func TestWebhookDeliveryHiddenSchema(t *testing.T) {
+	defer func(hidden []string) { HiddenSchemas = hidden }(HiddenSchemas)
+	HiddenSchemas = []string{"audit"}
+
+	deliveryRow := func(schema string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "webhook", "event", "table_schema", "table_name", "record_key", "status", "attempts", "next_attempt_at",
+			"last_status", "last_error", "created_at", "delivered_at", "payload"}).
+			AddRow(5, "search", "update", schema, "posts", "7", "delivered", 1, time.Now(), 200, nil, time.Now(), time.Now(), []byte(`{}`))
+	}
+	selectDelivery := regexp.QuoteMeta(`FROM "cms"."webhook_deliveries" WHERE id = $1`)
+
+	tests := []struct {
+		name    string
+		handler func(db *sql.DB, w http.ResponseWriter, r *http.Request)
+		method  string
+		expect  func(mock sqlmock.Sqlmock)
+		status  int
+	}{
+		{"get visible", GetWebhookDelivery, http.MethodGet, func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(selectDelivery).WithArgs(5).WillReturnRows(deliveryRow("public"))
+			mock.ExpectQuery(regexp.QuoteMeta(`FROM "cms"."webhook_attempts"`)).WithArgs(5).
+				WillReturnRows(sqlmock.NewRows([]string{"attempted_at", "status", "error", "duration_ms"}))
+			mock.ExpectCommit()
+		}, http.StatusOK},
+		{"get hidden", GetWebhookDelivery, http.MethodGet, func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(selectDelivery).WithArgs(5).WillReturnRows(deliveryRow("audit"))
+			mock.ExpectRollback()
+		}, http.StatusNotFound},
+		{"redeliver hidden", RedeliverWebhook, http.MethodPost, func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(selectDelivery).WithArgs(5).
+				WillReturnRows(sqlmock.NewRows([]string{"webhook", "table_schema"}).AddRow("search", "audit"))
+			mock.ExpectRollback()
+		}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			mock.ExpectBegin()
+			tt.expect(mock)
+
+			r := httptest.NewRequest(tt.method, "/api/webhooks/deliveries/5", nil)
+			r.SetPathValue("id", "5")
+			rec := httptest.NewRecorder()
+			tt.handler(db, rec, r)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
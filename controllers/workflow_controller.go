@@ -0,0 +1,566 @@
+package controllers
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+	"wuffnetCMS/auth"
+	"wuffnetCMS/metrics"
+	"wuffnetCMS/models"
+
+	"github.com/lib/pq"
+)
+
+// Status eines Entwurfs: draft wartet auf Prüfung, rejected geht zur Überarbeitung zurück,
+// unpublished enthält einen vom Scheduler aus der Tabelle genommenen Datensatz
+const (
+	statusDraft       = "draft"
+	statusApproved    = "approved"
+	statusRejected    = "rejected"
+	statusPublished   = "published"
+	statusUnpublished = "unpublished"
+)
+
+var draftStatuses = []string{statusDraft, statusApproved, statusRejected, statusPublished, statusUnpublished}
+
+// Ansichten von GetTableContent: live zeigt die Tabelle, draft zusätzlich die offenen Entwürfe
+const (
+	viewLive  = "live"
+	viewDraft = "draft"
+)
+
+// Draft ist eine noch nicht veröffentlichte Änderung an einer Tabelle mit Freigabe-Workflow
+type Draft struct {
+	ID          int64          `json:"id"`
+	Schema      string         `json:"schema"`
+	Table       string         `json:"table"`
+	RecordKey   *string        `json:"recordKey"` // Primärschlüssel des Live-Datensatzes; nil bei neuen bis zur Veröffentlichung
+	Columns     []RecordColumn `json:"columns"`
+	Status      string         `json:"status"`
+	Comment     *string        `json:"comment"` // Anmerkung der Prüfung, z. B. Grund einer Ablehnung
+	CreatedBy   *int64         `json:"createdBy"`
+	ReviewedBy  *int64         `json:"reviewedBy"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+	ReviewedAt  *time.Time     `json:"reviewedAt"`
+	PublishedAt *time.Time     `json:"publishedAt"`
+
+	// Zeitplan, siehe schedule_controller.go
+	PublishAt     *time.Time `json:"publishAt"`   // Frühester Zeitpunkt der Veröffentlichung nach Freigabe
+	UnpublishAt   *time.Time `json:"unpublishAt"` // Wird beim Veröffentlichen für den Live-Datensatz übernommen
+	ScheduleError *string    `json:"scheduleError"`
+}
+
+const draftColumns = "id, table_schema, table_name, record_key, data, status, comment, created_by, reviewed_by, " +
+	"created_at, updated_at, reviewed_at, published_at, publish_at, unpublish_at, schedule_error"
+
+var errDraftNotFound = newError(http.StatusNotFound, CodeNotFound, "Draft not found")
+
+// rowScanner wird von *sql.Row und *sql.Rows erfüllt
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanDraft liest einen Entwurf in der Spaltenfolge von draftColumns
+func scanDraft(row rowScanner) (*Draft, error) {
+	d := &Draft{}
+	var data []byte
+	var recordKey, comment, scheduleError sql.NullString
+	var createdBy, reviewedBy sql.NullInt64
+	var reviewedAt, publishedAt, publishAt, unpublishAt sql.NullTime
+	err := row.Scan(&d.ID, &d.Schema, &d.Table, &recordKey, &data, &d.Status, &comment, &createdBy, &reviewedBy,
+		&d.CreatedAt, &d.UpdatedAt, &reviewedAt, &publishedAt, &publishAt, &unpublishAt, &scheduleError)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &d.Columns); err != nil {
+		return nil, fmt.Errorf("invalid draft data: %w", err)
+	}
+	if recordKey.Valid {
+		d.RecordKey = &recordKey.String
+	}
+	if comment.Valid {
+		d.Comment = &comment.String
+	}
+	if createdBy.Valid {
+		d.CreatedBy = &createdBy.Int64
+	}
+	if reviewedBy.Valid {
+		d.ReviewedBy = &reviewedBy.Int64
+	}
+	if reviewedAt.Valid {
+		d.ReviewedAt = &reviewedAt.Time
+	}
+	if publishedAt.Valid {
+		d.PublishedAt = &publishedAt.Time
+	}
+	if publishAt.Valid {
+		d.PublishAt = &publishAt.Time
+	}
+	if unpublishAt.Valid {
+		d.UnpublishAt = &unpublishAt.Time
+	}
+	if scheduleError.Valid {
+		d.ScheduleError = &scheduleError.String
+	}
+	return d, nil
+}
+
+// workflowEnabled prüft, ob Änderungen an der Tabelle als Entwurf gespeichert werden
+func workflowEnabled(ctx context.Context, db Queryer, table *models.Table) (bool, error) {
+	query := &sqlBuilder{}
+	query.SQL("SELECT EXISTS (SELECT 1 FROM ").MetaTable("workflow_tables").
+		SQL(" WHERE table_schema = ").Arg(table.Schema).SQL(" AND table_name = ").Arg(table.Name).SQL(")")
+
+	var enabled bool
+	if err := db.QueryRowContext(ctx, query.String(), query.Args()...).Scan(&enabled); err != nil {
+		return false, fmt.Errorf("failed to read workflow tables: %w", err)
+	}
+	return enabled, nil
+}
+
+// recordKey bildet den Primärschlüssel als Text, so wie er in drafts.record_key steht
+func recordKey(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		// Zahlen aus JSON ohne Exponentenschreibweise
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// currentUser liefert die ID des angemeldeten Benutzers für created_by und reviewed_by, nil ohne Anmeldung
+func currentUser(ctx context.Context) interface{} {
+	if p := auth.FromContext(ctx); p != nil {
+		return p.UserID
+	}
+	return nil
+}
+
+// loadDraft liest einen Entwurf und sperrt ihn bis zum Ende der Transaktion; nil, wenn es ihn nicht gibt
+func loadDraft(ctx context.Context, db Queryer, id int64) (*Draft, error) {
+	query := &sqlBuilder{}
+	query.SQL("SELECT " + draftColumns + " FROM ").MetaTable("drafts").SQL(" WHERE id = ").Arg(id).SQL(" FOR UPDATE")
+	draft, err := scanDraft(db.QueryRowContext(ctx, query.String(), query.Args()...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read draft: %w", err)
+	}
+	return draft, nil
+}
+
+// openDraft liefert den offenen Entwurf eines Live-Datensatzes, nil wenn es keinen gibt
+func openDraft(ctx context.Context, db Queryer, table *models.Table, key string) (*Draft, error) {
+	query := &sqlBuilder{}
+	query.SQL("SELECT " + draftColumns + " FROM ").MetaTable("drafts").
+		SQL(" WHERE table_schema = ").Arg(table.Schema).SQL(" AND table_name = ").Arg(table.Name).
+		SQL(" AND record_key = ").Arg(key).SQL(" AND status <> ").Arg(statusPublished).SQL(" FOR UPDATE")
+	draft, err := scanDraft(db.QueryRowContext(ctx, query.String(), query.Args()...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read draft: %w", err)
+	}
+	return draft, nil
+}
+
+// saveDraft speichert eine Änderung als Entwurf statt in der Tabelle. Ein offener Entwurf desselben
+// Datensatzes (bzw. der per draftId genannte) wird ergänzt und wartet danach erneut auf Prüfung.
+func saveDraft(ctx context.Context, db Queryer, table *models.Table, data *SaveRequest, mode saveMode) (*Draft, error) {
+	primaryKey, err := resolvePrimaryKey(table, data.PrimaryKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var primaryKeyValue interface{}
+	isUpdate := mode == saveUpdate
+	for _, column := range data.Columns {
+		if table.Column(column.Name) == nil {
+			return nil, fieldError(column.Name, CodeUnknownColumn, fmt.Sprintf("Unknown column: %s", column.Name))
+		}
+		if column.Name == primaryKey.Name {
+			primaryKeyValue = column.Value
+			isUpdate = mode == saveUpdate || (mode == saveAuto && !isEmpty(primaryKeyValue))
+		}
+	}
+	if err := validateRecord(ctx, db, table, data, isUpdate, primaryKeyValue); err != nil {
+		return nil, err
+	}
+
+	var draft *Draft
+	var key interface{}
+	switch {
+	case data.DraftID != 0:
+		if draft, err = loadDraft(ctx, db, data.DraftID); err != nil {
+			return nil, err
+		}
+		if draft == nil || draft.Schema != table.Schema || draft.Table != table.Name {
+			return nil, errDraftNotFound
+		}
+	case isUpdate:
+		live, err := selectOne(ctx, db, table, primaryKey, primaryKeyValue)
+		if err != nil {
+			return nil, err
+		}
+		if live == nil {
+			return nil, errRecordNotFound
+		}
+		key = recordKey(primaryKeyValue)
+		if draft, err = openDraft(ctx, db, table, key.(string)); err != nil {
+			return nil, err
+		}
+	}
+
+	columns := data.Columns
+	query := &sqlBuilder{}
+	if draft == nil {
+		encoded, err := json.Marshal(columns)
+		if err != nil {
+			return nil, err
+		}
+		query.SQL("INSERT INTO ").MetaTable("drafts").SQL(" (table_schema, table_name, record_key, data, created_by) VALUES (").
+			Arg(table.Schema).SQL(", ").Arg(table.Name).SQL(", ").Arg(key).SQL(", ").Arg(string(encoded)).SQL(", ").Arg(currentUser(ctx)).
+			SQL(") RETURNING " + draftColumns)
+	} else {
+		if draft.Status == statusPublished {
+			return nil, newError(http.StatusConflict, CodeConflict, "Draft was already published")
+		}
+		encoded, err := json.Marshal(mergeColumns(draft.Columns, columns))
+		if err != nil {
+			return nil, err
+		}
+		query.SQL("UPDATE ").MetaTable("drafts").SQL(" SET data = ").Arg(string(encoded)).
+			SQL(", status = ").Arg(statusDraft).
+			SQL(", comment = NULL, reviewed_by = NULL, reviewed_at = NULL, updated_at = now() WHERE id = ").Arg(draft.ID).
+			SQL(" RETURNING " + draftColumns)
+	}
+
+	saved, err := scanDraft(db.QueryRowContext(ctx, query.String(), query.Args()...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save draft: %w", err)
+	}
+	return saved, nil
+}
+
+// mergeColumns übernimmt die neuen Werte in die Spalten eines bestehenden Entwurfs
+func mergeColumns(existing, changes []RecordColumn) []RecordColumn {
+	merged := slices.Clone(existing)
+	for _, change := range changes {
+		i := slices.IndexFunc(merged, func(column RecordColumn) bool { return column.Name == change.Name })
+		if i < 0 {
+			merged = append(merged, change)
+		} else {
+			merged[i].Value = change.Value
+		}
+	}
+	return merged
+}
+
+// applyDrafts überlagert die Datensätze einer Seite mit ihren offenen Entwürfen (markiert mit _draft)
+// und liefert die Entwürfe neuer Datensätze, die es in der Tabelle noch nicht gibt
+func applyDrafts(ctx context.Context, db Queryer, table *models.Table, rows []map[string]interface{}) ([]map[string]interface{}, error) {
+	byKey := map[string]map[string]interface{}{}
+	keys := []string{}
+	if table.PrimaryKey != "" {
+		for _, row := range rows {
+			key := recordKey(row[table.PrimaryKey])
+			byKey[key] = row
+			keys = append(keys, key)
+		}
+	}
+
+	query := &sqlBuilder{}
+	query.SQL("SELECT " + draftColumns + " FROM ").MetaTable("drafts").
+		SQL(" WHERE table_schema = ").Arg(table.Schema).SQL(" AND table_name = ").Arg(table.Name).
+		SQL(" AND status NOT IN (").Arg(statusPublished).SQL(", ").Arg(statusUnpublished).SQL(")").
+		SQL(" AND (record_key IS NULL OR record_key = ANY(").Arg(pq.Array(keys)).SQL(")) ORDER BY created_at")
+
+	result, err := db.QueryContext(ctx, query.String(), query.Args()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read drafts: %w", err)
+	}
+	defer result.Close()
+
+	created := []map[string]interface{}{}
+	for result.Next() {
+		draft, err := scanDraft(result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan draft: %w", err)
+		}
+		record := map[string]interface{}{}
+		if draft.RecordKey == nil {
+			created = append(created, record)
+		} else if record = byKey[*draft.RecordKey]; record == nil {
+			continue
+		}
+		for _, column := range draft.Columns {
+			record[column.Name] = column.Value
+		}
+		record["_draft"] = map[string]interface{}{"id": draft.ID, "status": draft.Status}
+	}
+	return created, result.Err()
+}
+
+// draftRecord liefert den Datensatz so, wie er nach Veröffentlichung des Entwurfs aussähe
+func draftRecord(ctx context.Context, db Queryer, table *models.Table, draft *Draft) (map[string]interface{}, error) {
+	record := map[string]interface{}{}
+	if draft.RecordKey != nil {
+		live, err := selectOne(ctx, db, table, table.Column(table.PrimaryKey), *draft.RecordKey)
+		if err != nil {
+			return nil, err
+		}
+		if live != nil {
+			record = live
+		}
+	}
+	for _, column := range draft.Columns {
+		record[column.Name] = column.Value
+	}
+	return record, nil
+}
+
+// ListDrafts liefert die Entwürfe, optional nach schema, table und status gefiltert; ohne status alle offenen
+func ListDrafts(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	annotate(r, "list_drafts", params.Get("schema"), params.Get("table"))
+
+	query := &sqlBuilder{}
+	query.SQL("SELECT " + draftColumns + " FROM ").MetaTable("drafts").SQL(" WHERE true")
+	if err := filterSchema(query, "table_schema", params.Get("schema")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if table := params.Get("table"); table != "" {
+		query.SQL(" AND table_name = ").Arg(table)
+	}
+	switch status := params.Get("status"); {
+	case status == "":
+		query.SQL(" AND status NOT IN (").Arg(statusPublished).SQL(", ").Arg(statusUnpublished).SQL(")")
+	case slices.Contains(draftStatuses, status):
+		query.SQL(" AND status = ").Arg(status)
+	default:
+		writeError(w, r, badRequest("Invalid status parameter"))
+		return
+	}
+	limit, err := strconv.Atoi(cmp.Or(params.Get("limit"), "100"))
+	if err != nil || limit < 0 {
+		writeError(w, r, badRequest("Invalid limit parameter"))
+		return
+	}
+	offset, err := strconv.Atoi(cmp.Or(params.Get("offset"), "0"))
+	if err != nil || offset < 0 {
+		writeError(w, r, badRequest("Invalid offset parameter"))
+		return
+	}
+	query.SQL(" ORDER BY updated_at DESC LIMIT ").Arg(limit).SQL(" OFFSET ").Arg(offset)
+
+	rows, err := db.QueryContext(r.Context(), query.String(), query.Args()...)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("failed to list drafts: %w", err))
+		return
+	}
+	defer rows.Close()
+
+	drafts := []*Draft{}
+	for rows.Next() {
+		draft, err := scanDraft(rows)
+		if err != nil {
+			writeError(w, r, fmt.Errorf("failed to scan draft: %w", err))
+			return
+		}
+		drafts = append(drafts, draft)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, drafts)
+}
+
+// GetDraft liefert einen Entwurf zusammen mit dem aktuellen Live-Datensatz (live, nil bei neuen Datensätzen)
+func GetDraft(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	annotate(r, "read_draft", "", "")
+	id, err := draftID(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var draft *Draft
+	var live map[string]interface{}
+	err = withStatementTimeout(r.Context(), db, EndpointContent, true, func(tx Queryer) error {
+		query := &sqlBuilder{}
+		query.SQL("SELECT " + draftColumns + " FROM ").MetaTable("drafts").SQL(" WHERE id = ").Arg(id)
+		var err error
+		if draft, err = scanDraft(tx.QueryRowContext(r.Context(), query.String(), query.Args()...)); errors.Is(err, sql.ErrNoRows) {
+			return errDraftNotFound
+		} else if err != nil {
+			return fmt.Errorf("failed to read draft: %w", err)
+		}
+		if draft.RecordKey == nil {
+			return nil
+		}
+		table, err := resolveTable(r.Context(), tx, draft.Schema, draft.Table)
+		if err != nil {
+			return err
+		}
+		live, err = selectOne(r.Context(), tx, table, table.Column(table.PrimaryKey), *draft.RecordKey)
+		return err
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"draft": draft, "live": live})
+}
+
+// ApproveDraft gibt einen Entwurf zur Veröffentlichung frei; Autoren können ihre eigenen Entwürfe nicht freigeben
+func ApproveDraft(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	reviewDraft(db, w, r, "approve_draft", func(ctx context.Context, tx Queryer, draft *Draft) (string, error) {
+		if draft.Status != statusDraft {
+			return "", newError(http.StatusConflict, CodeConflict, "Only drafts awaiting review can be approved")
+		}
+		if p := auth.FromContext(ctx); p != nil && draft.CreatedBy != nil && *draft.CreatedBy == p.UserID {
+			return "", newError(http.StatusForbidden, CodeForbidden, "Drafts cannot be approved by their author")
+		}
+		return statusApproved, nil
+	})
+}
+
+// RejectDraft schickt einen Entwurf mit Anmerkung zur Überarbeitung zurück
+func RejectDraft(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	reviewDraft(db, w, r, "reject_draft", func(ctx context.Context, tx Queryer, draft *Draft) (string, error) {
+		if draft.Status != statusDraft && draft.Status != statusApproved {
+			return "", newError(http.StatusConflict, CodeConflict, "Only open drafts can be rejected")
+		}
+		return statusRejected, nil
+	})
+}
+
+// PublishDraft überträgt einen freigegebenen Entwurf in derselben Transaktion in die Tabelle
+func PublishDraft(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	reviewDraft(db, w, r, "publish_draft", func(ctx context.Context, tx Queryer, draft *Draft) (string, error) {
+		if draft.Status != statusApproved {
+			return "", newError(http.StatusConflict, CodeConflict, "Only approved drafts can be published")
+		}
+		return statusPublished, publishDraftTx(ctx, tx, draft)
+	})
+}
+
+// publishDraftTx schreibt den Entwurf über saveRecordTx in die Tabelle, markiert ihn als veröffentlicht
+// und übernimmt unpublish_at für den Live-Datensatz
+func publishDraftTx(ctx context.Context, tx Queryer, draft *Draft) error {
+	table, err := resolveTable(ctx, tx, draft.Schema, draft.Table)
+	if err != nil {
+		return err
+	}
+	data := SaveRequest{Schema: table.Schema, Table: table.Name, PrimaryKey: table.PrimaryKey, Columns: draft.Columns}
+	mode := saveInsert
+	if draft.RecordKey != nil {
+		mode = saveUpdate
+		data.Columns = mergeColumns(data.Columns, []RecordColumn{{Name: table.PrimaryKey, Value: *draft.RecordKey}})
+	}
+	operation, err := saveRecordTx(ctx, tx, &data, mode)
+	if err != nil {
+		return err
+	}
+
+	for _, column := range data.Columns {
+		if column.Name == table.PrimaryKey {
+			key := recordKey(column.Value)
+			draft.RecordKey = &key
+		}
+	}
+	query := &sqlBuilder{}
+	query.SQL("UPDATE ").MetaTable("drafts").SQL(" SET status = ").Arg(statusPublished).
+		SQL(", record_key = ").Arg(*draft.RecordKey).
+		SQL(", schedule_error = NULL, published_at = now(), updated_at = now() WHERE id = ").Arg(draft.ID)
+	if _, err := tx.ExecContext(ctx, query.String(), query.Args()...); err != nil {
+		return fmt.Errorf("failed to mark draft as published: %w", err)
+	}
+	if draft.UnpublishAt != nil {
+		if err := scheduleUnpublish(ctx, tx, table, *draft.RecordKey, draft.UnpublishAt, draft.CreatedBy); err != nil {
+			return err
+		}
+	}
+	if err := recordChanged(ctx, tx, operation, table, *draft.RecordKey); err != nil {
+		return err
+	}
+	metrics.RecordChange(operation, table.Schema, table.Name)
+	return nil
+}
+
+// reviewDraft führt einen Prüfschritt in einer Transaktion aus: next entscheidet anhand des gesperrten
+// Entwurfs über den neuen Status, danach werden Status, Anmerkung und (außer beim Veröffentlichen) der Prüfer gespeichert
+func reviewDraft(db *sql.DB, w http.ResponseWriter, r *http.Request, operation string,
+	next func(ctx context.Context, tx Queryer, draft *Draft) (string, error)) {
+	annotate(r, operation, "", "")
+	id, err := draftID(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	// Der Body mit einer Anmerkung ist optional
+	var request struct {
+		Comment *string `json:"comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, badRequest("Invalid input"))
+		return
+	}
+
+	var reviewed *Draft
+	ctx := r.Context()
+	err = withStatementTimeout(ctx, db, EndpointSave, false, func(tx Queryer) error {
+		draft, err := loadDraft(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if draft == nil {
+			return errDraftNotFound
+		}
+		annotate(r, operation, draft.Schema, draft.Table)
+		status, err := next(ctx, tx, draft)
+		if err != nil {
+			return err
+		}
+
+		query := &sqlBuilder{}
+		query.SQL("UPDATE ").MetaTable("drafts").SQL(" SET status = ").Arg(status).
+			SQL(", comment = COALESCE(").Arg(request.Comment).SQL(", comment)")
+		if status != statusPublished {
+			query.SQL(", reviewed_by = ").Arg(currentUser(ctx)).SQL(", reviewed_at = now()")
+		}
+		query.SQL(", updated_at = now() WHERE id = ").Arg(id).SQL(" RETURNING " + draftColumns)
+		if reviewed, err = scanDraft(tx.QueryRowContext(ctx, query.String(), query.Args()...)); err != nil {
+			return fmt.Errorf("failed to update draft: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reviewed)
+}
+
+func draftID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return 0, badRequest("Invalid draft id")
+	}
+	return id, nil
+}
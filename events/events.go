@@ -0,0 +1,153 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Kanal für LISTEN/NOTIFY; das CMS und die Trigger-Funktion notify_change im Metadaten-Schema melden dorthin
+const Channel = "cms_changes"
+
+// Reload fordert die Clients auf, alles neu zu laden, z. B. nachdem die Verbindung zur Datenbank unterbrochen war
+const Reload = "reload"
+
+// Options legt fest, ob Änderungen an /api/events gemeldet werden
+type Options struct {
+	Enabled   bool          `yaml:"enabled"`
+	KeepAlive time.Duration `yaml:"keep_alive"` // Abstand der Kommentarzeilen, damit Proxys offene Streams nicht schließen
+}
+
+// Event ist eine Änderung an einem Datensatz
+type Event struct {
+	Type   string `json:"type"` // insert, update, delete oder reload
+	Schema string `json:"schema,omitempty"`
+	Table  string `json:"table,omitempty"`
+	Key    string `json:"key,omitempty"` // Primärschlüssel als Text, leer wenn unbekannt
+}
+
+// execer ist eine Verbindung oder Transaktion
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Notify meldet ein Ereignis über NOTIFY; innerhalb einer Transaktion stellt Postgres es erst mit dem Commit zu.
+// Die Nachricht entspricht Zeichen für Zeichen der von notify_change, damit Postgres doppelte Meldungen
+// derselben Transaktion (CMS und Trigger) zusammenfasst.
+func Notify(ctx context.Context, db execer, e Event) error {
+	_, err := db.ExecContext(ctx, `SELECT pg_notify($1, json_build_object(
+		'type', $2::text, 'schema', $3::text, 'table', $4::text, 'key', NULLIF($5::text, ''))::text)`,
+		Channel, e.Type, e.Schema, e.Table, e.Key)
+	if err != nil {
+		return fmt.Errorf("failed to notify change: %w", err)
+	}
+	return nil
+}
+
+// Broker verteilt die Ereignisse an die offenen Streams dieser Instanz
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	closed      bool
+}
+
+// Puffer je Stream; wer weiter zurückliegt, wird getrennt
+const bufferSize = 64
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: map[chan Event]struct{}{}}
+}
+
+// Subscribe liefert einen Kanal mit allen folgenden Ereignissen und eine Funktion zum Abmelden.
+// Kommt ein Stream nicht hinterher oder wird der Broker geschlossen, wird der Kanal geschlossen;
+// der Browser verbindet sich dann neu und lädt die Daten neu.
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, bufferSize)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subscribers[ch] = struct{}{}
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish gibt ein Ereignis an alle Streams weiter, ohne auf langsame zu warten
+func (b *Broker) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close beendet alle Streams, z. B. beim Herunterfahren, damit die Clients zu einer anderen Instanz wechseln
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Listen empfängt über LISTEN die Ereignisse aller Instanzen und Trigger und verteilt sie, bis ctx endet.
+// pq.Listener baut die Verbindung nach Abbrüchen selbst wieder auf; danach erhalten die Clients ein reload.
+func (b *Broker) Listen(ctx context.Context, dsn string) error {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+			slog.Warn("Change listener lost its database connection", "error", err)
+		case pq.ListenerEventReconnected:
+			slog.Info("Change listener reconnected")
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(Channel); err != nil {
+		return fmt.Errorf("failed to listen for changes: %w", err)
+	}
+
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// nil nach einem Neuaufbau der Verbindung; Meldungen dazwischen sind verloren
+			if n == nil {
+				b.Publish(Event{Type: Reload})
+				continue
+			}
+			var e Event
+			if err := json.Unmarshal([]byte(n.Extra), &e); err != nil || e.Type == "" {
+				slog.Warn("Ignoring malformed change notification", "payload", n.Extra, "error", err)
+				continue
+			}
+			b.Publish(e)
+		case <-ping.C:
+			// Eine still abgebrochene Verbindung fällt sonst erst beim nächsten NOTIFY auf
+			go listener.Ping()
+		}
+	}
+}
@@ -1,34 +1,176 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"wuffnetCMS/auth"
 	"wuffnetCMS/config"
+	"wuffnetCMS/controllers"
+	"wuffnetCMS/events"
+	"wuffnetCMS/metrics"
+	"wuffnetCMS/migrations"
 	"wuffnetCMS/routes"
+	"wuffnetCMS/scheduler"
+	"wuffnetCMS/tracing"
+	"wuffnetCMS/web"
 
 	"github.com/joho/godotenv"
 )
 
-func init() {
-	// Lädt die .env Datei
-	err := godotenv.Load(".env")
-	if err != nil {
+func main() {
+	args := os.Args[1:]
+
+	// "print-config" gibt die wirksame Konfiguration aus, ohne den Server zu starten
+	printConfig := len(args) > 0 && args[0] == "print-config"
+	if printConfig {
+		args = args[1:]
+	}
+
+	// Eine vorhandene .env Datei ergänzt die Umgebung, ist aber nicht mehr erforderlich
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, os.ErrNotExist) {
 		log.Fatalf("Fehler beim Laden der .env Datei: %v", err)
 	}
 
-}
+	cfg, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Could not load configuration: %v", err)
+	}
 
-func main() {
+	if printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	slog.SetDefault(config.NewLogger(cfg.Log, os.Stderr))
+	controllers.MetadataSchema = cfg.CMS.MetadataSchema
+	controllers.ExposedSchemas = cfg.CMS.ExposedSchemas
+	controllers.HiddenSchemas = cfg.CMS.HiddenSchemas
+	controllers.CatalogTTL = cfg.CMS.CatalogTTL
+	controllers.EditLockTTL = cfg.CMS.EditLockTTL
+	controllers.EventsKeepAlive = cfg.Events.KeepAlive
+	controllers.Webhooks = cfg.Webhooks
+	controllers.StatementTimeout = cfg.Database.StatementTimeout
+	controllers.StatementTimeouts = cfg.Database.StatementTimeouts
+	controllers.MaxQueryCost = cfg.Database.MaxQueryCost
 
-	db, err := config.ConnectDB()
+	// SIGINT/SIGTERM beenden den Start bzw. leiten das geordnete Herunterfahren ein
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing, os.Stdout)
 	if err != nil {
-		log.Fatalf("Could not connect to the database: %v", err)
+		fatal("Could not set up tracing", err)
+	}
+
+	db, err := config.ConnectDB(ctx, cfg.Database)
+	if err != nil {
+		fatal("Could not connect to the database", err)
 	}
 	defer db.Close()
+	metrics.RegisterDB(db)
+
+	// CMS-eigene Tabellen im Metadaten-Schema anlegen bzw. aktualisieren
+	if err := migrations.Apply(ctx, db, controllers.MetadataSchema); err != nil {
+		fatal("Could not apply migrations", err)
+	}
 
-	routes.SetupRoutes(db)
+	// Oberfläche ist eingebettet, außer für die Entwicklung ist ein Verzeichnis angegeben
+	assets, err := web.New(cfg.Server.AssetsDir)
+	if err != nil {
+		fatal("Could not load web assets", err)
+	}
+
+	// Ohne OIDC-Issuer bleibt die Anmeldung aus (authn ist dann nil)
+	authn, err := auth.New(ctx, db, controllers.MetadataSchema, cfg.Auth, cfg.RateLimit.Lockout)
+	if err != nil {
+		fatal("Could not set up login", err)
+	}
+
+	server := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           routes.SetupRoutes(db, assets, authn, cfg.CORS, cfg.RateLimit),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	// Zeitgesteuertes Veröffentlichen, Webhook-Zustellungen und Aufräumen laufen nur auf der Instanz, die den Scheduler-Lock hält
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		scheduler.Run(ctx, db, cfg.Scheduler, scheduler.Job{
+			Name: "schedules",
+			Run:  func(ctx context.Context) error { return controllers.RunSchedules(ctx, db) },
+		}, scheduler.Job{
+			Name: "edit_locks",
+			Run:  func(ctx context.Context) error { return controllers.PurgeEditLocks(ctx, db) },
+		}, scheduler.Job{
+			Name: "webhooks",
+			Run:  func(ctx context.Context) error { return controllers.DeliverWebhooks(ctx, db) },
+		})
+	}()
+
+	// Änderungen aller Instanzen und Trigger über LISTEN empfangen und an die Streams von /api/events verteilen
+	if cfg.Events.Enabled {
+		broker := events.NewBroker()
+		controllers.Events = broker
+		server.RegisterOnShutdown(broker.Close) // Offene Streams halten das Herunterfahren sonst auf
+		go func() {
+			if err := broker.Listen(ctx, cfg.Database.DSN()); err != nil {
+				slog.Error("Change events from other instances are unavailable", "error", err)
+			}
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Server running", "addr", cfg.Server.Addr, "tls", cfg.Server.TLSCert != "")
+		if cfg.Server.TLSCert != "" {
+			serveErr <- server.ListenAndServeTLS(cfg.Server.TLSCert, cfg.Server.TLSKey)
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		fatal("Server failed", err)
+	case <-ctx.Done():
+	}
+	stop() // Ein zweites Signal beendet den Prozess sofort
+
+	// Keine neuen Verbindungen annehmen und laufende Anfragen (z. B. Speichervorgänge) abschließen lassen
+	slog.Info("Shutting down, draining in-flight requests", "timeout", cfg.Server.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		// Verbleibende Anfragen abbrechen; ihre Kontexte brechen auch die SQL-Statements ab
+		slog.Error("Graceful shutdown timed out", "error", err)
+		server.Close()
+	}
+	// ctx ist beendet; laufende Jobs brechen ab und der Lock wird freigegeben
+	<-schedulerDone
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("Could not flush traces", "error", err)
+	}
+	slog.Info("Server stopped")
+}
 
-	fmt.Println("Server running on port 8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+// fatal protokolliert einen Fehler beim Start bzw. Betrieb und beendet den Prozess
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
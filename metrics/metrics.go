@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Präfix aller CMS-eigenen Metriken
+const namespace = "cms"
+
+// registry enthält nur die Metriken dieses Dienstes sowie Go- und Prozessmetriken
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Duration of database work per controller operation, including the surrounding transaction.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"operation", "outcome"})
+
+	recordChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "record_changes_total",
+		Help:      "Inserted, updated and deleted records per table.",
+	}, []string{"operation", "schema", "table"})
+
+	rateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected with 429 by route group and limit scope (ip, user or lockout).",
+	}, []string{"group", "scope"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, queryDuration, recordChanges, rateLimited,
+	)
+}
+
+// RegisterDB veröffentlicht die Statistiken des Verbindungspools (db.Stats) als cms_db_*-Metriken
+func RegisterDB(db *sql.DB) {
+	registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// Handler liefert den /metrics-Endpunkt im Prometheus-Textformat
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// ObserveRequest erfasst eine beantwortete HTTP-Anfrage; route ist das Muster des ServeMux
+func ObserveRequest(route, method string, status int, duration time.Duration) {
+	// Nicht zugeordnete Pfade zusammenfassen, damit beliebige URLs keine neuen Zeitreihen erzeugen
+	if route == "" {
+		route = "unmatched"
+	}
+	labels := prometheus.Labels{"route": route, "method": method, "status": strconv.Itoa(status)}
+	httpRequests.With(labels).Inc()
+	httpDuration.With(labels).Observe(duration.Seconds())
+}
+
+// ObserveQuery erfasst die Dauer der Datenbankarbeit eines Controller-Vorgangs
+func ObserveQuery(operation string, duration time.Duration, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	queryDuration.WithLabelValues(operation, outcome).Observe(duration.Seconds())
+}
+
+// RecordChange zählt einen geschriebenen Datensatz (operation: insert, update oder delete)
+func RecordChange(operation, schema, table string) {
+	recordChanges.WithLabelValues(operation, schema, table).Inc()
+}
+
+// RateLimited zählt eine wegen Ratenbegrenzung oder Sperre abgewiesene Anfrage
+func RateLimited(group, scope string) {
+	rateLimited.WithLabelValues(group, scope).Inc()
+}
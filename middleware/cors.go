@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions legt fest, welche fremden Origins die öffentliche API aus dem Browser aufrufen dürfen
+type CORSOptions struct {
+	AllowedOrigins []string      `yaml:"allowed_origins"` // Leer = CORS aus; "*" erlaubt jede Origin
+	AllowedMethods []string      `yaml:"allowed_methods"`
+	AllowedHeaders []string      `yaml:"allowed_headers"`
+	MaxAge         time.Duration `yaml:"max_age"` // Gültigkeit der Preflight-Antwort im Browser-Cache
+}
+
+// CORS beantwortet Preflight-Anfragen und setzt die Access-Control-Header für erlaubte Origins.
+// Cookies werden nicht freigegeben (keine Allow-Credentials), fremde Origins brauchen einen Authorization-Header.
+func CORS(opts CORSOptions, next http.Handler) http.Handler {
+	if len(opts.AllowedOrigins) == 0 {
+		return next
+	}
+	anyOrigin := slices.Contains(opts.AllowedOrigins, "*")
+	methods := strings.Join(opts.AllowedMethods, ", ")
+	headers := strings.Join(opts.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(opts.MaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if !anyOrigin && !slices.Contains(opts.AllowedOrigins, origin) {
+			// Ohne Access-Control-Header verwirft der Browser die Antwort
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+			w.Header().Set("Access-Control-Max-Age", maxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+)
+
+// Double-Submit-Cookie: Der Browser sendet das Cookie automatisch mit, den Header kann aber nur
+// JavaScript der eigenen Origin setzen, da nur sie das Cookie lesen kann
+const (
+	CSRFCookie = "cms_csrf"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// CSRF setzt das Token-Cookie und verlangt bei ändernden Methoden, dass der Header mit dem Cookie übereinstimmt.
+// Anfragen mit Authorization-Header sind ausgenommen: Sie werden nicht automatisch vom Browser authentifiziert.
+func CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := ""
+		if cookie, err := r.Cookie(CSRFCookie); err == nil && len(cookie.Value) == 64 {
+			token = cookie.Value
+		} else {
+			token = newCSRFToken()
+			http.SetCookie(w, &http.Cookie{
+				Name:     CSRFCookie,
+				Value:    token,
+				Path:     "/",
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+				// Nicht HttpOnly, das Skript der Oberfläche muss das Token lesen
+			})
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		default:
+			if r.Header.Get("Authorization") == "" {
+				header := r.Header.Get(CSRFHeader)
+				if header == "" || subtle.ConstantTimeCompare([]byte(header), []byte(token)) != 1 {
+					WriteError(w, r, http.StatusForbidden, "csrf_failed", "Missing or invalid CSRF token. Send the value of the "+CSRFCookie+" cookie in the "+CSRFHeader+" header.")
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WriteError sendet einen Fehler im selben Format wie die Controller ({"error": {...}})
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	Logger(r.Context()).Info("Request rejected", "status", status, "code", code, "message", message)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": struct {
+		Status    int    `json:"status"`
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		RequestID string `json:"requestId,omitempty"`
+	}{status, code, message, ID(r.Context())}})
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	token := strings.Repeat("ab", 32)
+	tests := []struct {
+		name          string
+		method        string
+		cookie        string
+		header        string
+		authorization string
+		status        int
+		newCookie     bool // Antwort setzt ein neues Token
+	}{
+		{"safe method without token", http.MethodGet, "", "", "", http.StatusOK, true},
+		{"safe method keeps token", http.MethodGet, token, "", "", http.StatusOK, false},
+		{"head without token", http.MethodHead, "", "", "", http.StatusOK, true},
+		{"options without token", http.MethodOptions, "", "", "", http.StatusOK, true},
+		{"missing cookie and header", http.MethodPost, "", "", "", http.StatusForbidden, true},
+		{"missing header", http.MethodPost, token, "", "", http.StatusForbidden, false},
+		{"missing cookie", http.MethodPost, "", token, "", http.StatusForbidden, true},
+		{"mismatched header", http.MethodPut, token, strings.Repeat("cd", 32), "", http.StatusForbidden, false},
+		{"malformed cookie is replaced", http.MethodPost, "short", "short", "", http.StatusForbidden, true},
+		{"valid token", http.MethodPost, token, token, "", http.StatusOK, false},
+		{"valid token on delete", http.MethodDelete, token, token, "", http.StatusOK, false},
+		{"valid token on patch", http.MethodPatch, token, token, "", http.StatusOK, false},
+		{"authorization header bypass", http.MethodPost, "", "", "Bearer wcms_secret", http.StatusOK, true},
+		{"authorization header with cookie", http.MethodDelete, token, "", "Bearer wcms_secret", http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			r := httptest.NewRequest(tt.method, "/api/save", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set(CSRFHeader, tt.header)
+			}
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status == http.StatusForbidden {
+				var body struct {
+					Error struct {
+						Code string `json:"code"`
+					} `json:"error"`
+				}
+				if json.Unmarshal(rec.Body.Bytes(), &body); body.Error.Code != "csrf_failed" {
+					t.Errorf("error code = %q, want csrf_failed", body.Error.Code)
+				}
+			}
+
+			var issued *http.Cookie
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == CSRFCookie {
+					issued = c
+				}
+			}
+			if (issued != nil) != tt.newCookie {
+				t.Fatalf("new cookie = %v, want %v", issued, tt.newCookie)
+			}
+			if issued != nil {
+				if len(issued.Value) != 64 || issued.Value == tt.cookie {
+					t.Errorf("issued token %q", issued.Value)
+				}
+				// Das Skript der Oberfläche muss das Token lesen können
+				if issued.HttpOnly || issued.SameSite != http.SameSiteStrictMode || issued.Path != "/" {
+					t.Errorf("cookie attributes = %+v", issued)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LockoutOptions sperrt einen Schlüssel (Benutzername oder IP), nachdem innerhalb von Window
+// MaxFailures Anmeldeversuche fehlgeschlagen sind, für Duration; MaxFailures 0 = keine Sperre
+type LockoutOptions struct {
+	MaxFailures int           `yaml:"max_failures"`
+	Window      time.Duration `yaml:"window"`
+	Duration    time.Duration `yaml:"duration"`
+}
+
+type failures struct {
+	count       int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+// Lockout zählt fehlgeschlagene Anmeldungen und sperrt vorübergehend weitere Versuche
+type Lockout struct {
+	opts LockoutOptions
+
+	mu      sync.Mutex
+	entries map[string]*failures
+}
+
+// NewLockout erzeugt eine Sperre mit den angegebenen Grenzen
+func NewLockout(opts LockoutOptions) *Lockout {
+	return &Lockout{opts: opts, entries: map[string]*failures{}}
+}
+
+// Locked liefert die verbleibende Sperrzeit für key, 0 wenn nicht gesperrt
+func (l *Lockout) Locked(key string) time.Duration {
+	if l == nil || l.opts.MaxFailures <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if entry, ok := l.entries[key]; ok {
+		if remaining := time.Until(entry.lockedUntil); remaining > 0 {
+			return remaining
+		}
+	}
+	return 0
+}
+
+// Fail zählt einen fehlgeschlagenen Versuch und liefert die Sperrzeit, falls key damit gesperrt wird
+func (l *Lockout) Fail(key string) time.Duration {
+	if l == nil || l.opts.MaxFailures <= 0 {
+		return 0
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	entry, ok := l.entries[key]
+	if !ok || now.Sub(entry.first) > l.opts.Window {
+		entry = &failures{first: now}
+		l.entries[key] = entry
+	}
+	entry.count++
+	if entry.count >= l.opts.MaxFailures {
+		entry.lockedUntil = now.Add(l.opts.Duration)
+		entry.count = 0
+		entry.first = now
+		return l.opts.Duration
+	}
+	return 0
+}
+
+// Reset vergisst die Fehlversuche nach einer erfolgreichen Anmeldung
+func (l *Lockout) Reset(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
+
+func (l *Lockout) sweep(now time.Time) {
+	for key, entry := range l.entries {
+		if now.Sub(entry.first) > l.opts.Window && now.After(entry.lockedUntil) {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// Reject beantwortet einen Versuch während der Sperre mit 429 und Retry-After
+func (l *Lockout) Reject(w http.ResponseWriter, r *http.Request, remaining time.Duration) {
+	tooManyRequests(w, r, "login", "lockout", remaining, "Too many failed login attempts.")
+}
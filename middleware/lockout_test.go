@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLockout(t *testing.T) {
+	opts := LockoutOptions{MaxFailures: 3, Window: time.Minute, Duration: 5 * time.Minute}
+
+	t.Run("locks after max failures", func(t *testing.T) {
+		l := NewLockout(opts)
+		for i := range 2 {
+			if locked := l.Fail("alice"); locked != 0 {
+				t.Fatalf("failure %d locked for %v", i+1, locked)
+			}
+		}
+		if l.Locked("alice") != 0 {
+			t.Fatal("locked before max failures")
+		}
+		if locked := l.Fail("alice"); locked != opts.Duration {
+			t.Fatalf("third failure: locked %v, want %v", locked, opts.Duration)
+		}
+		if remaining := l.Locked("alice"); remaining <= 4*time.Minute || remaining > opts.Duration {
+			t.Errorf("Locked = %v", remaining)
+		}
+		if l.Locked("bob") != 0 {
+			t.Error("other key is locked")
+		}
+	})
+
+	t.Run("reset after success", func(t *testing.T) {
+		l := NewLockout(opts)
+		l.Fail("alice")
+		l.Fail("alice")
+		l.Reset("alice")
+		if locked := l.Fail("alice"); locked != 0 {
+			t.Errorf("failure after reset locked for %v", locked)
+		}
+		l.Fail("alice")
+		l.Fail("alice")
+		l.Reset("alice")
+		if l.Locked("alice") != 0 {
+			t.Error("still locked after reset")
+		}
+	})
+
+	t.Run("failures expire with window", func(t *testing.T) {
+		l := NewLockout(opts)
+		l.Fail("alice")
+		l.Fail("alice")
+		l.mu.Lock()
+		l.entries["alice"].first = time.Now().Add(-2 * time.Minute)
+		l.mu.Unlock()
+		if locked := l.Fail("alice"); locked != 0 {
+			t.Errorf("failure after window locked for %v", locked)
+		}
+	})
+
+	t.Run("lock expires", func(t *testing.T) {
+		l := NewLockout(opts)
+		for range 3 {
+			l.Fail("alice")
+		}
+		l.mu.Lock()
+		l.entries["alice"].lockedUntil = time.Now().Add(-time.Second)
+		l.mu.Unlock()
+		if remaining := l.Locked("alice"); remaining != 0 {
+			t.Errorf("Locked after expiry = %v", remaining)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var nilLockout *Lockout
+		for _, l := range []*Lockout{nilLockout, NewLockout(LockoutOptions{})} {
+			for range 10 {
+				if locked := l.Fail("alice"); locked != 0 {
+					t.Fatalf("disabled lockout locked for %v", locked)
+				}
+			}
+			if l.Locked("alice") != 0 {
+				t.Error("disabled lockout is locked")
+			}
+			l.Reset("alice")
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		NewLockout(opts).Reject(rec, httptest.NewRequest(http.MethodPost, "/auth/2fa/verify", nil), 90*time.Second+time.Millisecond)
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "91" {
+			t.Errorf("Reject = %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+		}
+	})
+}
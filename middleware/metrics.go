@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+	"wuffnetCMS/metrics"
+)
+
+// Metrics zählt Anfragen und misst ihre Dauer je Route, Methode und Status
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		metrics.ObserveRequest(route(r), r.Method, rec.status, time.Since(start))
+	})
+}
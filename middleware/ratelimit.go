@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"wuffnetCMS/metrics"
+)
+
+// Limit beschreibt einen Token-Bucket: Rate Anfragen pro Sekunde, kurzfristig bis zu Burst auf einmal; Rate 0 = kein Limit
+type Limit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// GroupLimit begrenzt eine Routen-Gruppe je Client-IP und je angemeldetem Benutzer
+type GroupLimit struct {
+	PerIP   Limit `yaml:"per_ip"`
+	PerUser Limit `yaml:"per_user"`
+}
+
+// RateLimitOptions enthält die Limits je Routen-Gruppe und die Sperre nach fehlgeschlagenen Anmeldungen
+type RateLimitOptions struct {
+	Groups         map[string]GroupLimit `yaml:"groups"`
+	TrustedProxies []string              `yaml:"trusted_proxies"` // CIDRs, deren X-Forwarded-For übernommen wird
+	Lockout        LockoutOptions        `yaml:"lockout"`
+}
+
+// Ungenutzte Buckets werden nach dieser Zeit verworfen
+const bucketIdleTimeout = 10 * time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter verwaltet einen Token-Bucket je Schlüssel (IP oder Benutzer)
+type Limiter struct {
+	limit Limit
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// NewLimiter erzeugt einen Limiter; mit Rate 0 lässt er alles durch
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{limit: limit, buckets: map[string]*bucket{}, swept: time.Now()}
+}
+
+// Allow entnimmt ein Token für key; ist keines übrig, liefert es die Wartezeit bis zum nächsten
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil || l.limit.Rate <= 0 {
+		return true, 0
+	}
+	now := time.Now()
+	burst := float64(max(l.limit.Burst, 1))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.limit.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep entfernt gelegentlich Buckets, die lange nicht benutzt wurden und damit wieder voll wären
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < bucketIdleTimeout {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > bucketIdleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
+
+// RateLimiter begrenzt Anfragen je Routen-Gruppe; welche Gruppe gilt, entscheidet group (leer = keine Begrenzung).
+// Die Benutzerkennung (nicht der Anzeigename) stammt aus SetUser, die Authentifizierung muss also vorher laufen.
+func RateLimiter(opts RateLimitOptions, group func(r *http.Request) string, next http.Handler) http.Handler {
+	type limiters struct{ ip, user *Limiter }
+	groups := map[string]limiters{}
+	for name, limit := range opts.Groups {
+		groups[name] = limiters{ip: NewLimiter(limit.PerIP), user: NewLimiter(limit.PerUser)}
+	}
+	proxies := parsePrefixes(opts.TrustedProxies)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := group(r)
+		limit, ok := groups[name]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if allowed, retry := limit.ip.Allow(ClientIP(r, proxies)); !allowed {
+			tooManyRequests(w, r, name, "ip", retry, "Too many requests.")
+			return
+		}
+		if user := UserID(r.Context()); user != "" {
+			if allowed, retry := limit.user.Allow(user); !allowed {
+				tooManyRequests(w, r, name, "user", retry, "Too many requests.")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tooManyRequests antwortet mit 429; Retry-After nennt die Wartezeit in ganzen Sekunden
+func tooManyRequests(w http.ResponseWriter, r *http.Request, group, scope string, retry time.Duration, message string) {
+	metrics.RateLimited(group, scope)
+	seconds := strconv.Itoa(max(int(math.Ceil(retry.Seconds())), 1))
+	w.Header().Set("Retry-After", seconds)
+	WriteError(w, r, http.StatusTooManyRequests, "rate_limited", message+" Retry after "+seconds+" seconds.")
+}
+
+// ClientIP liefert die Adresse des Clients. X-Forwarded-For wird nur ausgewertet, wenn die Verbindung
+// von einem vertrauenswürdigen Proxy kommt; maßgeblich ist dann der letzte Eintrag, der kein solcher Proxy ist.
+func ClientIP(r *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !containsAddr(trusted, addr) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop
+		if !containsAddr(trusted, hop) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrefixes liest CIDRs oder einzelne Adressen; ungültige Einträge weist bereits die Konfigurationsprüfung ab
+func parsePrefixes(values []string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, value := range values {
+		if prefix, err := ParsePrefix(value); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// ParsePrefix akzeptiert CIDRs wie 10.0.0.0/8 sowie einzelne Adressen
+func ParsePrefix(value string) (netip.Prefix, error) {
+	if !strings.Contains(value, "/") {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	return netip.ParsePrefix(value)
+}
@@ -0,0 +1,215 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// rewind verschiebt den letzten Zugriff eines Buckets in die Vergangenheit, statt im Test zu warten
+func (l *Limiter) rewind(key string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buckets[key].last = l.buckets[key].last.Add(-d)
+}
+
+func allowN(l *Limiter, key string, n int) (allowed int) {
+	for range n {
+		if ok, _ := l.Allow(key); ok {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestLimiterBurst(t *testing.T) {
+	l := NewLimiter(Limit{Rate: 1, Burst: 3})
+	if got := allowN(l, "a", 5); got != 3 {
+		t.Errorf("allowed %d of 5 requests, want burst of 3", got)
+	}
+	ok, retry := l.Allow("a")
+	if ok || retry <= 0 || retry > time.Second {
+		t.Errorf("Allow after burst = %v, retry %v", ok, retry)
+	}
+	// Jeder Schlüssel hat seinen eigenen Bucket
+	if got := allowN(l, "b", 3); got != 3 {
+		t.Errorf("other key: allowed %d, want 3", got)
+	}
+}
+
+func TestLimiterRefill(t *testing.T) {
+	l := NewLimiter(Limit{Rate: 2, Burst: 4})
+	allowN(l, "a", 4)
+
+	// Nach einer Sekunde sind bei Rate 2 genau zwei Tokens nachgefüllt
+	l.rewind("a", time.Second)
+	if got := allowN(l, "a", 4); got != 2 {
+		t.Errorf("after 1s: allowed %d, want 2", got)
+	}
+	// Halbe Tokens reichen nicht; Retry-After nennt die restliche Wartezeit
+	l.rewind("a", 250*time.Millisecond)
+	if ok, retry := l.Allow("a"); ok || retry < 200*time.Millisecond || retry > 250*time.Millisecond {
+		t.Errorf("after 0.25s: Allow = %v, retry %v", ok, retry)
+	}
+	// Lange Pausen füllen höchstens bis Burst auf
+	l.rewind("a", time.Hour)
+	if got := allowN(l, "a", 10); got != 4 {
+		t.Errorf("after 1h: allowed %d, want burst of 4", got)
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	var nilLimiter *Limiter
+	if got := allowN(nilLimiter, "a", 100); got != 100 {
+		t.Errorf("nil limiter allowed %d", got)
+	}
+	if got := allowN(NewLimiter(Limit{}), "a", 100); got != 100 {
+		t.Errorf("rate 0 allowed %d", got)
+	}
+	// Burst 0 gilt als 1
+	if got := allowN(NewLimiter(Limit{Rate: 1}), "a", 3); got != 1 {
+		t.Errorf("burst 0 allowed %d, want 1", got)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := parsePrefixes([]string{"10.0.0.0/8", "::1"})
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:4711", nil, "203.0.113.7"},
+		{"untrusted client with forged header", "203.0.113.7:4711", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.1:4711", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"trusted proxy without header", "10.0.0.1:4711", nil, "10.0.0.1"},
+		{"forged first hop ignored", "10.0.0.1:4711", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.1:4711", []string{"198.51.100.1, 10.0.0.3, 10.0.0.2"}, "198.51.100.1"},
+		{"several headers", "10.0.0.1:4711", []string{"1.2.3.4", "198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"only trusted hops", "10.0.0.1:4711", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"invalid hop", "10.0.0.1:4711", []string{"unknown"}, "10.0.0.1"},
+		{"IPv6 proxy", "[::1]:4711", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"IPv4-mapped proxy", "[::ffff:10.0.0.1]:4711", []string{"198.51.100.1"}, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for _, value := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if got := ClientIP(r, trusted); got != tt.want {
+			t.Errorf("%s: ClientIP = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	if got := ClientIP(&http.Request{RemoteAddr: "10.0.0.1:4711", Header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}}, nil); got != "10.0.0.1" {
+		t.Errorf("without trusted proxies: ClientIP = %s", got)
+	}
+}
+
+func TestParsePrefix(t *testing.T) {
+	for value, want := range map[string]string{"10.0.0.0/8": "10.0.0.0/8", "192.0.2.1": "192.0.2.1/32", "::1": "::1/128"} {
+		prefix, err := ParsePrefix(value)
+		if err != nil || prefix != netip.MustParsePrefix(want) {
+			t.Errorf("ParsePrefix(%q) = %v, %v", value, prefix, err)
+		}
+	}
+	if _, err := ParsePrefix("proxy.local"); err == nil {
+		t.Error("ParsePrefix accepted a host name")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	opts := RateLimitOptions{
+		Groups: map[string]GroupLimit{
+			"api": {PerIP: Limit{Rate: 1, Burst: 2}, PerUser: Limit{Rate: 1, Burst: 3}},
+		},
+		TrustedProxies: []string{"10.0.0.0/8"},
+	}
+	group := func(r *http.Request) string {
+		if r.URL.Path == "/healthz" {
+			return ""
+		}
+		return "api"
+	}
+	send := func(handler http.Handler, path, remoteAddr, forwarded, user string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = remoteAddr
+		if forwarded != "" {
+			r.Header.Set("X-Forwarded-For", forwarded)
+		}
+		if user != "" {
+			r.Header.Set("X-Test-User", user)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	t.Run("forwarded clients behind trusted proxy", func(t *testing.T) {
+		handler := handlerWith(opts, group)
+		for _, client := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"} {
+			for i := range 2 {
+				if rec := send(handler, "/api", "10.0.0.1:4711", client, ""); rec.Code != http.StatusOK {
+					t.Fatalf("%s request %d: status %d", client, i+1, rec.Code)
+				}
+			}
+		}
+		if rec := send(handler, "/api", "10.0.0.1:4711", "198.51.100.1", ""); rec.Code != http.StatusTooManyRequests {
+			t.Errorf("third request of one client: status %d", rec.Code)
+		}
+	})
+
+	t.Run("forged header from untrusted client", func(t *testing.T) {
+		handler := handlerWith(opts, group)
+		send(handler, "/api", "203.0.113.7:4711", "198.51.100.1", "")
+		send(handler, "/api", "203.0.113.7:4711", "198.51.100.2", "")
+		rec := send(handler, "/api", "203.0.113.7:4711", "198.51.100.3", "")
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("status = %d, want 429", rec.Code)
+		}
+		if rec.Header().Get("Retry-After") != "1" {
+			t.Errorf("Retry-After = %q, want 1", rec.Header().Get("Retry-After"))
+		}
+	})
+
+	t.Run("per user across addresses", func(t *testing.T) {
+		handler := handlerWith(opts, group)
+		for i, addr := range []string{"203.0.113.1:1", "203.0.113.2:1", "203.0.113.3:1"} {
+			if rec := send(handler, "/api", addr, "", "alice"); rec.Code != http.StatusOK {
+				t.Fatalf("request %d: status %d", i+1, rec.Code)
+			}
+		}
+		if rec := send(handler, "/api", "203.0.113.4:1", "", "alice"); rec.Code != http.StatusTooManyRequests {
+			t.Errorf("fourth request of alice: status %d", rec.Code)
+		}
+		if rec := send(handler, "/api", "203.0.113.5:1", "", "bob"); rec.Code != http.StatusOK {
+			t.Errorf("bob with the same display name: status %d", rec.Code)
+		}
+	})
+
+	t.Run("routes without group", func(t *testing.T) {
+		handler := handlerWith(opts, group)
+		for i := range 5 {
+			if rec := send(handler, "/healthz", "203.0.113.7:4711", "", ""); rec.Code != http.StatusOK {
+				t.Fatalf("request %d: status %d", i+1, rec.Code)
+			}
+		}
+	})
+}
+
+// handlerWith baut die Kette wie der Router: RequestID, dann die Anmeldung (hier aus X-Test-User), dann RateLimiter.
+// Alle Testbenutzer tragen denselben Anzeigenamen; der Bucket muss der Kennung folgen.
+func handlerWith(opts RateLimitOptions, group func(r *http.Request) string) http.Handler {
+	limited := RateLimiter(opts, group, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	return RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user := r.Header.Get("X-Test-User"); user != "" {
+			SetUser(r.Context(), user, "Alex Smith")
+		}
+		limited.ServeHTTP(w, r)
+	}))
+}
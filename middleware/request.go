@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey int
+
+const requestInfoKey contextKey = iota
+
+// requestInfo sammelt, was während einer Anfrage über sie bekannt wird (ID, Benutzer, Tabelle ...)
+type requestInfo struct {
+	id string
+
+	mu     sync.Mutex
+	userID string // Stabile Kennung des Benutzers, z. B. für Rate-Limits
+	user   string // Anzeigename für Logs
+	route  string // Muster des ServeMux, gesetzt von Route
+	attrs  []any
+}
+
+// Vom Client oder Proxy übernommene IDs werden nur in dieser Form akzeptiert
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// RequestID vergibt jeder Anfrage eine ID (bzw. übernimmt X-Request-ID) und gibt sie im Antwort-Header zurück
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("cms.request_id", id))
+
+		ctx := context.WithValue(r.Context(), requestInfoKey, &requestInfo{id: id})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func info(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey).(*requestInfo)
+	return info
+}
+
+// ID liefert die Request-ID, leer außerhalb von RequestID
+func ID(ctx context.Context) string {
+	if info := info(ctx); info != nil {
+		return info.id
+	}
+	return ""
+}
+
+// SetUser hält den angemeldeten Benutzer fest: id ist seine stabile Kennung, user der Anzeigename
+// für Access-Log und Fehlerprotokoll (Anzeigenamen sind nicht eindeutig und können sich ändern)
+func SetUser(ctx context.Context, id, user string) {
+	if info := info(ctx); info != nil {
+		info.mu.Lock()
+		info.userID = id
+		info.user = user
+		info.mu.Unlock()
+	}
+}
+
+// UserID liefert die mit SetUser gesetzte Kennung des Benutzers
+func UserID(ctx context.Context) string {
+	if info := info(ctx); info != nil {
+		info.mu.Lock()
+		defer info.mu.Unlock()
+		return info.userID
+	}
+	return ""
+}
+
+// User liefert den mit SetUser gesetzten Anzeigenamen
+func User(ctx context.Context) string {
+	if info := info(ctx); info != nil {
+		info.mu.Lock()
+		defer info.mu.Unlock()
+		return info.user
+	}
+	return ""
+}
+
+// setRoute hält das Muster des ServeMux für Middleware außerhalb von Route fest
+func setRoute(ctx context.Context, pattern string) {
+	if info := info(ctx); info != nil {
+		info.mu.Lock()
+		info.route = pattern
+		info.mu.Unlock()
+	}
+}
+
+// route liefert das Muster des ServeMux, leer wenn kein Muster passte; r.Pattern allein ist
+// außerhalb von Route leer, sobald eine Middleware dazwischen den Request kopiert
+func route(r *http.Request) string {
+	if info := info(r.Context()); info != nil {
+		info.mu.Lock()
+		defer info.mu.Unlock()
+		if info.route != "" {
+			return info.route
+		}
+	}
+	return r.Pattern
+}
+
+// Annotate ergänzt Schlüssel-Wert-Paare (wie bei slog), die in allen Logeinträgen der Anfrage erscheinen
+func Annotate(ctx context.Context, args ...any) {
+	if info := info(ctx); info != nil {
+		info.mu.Lock()
+		info.attrs = append(info.attrs, args...)
+		info.mu.Unlock()
+	}
+}
+
+// Logger liefert den Standard-Logger, ergänzt um Request-ID, Benutzer und Annotationen der Anfrage
+func Logger(ctx context.Context) *slog.Logger {
+	info := info(ctx)
+	if info == nil {
+		return slog.Default()
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+
+	args := []any{"request_id", info.id}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		args = append(args, "trace_id", span.TraceID().String())
+	}
+	if info.user != "" {
+		args = append(args, "user", info.user)
+	}
+	args = append(args, info.attrs...)
+	return slog.Default().With(args...)
+}
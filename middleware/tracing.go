@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing startet für jede Anfrage einen Span und übernimmt einen eingehenden W3C-Trace-Kontext.
+// Der Span heißt zunächst nur nach der Methode; Route benennt ihn nach dem Routing um.
+func Tracing(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "HTTP request",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method
+		}),
+		// Proben und Metrik-Abfragen würden die Traces nur füllen
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			switch r.URL.Path {
+			case "/healthz", "/readyz", "/metrics":
+				return false
+			}
+			return true
+		}),
+	)
+}
+
+// Route überträgt das Muster des ServeMux auf den Span und für Access-Log und Metriken in die Anfrage-Infos.
+// Muss direkt um den Mux liegen, da nur dessen Request das Muster erhält; äußere Middleware hält nach
+// r.WithContext (z. B. in der Anmeldung) eine andere Kopie.
+func Route(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		if r.Pattern == "" {
+			return
+		}
+		setRoute(r.Context(), r.Pattern)
+		span := trace.SpanFromContext(r.Context())
+		route := r.Pattern
+		if method, path, found := strings.Cut(r.Pattern, " "); found {
+			route = strings.TrimSpace(path)
+			span.SetName(method + " " + route)
+		} else {
+			span.SetName(r.Method + " " + route)
+		}
+		span.SetAttributes(semconv.HTTPRoute(route))
+	})
+}
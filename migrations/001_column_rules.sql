@@ -0,0 +1,14 @@
+-- Zusätzliche Validierungsregeln je Spalte, gepflegt von Administratoren
+CREATE TABLE IF NOT EXISTS {{schema}}.column_rules (
+    id           serial PRIMARY KEY,
+    table_schema text NOT NULL,
+    table_name   text NOT NULL,
+    column_name  text NOT NULL,
+    rule         text NOT NULL CHECK (rule IN ('regex', 'email', 'url', 'range')),
+    -- regex: Muster, range: "min,max" (eine Seite darf fehlen)
+    argument     text,
+    message      text
+);
+
+CREATE INDEX IF NOT EXISTS column_rules_table_idx
+    ON {{schema}}.column_rules (table_schema, table_name);
@@ -0,0 +1,40 @@
+-- Über OIDC angemeldete Benutzer; die Rollen werden bei jeder Anmeldung aus den Gruppen übernommen
+CREATE TABLE IF NOT EXISTS {{schema}}.users (
+    id            bigserial PRIMARY KEY,
+    issuer        text NOT NULL,
+    subject       text NOT NULL,
+    name          text NOT NULL,
+    email         text,
+    roles         text[] NOT NULL DEFAULT '{}',
+    created_at    timestamptz NOT NULL DEFAULT now(),
+    last_login_at timestamptz,
+    UNIQUE (issuer, subject)
+);
+
+-- Browser-Sitzungen; gespeichert wird nur der SHA-256-Hash des Cookies
+CREATE TABLE IF NOT EXISTS {{schema}}.sessions (
+    token_hash text PRIMARY KEY,
+    user_id    bigint NOT NULL REFERENCES {{schema}}.users (id) ON DELETE CASCADE,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    expires_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_expires_idx
+    ON {{schema}}.sessions (expires_at);
+
+-- Persönliche API-Tokens für Skripte; gespeichert wird nur der SHA-256-Hash
+CREATE TABLE IF NOT EXISTS {{schema}}.api_tokens (
+    id           bigserial PRIMARY KEY,
+    user_id      bigint NOT NULL REFERENCES {{schema}}.users (id) ON DELETE CASCADE,
+    name         text NOT NULL,
+    -- Anfang des Tokens, damit Benutzer es wiedererkennen
+    prefix       text NOT NULL,
+    token_hash   text NOT NULL UNIQUE,
+    scopes       text[] NOT NULL,
+    created_at   timestamptz NOT NULL DEFAULT now(),
+    expires_at   timestamptz NOT NULL,
+    last_used_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS api_tokens_user_idx
+    ON {{schema}}.api_tokens (user_id);
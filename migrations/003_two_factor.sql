@@ -0,0 +1,19 @@
+-- TOTP als zweiter Faktor; das Geheimnis gilt erst nach der Bestätigung mit einem Code (totp_enabled_at)
+ALTER TABLE {{schema}}.users
+    ADD COLUMN IF NOT EXISTS totp_secret     text,
+    ADD COLUMN IF NOT EXISTS totp_enabled_at timestamptz,
+    -- Zuletzt verwendeter Zeitschritt, damit ein Code nicht zweimal gilt
+    ADD COLUMN IF NOT EXISTS totp_last_step  bigint;
+
+-- Sitzungen gelten erst nach Prüfung des zweiten Faktors, sofern der Benutzer TOTP nutzt
+ALTER TABLE {{schema}}.sessions
+    ADD COLUMN IF NOT EXISTS verified boolean NOT NULL DEFAULT false;
+
+-- Einmal verwendbare Wiederherstellungscodes; gespeichert wird nur der SHA-256-Hash
+CREATE TABLE IF NOT EXISTS {{schema}}.recovery_codes (
+    id        bigserial PRIMARY KEY,
+    user_id   bigint NOT NULL REFERENCES {{schema}}.users (id) ON DELETE CASCADE,
+    code_hash text NOT NULL,
+    used_at   timestamptz,
+    UNIQUE (user_id, code_hash)
+);
@@ -0,0 +1,33 @@
+-- Tabellen mit Freigabe-Workflow; Änderungen an ihnen werden als Entwurf gespeichert
+CREATE TABLE IF NOT EXISTS {{schema}}.workflow_tables (
+    table_schema text NOT NULL,
+    table_name   text NOT NULL,
+    PRIMARY KEY (table_schema, table_name)
+);
+
+-- Entwürfe: draft (wartet auf Prüfung) → approved → published, oder rejected (zur Überarbeitung)
+CREATE TABLE IF NOT EXISTS {{schema}}.drafts (
+    id           bigserial PRIMARY KEY,
+    table_schema text NOT NULL,
+    table_name   text NOT NULL,
+    -- Primärschlüssel des Live-Datensatzes als Text; NULL bis ein neuer Datensatz veröffentlicht ist
+    record_key   text,
+    -- Spalten wie in SaveRequest.columns
+    data         jsonb NOT NULL,
+    status       text NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'approved', 'rejected', 'published')),
+    comment      text,
+    created_by   bigint REFERENCES {{schema}}.users (id) ON DELETE SET NULL,
+    reviewed_by  bigint REFERENCES {{schema}}.users (id) ON DELETE SET NULL,
+    created_at   timestamptz NOT NULL DEFAULT now(),
+    updated_at   timestamptz NOT NULL DEFAULT now(),
+    reviewed_at  timestamptz,
+    published_at timestamptz
+);
+
+-- Je Live-Datensatz höchstens ein offener Entwurf
+CREATE UNIQUE INDEX IF NOT EXISTS drafts_open_record_idx
+    ON {{schema}}.drafts (table_schema, table_name, record_key)
+    WHERE status <> 'published' AND record_key IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS drafts_table_idx
+    ON {{schema}}.drafts (table_schema, table_name, status);
@@ -0,0 +1,32 @@
+-- Zeitgesteuertes Veröffentlichen: freigegebene Entwürfe gehen ab publish_at live,
+-- unpublish_at wird beim Veröffentlichen für den Live-Datensatz übernommen
+ALTER TABLE {{schema}}.drafts
+    ADD COLUMN IF NOT EXISTS publish_at     timestamptz,
+    ADD COLUMN IF NOT EXISTS unpublish_at   timestamptz,
+    -- Fehler des letzten Versuchs; solange gesetzt, versucht der Scheduler es nicht erneut
+    ADD COLUMN IF NOT EXISTS schedule_error text;
+
+-- unpublished: vom Scheduler aus der Tabelle genommener Datensatz, kann als Entwurf erneut eingereicht werden
+ALTER TABLE {{schema}}.drafts
+    DROP CONSTRAINT IF EXISTS drafts_status_check,
+    ADD CONSTRAINT drafts_status_check
+        CHECK (status IN ('draft', 'approved', 'rejected', 'published', 'unpublished'));
+
+CREATE INDEX IF NOT EXISTS drafts_publish_at_idx
+    ON {{schema}}.drafts (publish_at)
+    WHERE status = 'approved' AND publish_at IS NOT NULL;
+
+-- Live-Datensätze, die zu unpublish_at aus der Tabelle genommen werden
+CREATE TABLE IF NOT EXISTS {{schema}}.unpublish_schedules (
+    table_schema   text NOT NULL,
+    table_name     text NOT NULL,
+    record_key     text NOT NULL,
+    unpublish_at   timestamptz NOT NULL,
+    schedule_error text,
+    created_by     bigint REFERENCES {{schema}}.users (id) ON DELETE SET NULL,
+    created_at     timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (table_schema, table_name, record_key)
+);
+
+CREATE INDEX IF NOT EXISTS unpublish_schedules_due_idx
+    ON {{schema}}.unpublish_schedules (unpublish_at);
@@ -0,0 +1,14 @@
+-- Bearbeitungssperren: wer einen Datensatz im Formular geöffnet hat, hält die Sperre bis expires_at
+-- und verlängert sie per Heartbeat; abgelaufene Sperren gelten als frei
+CREATE TABLE IF NOT EXISTS {{schema}}.edit_locks (
+    table_schema text NOT NULL,
+    table_name   text NOT NULL,
+    record_key   text NOT NULL,
+    user_id      bigint NOT NULL REFERENCES {{schema}}.users (id) ON DELETE CASCADE,
+    acquired_at  timestamptz NOT NULL DEFAULT now(),
+    expires_at   timestamptz NOT NULL,
+    PRIMARY KEY (table_schema, table_name, record_key)
+);
+
+CREATE INDEX IF NOT EXISTS edit_locks_expires_idx
+    ON {{schema}}.edit_locks (expires_at);
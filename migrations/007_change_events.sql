@@ -0,0 +1,24 @@
+-- Meldet Änderungen, die außerhalb des CMS gemacht werden, an /api/events. Einrichten je Tabelle, mit der
+-- Primärschlüsselspalte als Argument:
+--   CREATE TRIGGER cms_events AFTER INSERT OR UPDATE OR DELETE ON public.posts
+--       FOR EACH ROW EXECUTE FUNCTION cms.notify_change('id');
+-- Die Nachricht entspricht der des CMS (events.Notify); Postgres stellt gleiche Nachrichten einer
+-- Transaktion nur einmal zu, Änderungen über das CMS erscheinen daher nicht doppelt.
+CREATE OR REPLACE FUNCTION {{schema}}.notify_change() RETURNS trigger
+LANGUAGE plpgsql AS $$
+DECLARE
+    changed record;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+    ELSE
+        changed := NEW;
+    END IF;
+    PERFORM pg_notify('cms_changes', json_build_object(
+        'type', lower(TG_OP)::text,
+        'schema', TG_TABLE_SCHEMA::text,
+        'table', TG_TABLE_NAME::text,
+        'key', CASE WHEN TG_NARGS > 0 THEN to_jsonb(changed) ->> TG_ARGV[0] END)::text);
+    RETURN NULL;
+END
+$$;
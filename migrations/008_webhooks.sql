@@ -0,0 +1,38 @@
+-- Outbox der Webhooks: jede Änderung legt in ihrer Transaktion je passendem Webhook eine Zustellung an,
+-- der Scheduler stellt sie zu und versucht es bei Fehlern mit wachsendem Abstand erneut
+CREATE TABLE IF NOT EXISTS {{schema}}.webhook_deliveries (
+    id              bigserial PRIMARY KEY,
+    webhook         text NOT NULL, -- Name aus webhooks.endpoints
+    event           text NOT NULL,
+    table_schema    text NOT NULL,
+    table_name      text NOT NULL,
+    record_key      text,
+    payload         jsonb NOT NULL,
+    status          text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+    attempts        integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL DEFAULT now(),
+    last_status     integer, -- HTTP-Status des letzten Versuchs, NULL ohne Antwort
+    last_error      text,
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    delivered_at    timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx
+    ON {{schema}}.webhook_deliveries (next_attempt_at)
+    WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_created_idx
+    ON {{schema}}.webhook_deliveries (created_at);
+
+-- Protokoll aller Zustellversuche
+CREATE TABLE IF NOT EXISTS {{schema}}.webhook_attempts (
+    id           bigserial PRIMARY KEY,
+    delivery_id  bigint NOT NULL REFERENCES {{schema}}.webhook_deliveries (id) ON DELETE CASCADE,
+    attempted_at timestamptz NOT NULL DEFAULT now(),
+    status       integer,
+    error        text,
+    duration_ms  integer NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_attempts_delivery_idx
+    ON {{schema}}.webhook_attempts (delivery_id);
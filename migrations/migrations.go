@@ -0,0 +1,121 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// Schlüssel für pg_advisory_lock, damit nur eine Instanz gleichzeitig migriert
+const lockKey = 7305467
+
+// Apply legt das Metadaten-Schema an und führt alle noch nicht angewendeten Migrationen in Reihenfolge aus
+func Apply(ctx context.Context, db *sql.DB, schema string) error {
+	// Advisory Locks gelten pro Verbindung, daher eine feste Verbindung verwenden
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockKey)
+
+	quoted := pq.QuoteIdentifier(schema)
+	setup := fmt.Sprintf(`
+		CREATE SCHEMA IF NOT EXISTS %[1]s;
+		CREATE TABLE IF NOT EXISTS %[1]s.schema_migrations (
+			version    text PRIMARY KEY,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		);`, quoted)
+	if _, err := conn.ExecContext(ctx, setup); err != nil {
+		return fmt.Errorf("failed to create migration table: %w", err)
+	}
+
+	pending, err := pendingVersions(ctx, conn, schema)
+	if err != nil {
+		return err
+	}
+
+	for _, version := range pending {
+		content, err := files.ReadFile(version + ".sql")
+		if err != nil {
+			return err
+		}
+		statement := strings.ReplaceAll(string(content), "{{schema}}", quoted)
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s failed: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s.schema_migrations (version) VALUES ($1)", quoted), version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %s: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pending liefert die noch nicht angewendeten Migrationen, z. B. für die Readiness-Prüfung
+func Pending(ctx context.Context, db *sql.DB, schema string) ([]string, error) {
+	return pendingVersions(ctx, db, schema)
+}
+
+// queryer erlaubt die Abfrage über *sql.DB oder eine einzelne *sql.Conn
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// pendingVersions liefert die Versionen aller noch nicht angewendeten Migrationen, sortiert nach Name
+func pendingVersions(ctx context.Context, q queryer, schema string) ([]string, error) {
+	names, err := fs.Glob(files, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	rows, err := q.QueryContext(ctx, fmt.Sprintf("SELECT version FROM %s.schema_migrations", pq.QuoteIdentifier(schema)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[string]bool{}
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for _, name := range names {
+		version := strings.TrimSuffix(name, ".sql")
+		if !applied[version] {
+			pending = append(pending, version)
+		}
+	}
+	return pending, nil
+}
@@ -1,14 +1,45 @@
 package models
 
 type Table struct {
-	Name    string   `json:"name"`
-	Columns []Column `json:"columns"`
+	Schema      string   `json:"schema"`
+	Name        string   `json:"name"`
+	PrimaryKey  string   `json:"primary_key,omitempty"`  // Nur bei einspaltigem Primärschlüssel gesetzt
+	PrimaryKeys []string `json:"primary_keys,omitempty"` // Alle Spalten des Primärschlüssels
+	ReadOnly    bool     `json:"read_only,omitempty"`    // Zusammengesetzter Primärschlüssel: Datensätze sind nicht einzeln adressierbar
+	Columns     []Column `json:"columns"`
+}
+
+// Column liefert die Spalte mit diesem Namen, nil wenn die Tabelle keine solche hat
+func (t *Table) Column(name string) *Column {
+	for i := range t.Columns {
+		if t.Columns[i].Name == name {
+			return &t.Columns[i]
+		}
+	}
+	return nil
 }
 
 type Column struct {
-	Name       string `json:"name"`
-	DataType   string `json:"data_type"`
-	IsNullable bool   `json:"is_nullable"`
+	Name             string      `json:"name"`
+	DataType         string      `json:"data_type"`
+	IsNullable       bool        `json:"is_nullable"`
+	HasDefault       bool        `json:"has_default"`                 // Default, Identity oder generierte Spalte
+	Default          string      `json:"default,omitempty"`           // column_default, z. B. now() oder nextval(...)
+	Identity         string      `json:"identity,omitempty"`          // ALWAYS oder BY DEFAULT
+	Generated        bool        `json:"generated"`                   // GENERATED ALWAYS AS (...) STORED
+	MaxLength        *int        `json:"max_length,omitempty"`        // character_maximum_length
+	NumericPrecision *int        `json:"numeric_precision,omitempty"` // Nur bei numeric(p,s)
+	NumericScale     *int        `json:"numeric_scale,omitempty"`
+	Unique           bool        `json:"unique"`               // Eindeutiger Index nur über diese Spalte
+	Checks           []string    `json:"checks,omitempty"`     // CHECK-Constraints, die nur diese Spalte betreffen
+	References       *ForeignKey `json:"references,omitempty"` // Nur bei Foreign Keys gesetzt
+}
+
+// ForeignKey beschreibt die Zielspalte eines Fremdschlüssels
+type ForeignKey struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	Column string `json:"column"`
 }
 
 type Schema struct {
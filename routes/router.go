@@ -3,38 +3,228 @@ package routes
 import (
 	"database/sql"
 	"net/http"
+	"strings"
+	"wuffnetCMS/auth"
 	"wuffnetCMS/controllers"
+	"wuffnetCMS/metrics"
+	"wuffnetCMS/middleware"
+	"wuffnetCMS/web"
 )
 
-func SetupRoutes(db *sql.DB) {
+// SetupRoutes registriert alle Routen auf einem eigenen Mux und liefert ihn als Handler für den Server.
+// Ist authn nil, ist die Anmeldung ausgeschaltet und alle Routen sind ohne Anmeldung erreichbar.
+func SetupRoutes(db *sql.DB, assets *web.Assets, authn *auth.Service, cors middleware.CORSOptions, limits middleware.RateLimitOptions) http.Handler {
+	mux := http.NewServeMux()
 
-	// Statikdateien unter /static verfügbar machen
-	fs := http.FileServer(http.Dir("web/templates"))
-	http.Handle("/web/templates/", http.StripPrefix("/web/templates/", fs))
+	// Oberfläche aus den eingebetteten Dateien (bzw. im Entwicklungsmodus von der Festplatte);
+	// Templates werden nur gerendert, nicht als Dateien ausgeliefert
+	mux.Handle("GET /web/static/", assets.Static())
 
-	// Statikdateien unter /static verfügbar machen
-	fs = http.FileServer(http.Dir("web/static"))
-	http.Handle("/web/static/", http.StripPrefix("/web/static/", fs))
+	// Route für die Hauptseite; alle anderen unbekannten Pfade ergeben 404
+	mux.Handle("GET /{$}", authn.Page(http.HandlerFunc(assets.Layout)))
+	// Prometheus-Metriken zu Anfragen, Verbindungspool und Datensatzänderungen
+	mux.Handle("GET /metrics", metrics.Handler())
 
-	// Route für die Hauptseite
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "web/templates/layout.html")
+	// Liveness- und Readiness-Proben für die Container-Orchestrierung
+	mux.HandleFunc("GET /healthz", controllers.Healthz)
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		controllers.Readyz(db, w, r)
 	})
+	// Anmeldung über den OIDC-Provider und persönliche API-Tokens
+	mux.HandleFunc("GET /auth/login", authn.Login)
+	mux.HandleFunc("GET /auth/callback", authn.Callback)
+	mux.HandleFunc("POST /auth/logout", authn.Logout)
+	mux.HandleFunc("GET /auth/me", authn.Me)
+	// Die Seite prüft die Sitzung selbst über /auth/me; Page würde ausstehende Sitzungen hierher zurückleiten
+	mux.HandleFunc("GET /auth/2fa", assets.TwoFactor)
+	mux.HandleFunc("POST /auth/totp/enroll", authn.EnrollTOTP)
+	mux.HandleFunc("POST /auth/totp/confirm", authn.ConfirmTOTP)
+	mux.HandleFunc("POST /auth/totp/verify", authn.VerifyTOTP)
+	mux.HandleFunc("POST /auth/totp/recovery-codes", authn.RegenerateRecoveryCodes)
+	mux.HandleFunc("POST /auth/totp/disable", authn.DisableTOTP)
+	mux.HandleFunc("GET /api/tokens", authn.ListTokens)
+	mux.HandleFunc("POST /api/tokens", authn.CreateToken)
+	mux.HandleFunc("DELETE /api/tokens/{id}", authn.DeleteToken)
+
 	// Routen definieren
-	http.HandleFunc("/api/tables", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/tables", func(w http.ResponseWriter, r *http.Request) {
 		controllers.GetTables(db, w, r)
 	})
-	http.HandleFunc("/api/table-content", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/table-content", func(w http.ResponseWriter, r *http.Request) {
 		controllers.GetTableContent(db, w, r)
 	})
-	http.HandleFunc("/api/table-fields", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/table-fields", func(w http.ResponseWriter, r *http.Request) {
 		controllers.GetTableFields(db, w, r)
 	})
 	// Neue Route zum Speichern von Daten
-	http.HandleFunc("/api/save-record", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/save-record", func(w http.ResponseWriter, r *http.Request) {
 		controllers.SaveRecord(db, w, r)
 	})
-	http.HandleFunc("/api/delete-record", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/delete-record", func(w http.ResponseWriter, r *http.Request) {
 		controllers.DeleteRecord(db, w, r)
 	})
+	// Maschinenlesbare API-Beschreibung aus dem Datenbankkatalog
+	mux.HandleFunc("/api/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		controllers.GetOpenAPISpec(db, w, r)
+	})
+	// GraphQL-Schema aus Tabellen, Spalten und Fremdschlüsseln
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		controllers.GraphQL(db, w, r)
+	})
+
+	// Freigabe-Workflow: Entwürfe prüfen, ablehnen und veröffentlichen
+	mux.HandleFunc("GET /api/drafts", func(w http.ResponseWriter, r *http.Request) {
+		controllers.ListDrafts(db, w, r)
+	})
+	mux.HandleFunc("GET /api/drafts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		controllers.GetDraft(db, w, r)
+	})
+	mux.HandleFunc("POST /api/drafts/{id}/approve", func(w http.ResponseWriter, r *http.Request) {
+		controllers.ApproveDraft(db, w, r)
+	})
+	mux.HandleFunc("POST /api/drafts/{id}/reject", func(w http.ResponseWriter, r *http.Request) {
+		controllers.RejectDraft(db, w, r)
+	})
+	mux.HandleFunc("POST /api/drafts/{id}/publish", func(w http.ResponseWriter, r *http.Request) {
+		controllers.PublishDraft(db, w, r)
+	})
+	// Zeitpläne: Veröffentlichen eines Entwurfs bzw. Entfernen eines Live-Datensatzes
+	mux.HandleFunc("PUT /api/drafts/{id}/schedule", func(w http.ResponseWriter, r *http.Request) {
+		controllers.SetDraftSchedule(db, w, r)
+	})
+	mux.HandleFunc("GET /api/schedules", func(w http.ResponseWriter, r *http.Request) {
+		controllers.ListSchedules(db, w, r)
+	})
+	mux.HandleFunc("PUT /api/schedules/{schema}/{table}/{pk}", func(w http.ResponseWriter, r *http.Request) {
+		controllers.SetRecordSchedule(db, w, r)
+	})
+
+	// Änderungen an Datensätzen als Server-Sent Events
+	mux.HandleFunc("GET /api/events", func(w http.ResponseWriter, r *http.Request) {
+		controllers.StreamEvents(db, w, r)
+	})
+
+	// Bearbeitungssperren für das Formular: anfordern, verlängern, freigeben und (Scope admin) aufheben
+	mux.HandleFunc("GET /api/locks", func(w http.ResponseWriter, r *http.Request) {
+		controllers.ListLocks(db, w, r)
+	})
+	mux.HandleFunc("POST /api/locks/{schema}/{table}/{pk}", func(w http.ResponseWriter, r *http.Request) {
+		controllers.AcquireLock(db, w, r)
+	})
+	mux.HandleFunc("POST /api/locks/{schema}/{table}/{pk}/heartbeat", func(w http.ResponseWriter, r *http.Request) {
+		controllers.HeartbeatLock(db, w, r)
+	})
+	mux.HandleFunc("POST /api/locks/{schema}/{table}/{pk}/release", func(w http.ResponseWriter, r *http.Request) {
+		controllers.ReleaseLock(db, w, r)
+	})
+	mux.HandleFunc("POST /api/locks/{schema}/{table}/{pk}/break", func(w http.ResponseWriter, r *http.Request) {
+		controllers.BreakLock(db, w, r)
+	})
+
+	// Webhooks (Scope admin): Konfiguration, Protokoll der Zustellungen und erneutes Zustellen
+	mux.HandleFunc("GET /api/webhooks", controllers.ListWebhooks)
+	mux.HandleFunc("GET /api/webhooks/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		controllers.ListWebhookDeliveries(db, w, r)
+	})
+	mux.HandleFunc("GET /api/webhooks/deliveries/{id}", func(w http.ResponseWriter, r *http.Request) {
+		controllers.GetWebhookDelivery(db, w, r)
+	})
+	mux.HandleFunc("POST /api/webhooks/deliveries/{id}/redeliver", func(w http.ResponseWriter, r *http.Request) {
+		controllers.RedeliverWebhook(db, w, r)
+	})
+
+	// Unbekannte API-Pfade mit JSON-Fehler statt der Hauptseite beantworten
+	mux.HandleFunc("/api/", controllers.NotFound)
+
+	// REST-Schnittstelle mit HTTP-Verben und Statuscodes
+	mux.HandleFunc("GET /api/v2/tables/{schema}/{table}/rows", func(w http.ResponseWriter, r *http.Request) {
+		controllers.ListRows(db, w, r)
+	})
+	mux.HandleFunc("POST /api/v2/tables/{schema}/{table}/rows", func(w http.ResponseWriter, r *http.Request) {
+		controllers.CreateRow(db, w, r)
+	})
+	mux.HandleFunc("GET /api/v2/tables/{schema}/{table}/rows/{pk}", func(w http.ResponseWriter, r *http.Request) {
+		controllers.GetRow(db, w, r)
+	})
+	mux.HandleFunc("PUT /api/v2/tables/{schema}/{table}/rows/{pk}", func(w http.ResponseWriter, r *http.Request) {
+		controllers.ReplaceRow(db, w, r)
+	})
+	mux.HandleFunc("PATCH /api/v2/tables/{schema}/{table}/rows/{pk}", func(w http.ResponseWriter, r *http.Request) {
+		controllers.PatchRow(db, w, r)
+	})
+	mux.HandleFunc("DELETE /api/v2/tables/{schema}/{table}/rows/{pk}", func(w http.ResponseWriter, r *http.Request) {
+		controllers.DeleteRow(db, w, r)
+	})
+
+	// Von außen nach innen: Trace-Span, Request-ID, Schutz-Header, Access-Log, Metriken, Anmeldung,
+	// Ratenbegrenzung (je Benutzer braucht die Anmeldung), CORS, CSRF, Berechtigung, Span-Name nach Route
+	var handler http.Handler = middleware.Route(mux)
+	handler = authn.Authorize(requiredScope, handler)
+	handler = middleware.CSRF(handler)
+	handler = publicAPI(middleware.CORS(cors, handler), handler)
+	handler = middleware.RateLimiter(limits, rateGroup, handler)
+	handler = authn.Authenticate(handler)
+	handler = middleware.Metrics(handler)
+	handler = middleware.AccessLog(handler)
+	handler = middleware.SecurityHeaders(assets.Origins(), handler)
+	handler = middleware.RequestID(handler)
+	return middleware.Tracing(handler)
+}
+
+// publicAPI leitet die öffentliche API über api, alle anderen Pfade über other
+func publicAPI(api, other http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/v2/") || r.URL.Path == "/graphql" || r.URL.Path == "/api/openapi.json" {
+			api.ServeHTTP(w, r)
+			return
+		}
+		other.ServeHTTP(w, r)
+	})
+}
+
+// rateGroup ordnet Anfragen den Gruppen aus rate_limit.groups zu; Oberfläche, Proben und Metriken bleiben unbegrenzt
+func rateGroup(r *http.Request) string {
+	switch {
+	case r.URL.Path == "/auth/login" || r.URL.Path == "/auth/callback":
+		return "login"
+	case r.URL.Path == "/graphql":
+		return "api"
+	case !strings.HasPrefix(r.URL.Path, "/api/") && !strings.HasPrefix(r.URL.Path, "/auth/"):
+		return ""
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return "api"
+	}
+	return "write"
+}
+
+// requiredScope nennt den Scope, den eine Anfrage braucht; leer = ohne Anmeldung erreichbar.
+// GraphQL-Mutationen prüfen Schreiben und Löschen selbst, die Token-Verwaltung verlangt eine Sitzung.
+// Prüfschritte an Entwürfen (approve, reject, publish) und das geplante Entfernen von Live-Datensätzen brauchen publish,
+// das Aufheben fremder Bearbeitungssperren und die Webhooks admin.
+func requiredScope(r *http.Request) string {
+	switch {
+	case r.URL.Path == "/graphql":
+		return auth.ScopeRead
+	case r.URL.Path == "/api/tokens" || strings.HasPrefix(r.URL.Path, "/api/tokens/"):
+		return ""
+	case !strings.HasPrefix(r.URL.Path, "/api/"):
+		return ""
+	case r.URL.Path == "/api/delete-record" || r.Method == http.MethodDelete:
+		return auth.ScopeDelete
+	case strings.HasPrefix(r.URL.Path, "/api/drafts/") && r.Method == http.MethodPost:
+		return auth.ScopePublish
+	case strings.HasPrefix(r.URL.Path, "/api/schedules/") && r.Method == http.MethodPut:
+		return auth.ScopePublish
+	case strings.HasPrefix(r.URL.Path, "/api/locks/") && strings.HasSuffix(r.URL.Path, "/break"):
+		return auth.ScopeAdmin
+	case r.URL.Path == "/api/webhooks" || strings.HasPrefix(r.URL.Path, "/api/webhooks/"):
+		return auth.ScopeAdmin
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return auth.ScopeRead
+	}
+	return auth.ScopeWrite
 }
@@ -0,0 +1,117 @@
+package routes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"wuffnetCMS/auth"
+	"wuffnetCMS/metrics"
+	"wuffnetCMS/middleware"
+	"wuffnetCMS/web"
+)
+
+// discoveryServer liefert nur die OIDC-Discovery; mehr braucht auth.New nicht
+func discoveryServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                srv.URL,
+			"authorization_endpoint":                srv.URL + "/authorize",
+			"token_endpoint":                        srv.URL + "/token",
+			"jwks_uri":                              srv.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// requestCount liest den Zähler cms_http_requests_total für route, method und status aus /metrics
+func requestCount(t *testing.T, route, method string, status int) float64 {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	prefix := `cms_http_requests_total{method="` + method + `",route="` + route + `",status="` + strconv.Itoa(status) + `"} `
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), prefix); ok {
+			count, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatalf("invalid metric line %q", scanner.Text())
+			}
+			return count
+		}
+	}
+	return 0
+}
+
+// Mit Anmeldung liegt Authenticate zwischen Metrics/AccessLog und dem Mux und kopiert den Request;
+// Route und Metriken müssen trotzdem das Muster des Mux erhalten
+func TestRouteLabelWithAuthentication(t *testing.T) {
+	issuer := discoveryServer(t)
+	authn, err := auth.New(context.Background(), nil, "cms", auth.Options{
+		OIDC: auth.OIDCOptions{Issuer: issuer.URL, ClientID: "cms", RedirectURL: "http://localhost/auth/callback"},
+	}, middleware.LockoutOptions{})
+	if err != nil || authn == nil {
+		t.Fatalf("auth.New: %v", err)
+	}
+	assets, err := web.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := SetupRoutes(nil, assets, authn, middleware.CORSOptions{}, middleware.RateLimitOptions{})
+
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	tests := []struct {
+		path   string
+		route  string
+		status int
+	}{
+		{"/healthz", "GET /healthz", http.StatusOK},
+		{"/auth/me", "GET /auth/me", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			logs.Reset()
+			before := requestCount(t, tt.route, http.MethodGet, tt.status)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+
+			if after := requestCount(t, tt.route, http.MethodGet, tt.status); after != before+1 {
+				t.Errorf("cms_http_requests_total{route=%q} = %v, want %v", tt.route, after, before+1)
+			}
+			found := false
+			for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+				var entry map[string]interface{}
+				if json.Unmarshal([]byte(line), &entry) == nil && entry["msg"] == "HTTP request" {
+					found = true
+					if entry["route"] != tt.route {
+						t.Errorf("access log route = %v, want %q", entry["route"], tt.route)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("no access log entry in %q", logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"log/slog"
+	"time"
+)
+
+// Schlüssel für pg_try_advisory_lock; nur die Instanz, deren Verbindung ihn hält, führt die Jobs aus
+const lockKey = 7305468
+
+// Options legt fest, wie oft fällige Aufgaben geprüft werden
+type Options struct {
+	Interval time.Duration `yaml:"interval"` // Abstand der Durchläufe, 0 = Scheduler aus
+}
+
+// Job ist eine Aufgabe, die bei jedem Durchlauf des Leaders ausgeführt wird
+type Job struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Run führt die Jobs im Abstand opts.Interval aus, solange diese Instanz Leader ist, und kehrt zurück,
+// sobald ctx beendet ist. Bei mehreren Instanzen wird über einen Advisory Lock in Postgres bestimmt,
+// wer Leader ist; endet dessen Sitzung, übernimmt eine andere Instanz beim nächsten Durchlauf.
+func Run(ctx context.Context, db *sql.DB, opts Options, jobs ...Job) {
+	if opts.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	var leader *sql.Conn
+	defer func() {
+		if leader != nil {
+			release(leader)
+		}
+	}()
+	for {
+		leader = lead(ctx, db, leader)
+		if leader != nil {
+			for _, job := range jobs {
+				if err := job.Run(ctx); err != nil && ctx.Err() == nil {
+					slog.Error("Scheduled job failed", "job", job.Name, "error", err)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lead prüft die Verbindung des bisherigen Leaders bzw. versucht, den Lock zu übernehmen.
+// nil heißt, dass eine andere Instanz Leader ist oder die Datenbank nicht erreichbar war.
+func lead(ctx context.Context, db *sql.DB, conn *sql.Conn) *sql.Conn {
+	if conn != nil {
+		err := conn.PingContext(ctx)
+		if err == nil {
+			return conn
+		}
+		if ctx.Err() != nil {
+			return conn
+		}
+		// Ohne sichere Sitzung ist auch der Lock nicht mehr sicher; die Verbindung wird verworfen, damit Postgres ihn freigibt
+		slog.Warn("Lost scheduler leadership", "error", err)
+		discard(conn)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Warn("Scheduler could not connect to the database", "error", err)
+		}
+		return nil
+	}
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", lockKey).Scan(&acquired); err != nil || !acquired {
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("Scheduler could not try the leader lock", "error", err)
+		}
+		conn.Close()
+		return nil
+	}
+	slog.Info("Became scheduler leader")
+	return conn
+}
+
+// release gibt den Lock beim Beenden frei, damit eine andere Instanz sofort übernehmen kann
+func release(conn *sql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+		discard(conn)
+		return
+	}
+	conn.Close()
+	slog.Info("Released scheduler leadership")
+}
+
+// discard schließt die Verbindung, statt sie an den Pool zurückzugeben; mit der Sitzung endet der Lock
+func discard(conn *sql.Conn) {
+	conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	conn.Close()
+}
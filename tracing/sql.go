@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// SQLOptions instrumentiert den Datenbanktreiber: ein Span je Statement mit bereinigtem
+// SQL-Text und den betroffenen Tabellen. Parameterwerte werden nie aufgezeichnet.
+func SQLOptions() []otelsql.Option {
+	return []otelsql.Option{
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableQuery:         true, // Ersetzt durch den bereinigten Text in sqlAttributes
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+		otelsql.WithSpanNameFormatter(sqlSpanName),
+		otelsql.WithAttributesGetter(sqlAttributes),
+	}
+}
+
+func sqlSpanName(ctx context.Context, method otelsql.Method, query string) string {
+	if query == "" {
+		return string(method)
+	}
+	name := statementVerb(query)
+	if tables := statementTables(query); len(tables) > 0 {
+		name += " " + tables[0]
+	}
+	return name
+}
+
+func sqlAttributes(ctx context.Context, method otelsql.Method, query string, args []driver.NamedValue) []attribute.KeyValue {
+	if query == "" {
+		return nil
+	}
+	attrs := []attribute.KeyValue{
+		semconv.DBQueryText(SanitizeStatement(query)),
+		semconv.DBOperationName(statementVerb(query)),
+	}
+	if tables := statementTables(query); len(tables) > 0 {
+		attrs = append(attrs, semconv.DBCollectionName(tables[0]), attribute.StringSlice("cms.db.tables", tables))
+	}
+	return attrs
+}
+
+// Literale, die Inhalte aus Datensätzen enthalten könnten; $n-Platzhalter bleiben erhalten
+var (
+	sqlLiteral    = regexp.MustCompile(`'(?:[^']|'')*'|\$\d+|\b\d+(?:\.\d+)?\b`)
+	sqlWhitespace = regexp.MustCompile(`\s+`)
+	sqlTable      = regexp.MustCompile(`(?i)\b(?:FROM|JOIN|INTO|UPDATE)\s+((?:"(?:[^"]|"")+"|[A-Za-z_][\w$]*)(?:\.(?:"(?:[^"]|"")+"|[A-Za-z_][\w$]*))?)`)
+)
+
+// SanitizeStatement ersetzt String- und Zahlenliterale durch ? und fasst Leerraum zusammen
+func SanitizeStatement(query string) string {
+	query = sqlLiteral.ReplaceAllStringFunc(query, func(match string) string {
+		if strings.HasPrefix(match, "$") {
+			return match
+		}
+		return "?"
+	})
+	return strings.TrimSpace(sqlWhitespace.ReplaceAllString(query, " "))
+}
+
+func statementVerb(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// statementTables liefert die Tabellen hinter FROM, JOIN, INTO und UPDATE ohne Anführungszeichen
+func statementTables(query string) []string {
+	var tables []string
+	seen := map[string]bool{}
+	for _, match := range sqlTable.FindAllStringSubmatch(query, -1) {
+		table := strings.ReplaceAll(match[1], `"`, "")
+		if !seen[table] {
+			seen[table] = true
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
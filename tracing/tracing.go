@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name des Tracers für eigene Spans des CMS
+const instrumentationName = "wuffnetCMS"
+
+// Options legt fest, ob und wohin Spans exportiert werden
+type Options struct {
+	Exporter    string  `yaml:"exporter"`     // none, otlp oder stdout
+	Endpoint    string  `yaml:"endpoint"`     // host:port des OTLP/HTTP-Collectors, leer = OTEL_EXPORTER_OTLP_ENDPOINT bzw. localhost:4318
+	Insecure    bool    `yaml:"insecure"`     // OTLP ohne TLS, z. B. für einen lokalen Collector
+	SampleRatio float64 `yaml:"sample_ratio"` // Anteil neuer Traces, die aufgezeichnet werden (0..1)
+	ServiceName string  `yaml:"service_name"`
+}
+
+// Setup richtet den globalen TracerProvider ein. Die zurückgegebene Funktion exportiert
+// ausstehende Spans und muss beim Beenden aufgerufen werden. stdout nimmt den Writer für den Exporter "stdout".
+func Setup(ctx context.Context, opts Options, stdout io.Writer) (func(context.Context) error, error) {
+	// W3C Trace Context auch ohne Export weiterreichen, damit eingehende Trace-IDs in den Logs erscheinen
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch opts.Exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(stdout))
+	case "otlp":
+		var clientOpts []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, clientOpts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(opts.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer liefert den Tracer für eigene Spans, z. B. im Scheduler
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
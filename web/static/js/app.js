@@ -0,0 +1,278 @@
+const API_URL = '/api';
+let currentSchema = null;
+let currentTable = null;
+let currentPage = 1;
+let hasNextPage = false;
+let currentOrder = 'asc'; // Standard Sortierreihenfolge
+
+document.addEventListener("DOMContentLoaded", () => {
+    M.Collapsible.init(document.querySelectorAll('.collapsible'));
+    M.FormSelect.init(document.querySelectorAll('select'));
+
+    loadSchemaAndTables();
+
+    async function loadSchemaAndTables() {
+        try {
+            const response = await fetch(`${API_URL}/tables`);
+            const schemas = await response.json();
+            const schemaList = document.getElementById("schema-list");
+            schemaList.innerHTML = '';
+
+            schemas.forEach(schema => {
+                const schemaItem = document.createElement("li");
+                const schemaHeader = document.createElement("div");
+                schemaHeader.className = "collapsible-header schema-name";
+                schemaHeader.textContent = schema.schema;
+
+                const tableList = document.createElement("div");
+                tableList.className = "collapsible-body";
+                const ul = document.createElement("ul");
+                ul.className = "table-list";
+
+                schema.tables.forEach(table => {
+                    const tableItem = document.createElement("li");
+                    tableItem.className = "table-item";
+                    tableItem.textContent = table.tableName;
+                    tableItem.addEventListener("click", () => {
+                        currentSchema = schema.schema;
+                        currentTable = table.tableName;
+                        currentPrivateKey = table.primaryKeyColumn;
+                        currentPage = 1;
+                        loadTableContent();
+                        watchTable();
+                    });
+                    ul.appendChild(tableItem);
+                });
+
+                tableList.appendChild(ul);
+                schemaItem.appendChild(schemaHeader);
+                schemaItem.appendChild(tableList);
+                schemaList.appendChild(schemaItem);
+            });
+        } catch (error) {
+            console.error("Fehler beim Laden der Tabellen:", error);
+        }
+    }
+
+    async function loadTableContent(sortColumn = null) {
+        if (!currentSchema || !currentTable) return;
+        const limit = document.getElementById("limit-dropdown").value;
+        const search = document.getElementById("search").value;
+        const offset = (currentPage - 1) * limit;
+        const sortParam = sortColumn ? `&sort_by=${sortColumn}&order=${currentOrder}` : '';
+
+        const url = `${API_URL}/table-content?schema=${currentSchema}&table=${currentTable}&limit=${limit}&filter=${search}&offset=${offset}${sortParam}`;
+        try {
+            const response = await fetch(url);
+            if (!response.ok) {
+                // z. B. Zeitüberschreitung oder zu teure Abfrage: Meldung des Servers anzeigen
+                const { error } = await response.json();
+                alert(`Fehler beim Laden: ${error.message}`);
+                return;
+            }
+            const { data, hasNextPage: nextPageExists } = await response.json();
+            hasNextPage = nextPageExists;
+            renderTable(data);
+            togglePaginationButtons();
+        } catch (error) {
+            console.error("Fehler beim Laden des Tabelleninhalts:", error);
+        }
+    }
+
+    // Änderungen anderer Benutzer an der angezeigten Tabelle live übernehmen
+    let eventSource = null;
+    let reloadTimer = null;
+    function watchTable() {
+        if (eventSource) eventSource.close();
+        eventSource = new EventSource(`${API_URL}/events?schema=${encodeURIComponent(currentSchema)}&table=${encodeURIComponent(currentTable)}`);
+        ["insert", "update", "delete", "reload"].forEach(type => eventSource.addEventListener(type, () => {
+            // Mehrere Änderungen kurz hintereinander (z. B. ein Import) nur einmal laden
+            clearTimeout(reloadTimer);
+            reloadTimer = setTimeout(loadTableContent, 300);
+        }));
+    }
+
+    function renderTable(data) {
+        const tableHead = document.getElementById("table-head");
+        const tableBody = document.getElementById("table-body");
+
+        tableHead.innerHTML = '';
+        const headRow = document.createElement("tr");
+
+        // Markierungen wie _lock sind keine Spalten
+        const isColumn = column => !column.startsWith("_");
+        if (data.length > 0) {
+            Object.keys(data[0]).filter(isColumn).forEach(column => {
+                const th = document.createElement("th");
+                th.textContent = column;
+                th.onclick = () => toggleSort(column);
+                headRow.appendChild(th);
+            });
+        }
+        tableHead.appendChild(headRow);
+
+        tableBody.innerHTML = '';
+        data.forEach(row => {
+            const tr = document.createElement("tr");
+            Object.keys(row).filter(isColumn).forEach(column => {
+                const td = document.createElement("td");
+                td.textContent = row[column];
+                tr.appendChild(td);
+            });
+            if (row._lock) {
+                tr.classList.add("table-row-locked");
+                tr.title = `Wird gerade von ${row._lock.userName} bearbeitet`;
+            }
+            tableBody.appendChild(tr);
+        });
+
+        updatePageInfo();
+    }
+
+    function toggleSort(column) {
+        currentOrder = currentOrder === 'asc' ? 'desc' : 'asc';
+        loadTableContent(column);
+    }
+
+    function updatePageInfo() {
+        document.getElementById("page-info").textContent = `Seite ${currentPage}`;
+    }
+
+    function togglePaginationButtons() {
+        document.getElementById("prev-page").classList.toggle("disabled", currentPage === 1);
+        document.getElementById("next-page").classList.toggle("disabled", !hasNextPage);
+    }
+
+    document.getElementById("prev-page").addEventListener("click", () => {
+        if (currentPage > 1) {
+            currentPage--;
+            loadTableContent();
+        }
+    });
+
+    document.getElementById("next-page").addEventListener("click", () => {
+        if (hasNextPage) {
+            currentPage++;
+            loadTableContent();
+        }
+    });
+
+    document.getElementById("limit-dropdown").addEventListener("change", () => {
+        currentPage = 1;
+        loadTableContent();
+    });
+
+    document.getElementById("search").addEventListener("input", () => {
+        currentPage = 1;
+        loadTableContent();
+    });
+});
+
+let selectedRowData = null; // Speichert die Daten der ausgewählten Zeile
+
+document.addEventListener("DOMContentLoaded", () => {
+    // Funktion zur Aktivierung/Deaktivierung der Bearbeiten- und Löschen-Buttons
+    function toggleActionButtons(enable) {
+        document.getElementById("edit-btn").classList.toggle("disabled", !enable);
+        document.getElementById("delete-btn").classList.toggle("disabled", !enable);
+    }
+    // Event-Listener für den 'Neu'-Button
+    document.getElementById("new-btn").addEventListener("click", () => {
+        selectedRowData = null; // Kein Datensatz ausgewählt
+        openModal(); // Öffnet Modal ohne Daten
+    });
+
+    // Event-Listener für den 'Bearbeiten'-Button
+    document.getElementById("edit-btn").addEventListener("click", () => {
+        if (selectedRowData) openModal(selectedRowData); // Modal mit Daten füllen
+    });
+
+    document.getElementById("delete-btn").addEventListener("click", () => {
+        if (selectedRowData) {
+            const primaryKeyValue = selectedRowData[currentPrivateKey];
+            deleteRecord(primaryKeyValue);
+        } else {
+            alert("Kein Datensatz ausgewählt.");
+        }
+    });
+
+    document.addEventListener("DOMContentLoaded", () => {
+    function toggleActionButtons(enable) {
+        document.getElementById("edit-btn").classList.toggle("disabled", !enable);
+        document.getElementById("delete-btn").classList.toggle("disabled", !enable);
+    }
+
+    document.getElementById("table-body").addEventListener("click", (event) => {
+        const row = event.target.closest("tr");
+        if (!row) return;
+
+        document.querySelectorAll("#table-body tr").forEach(r => r.classList.remove("table-row-active"));
+        row.classList.add("table-row-active");
+
+        selectedRowData = Array.from(row.cells).reduce((obj, cell, index) => {
+            const column = document.querySelector(`#table-head th:nth-child(${index + 1})`).textContent;
+            obj[column] = cell.textContent;
+            return obj;
+        }, {});
+
+        toggleActionButtons(true);
+    });
+
+    toggleActionButtons(false);
+});
+
+// Tabellenzeile auswählen und hervorgehoben anzeigen
+document.getElementById("table-body").addEventListener("click", (event) => {
+    const row = event.target.closest("tr");
+    if (!row) return;
+
+    // Entferne Hervorhebung bei allen anderen Zeilen
+    document.querySelectorAll("#table-body tr").forEach(r => r.classList.remove("table-row-active"));
+    row.classList.add("table-row-active");
+
+    // Hole die Daten der ausgewählten Zeile
+    selectedRowData = Array.from(row.cells).reduce((obj, cell, index) => {
+        const column = document.querySelector(`#table-head th:nth-child(${index + 1})`).textContent;
+        obj[column] = cell.textContent;
+        return obj;
+    }, {});
+
+        toggleActionButtons(true); // Buttons aktivieren
+    });
+
+    // Deaktiviert die 'Bearbeiten' und 'Löschen' Buttons, wenn keine Zeile ausgewählt ist
+    toggleActionButtons(false);
+});
+
+function deleteRecord(primaryKeyValue) {
+if (!primaryKeyValue || !currentPrivateKey) {
+    alert("Kein gültiger Datensatz ausgewählt.");
+    return;
+}
+
+const confirmDelete = confirm("Möchten Sie diesen Datensatz wirklich löschen?");
+if (!confirmDelete) return;
+
+fetch("/api/delete-record", {
+    method: "POST",
+    headers: {
+        "Content-Type": "application/json"
+    },
+    body: JSON.stringify({
+        schema: currentSchema,
+        table: currentTable,
+        primaryKey: currentPrivateKey,
+        primaryKeyValue: primaryKeyValue
+    })
+})
+.then(response => {
+    if (response.ok) {
+        alert("Datensatz erfolgreich gelöscht.");
+        loadTableContent();  // Aktualisiert die Tabelle nach dem Löschen
+    } else {
+        response.json().then(({ error }) => {
+            alert(`Fehler beim Löschen: ${error.message}`);
+        });
+    }
+});
+}
@@ -0,0 +1,27 @@
+// Zeigt den angemeldeten Benutzer mit Abmelde-Button und schickt nach Ablauf der Sitzung zur Anmeldung
+(function () {
+    const originalFetch = window.fetch;
+
+    window.fetch = async function (input, init) {
+        const response = await originalFetch.call(this, input, init);
+        const url = new URL(input instanceof Request ? input.url : input, window.location.href);
+        if (response.status === 401 && url.origin === window.location.origin) {
+            window.location.href = "/auth/login";
+        }
+        return response;
+    };
+
+    document.addEventListener("DOMContentLoaded", async () => {
+        // 404: Anmeldung ist nicht konfiguriert
+        const response = await originalFetch("/auth/me");
+        if (!response.ok) return;
+        const user = await response.json();
+
+        document.getElementById("user-name").textContent = user.name;
+        document.getElementById("user-info").style.display = "";
+        document.getElementById("logout-btn").addEventListener("click", async () => {
+            await fetch("/auth/logout", { method: "POST" });
+            window.location.href = "/";
+        });
+    });
+})();
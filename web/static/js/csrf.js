@@ -0,0 +1,20 @@
+// Schickt bei ändernden Anfragen an den eigenen Server das CSRF-Token aus dem Cookie als Header mit
+(function () {
+    const originalFetch = window.fetch;
+
+    function csrfToken() {
+        const match = document.cookie.match(/(?:^|;\s*)cms_csrf=([^;]+)/);
+        return match ? match[1] : "";
+    }
+
+    window.fetch = function (input, init = {}) {
+        const method = (init.method || (input instanceof Request ? input.method : "GET")).toUpperCase();
+        const url = new URL(input instanceof Request ? input.url : input, window.location.href);
+        if (!["GET", "HEAD", "OPTIONS"].includes(method) && url.origin === window.location.origin) {
+            const headers = new Headers(init.headers || (input instanceof Request ? input.headers : undefined));
+            headers.set("X-CSRF-Token", csrfToken());
+            init = { ...init, headers };
+        }
+        return originalFetch.call(this, input, init);
+    };
+})();
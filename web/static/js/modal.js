@@ -14,9 +14,10 @@ async function loadFormFields(tableSchema, tableName, record = {}) {
         columns.forEach(column => {
             const fieldWrapper = document.createElement("div");
             fieldWrapper.className = "form-field-wrapper"; // Zweispaltige Anordnung
+            fieldWrapper.dataset.field = column.name; // Für die Zuordnung von Feldfehlern
 
             const label = document.createElement("label");
-            label.textContent = column.name;
+            label.textContent = column.required ? `${column.name} *` : column.name;
             label.className = "form-label";
             label.setAttribute("for", column.name);
 
@@ -28,6 +29,7 @@ async function loadFormFields(tableSchema, tableName, record = {}) {
                     input.value = record[column.name] || "";
                     input.name = column.name;
                     if (column.readonly) input.setAttribute("readonly", true);
+                    applyConstraints(input, column);
                     fieldWrapper.appendChild(label);
                     fieldWrapper.appendChild(input);
                     formFields.appendChild(fieldWrapper);
@@ -70,6 +72,7 @@ async function loadFormFields(tableSchema, tableName, record = {}) {
                     input.setAttribute("title", "Bitte eine gültige Zahl im Format 123,45 eingeben");
                     input.value = record[column.name] || "";
                     if (column.readonly) input.setAttribute("readonly", true);
+                    applyConstraints(input, { ...column, pattern: "" }); // Das Zahlenmuster bleibt erhalten
                     // Verhindert Eingabe von Buchstaben und anderen unerwünschten Zeichen
                     input.addEventListener("input", (event) => {
                         // Überschreibe Eingabe mit dem, was dem Muster entspricht
@@ -270,14 +273,16 @@ async function loadFormFields(tableSchema, tableName, record = {}) {
 
                 default:
                     input = document.createElement("input");
-                    input.type = "text";
+                    input.type = column.format === "email" ? "email" : column.format === "url" ? "url" : "text";
                     input.value = record[column.name] || "";
                     input.name = column.name;
                     if (column.readonly) input.setAttribute("readonly", true);
+                    applyConstraints(input, column);
                     fieldWrapper.appendChild(label);
                     fieldWrapper.appendChild(input);
                     break;
             }
+            markAutoField(fieldWrapper, column);
             formFields.appendChild(fieldWrapper);
         });
 
@@ -286,8 +291,77 @@ async function loadFormFields(tableSchema, tableName, record = {}) {
         console.error("Fehler bei der Feldinitialisierung:", error);
     }
 }
+// Kennzeichnet Felder, deren Wert die Datenbank vergibt (Default, Identity, generierte Spalte)
+function markAutoField(fieldWrapper, column) {
+    const generated = column.generated || column.identity === "ALWAYS";
+    fieldWrapper.querySelectorAll("input, select, textarea").forEach(input => {
+        // Generierte Werte werden nie mitgesendet
+        if (generated) input.dataset.generated = "true";
+        else if (column.auto && !column.readonly && !input.placeholder) input.placeholder = "automatisch";
+    });
+    if (column.auto) {
+        const label = fieldWrapper.querySelector("label");
+        if (label) label.title = column.default ? `Standardwert: ${column.default}` : "Wird von der Datenbank vergeben";
+    }
+}
+
+// Überträgt die serverseitigen Vorgaben (Constraints und Zusatzregeln) auf ein Eingabefeld
+function applyConstraints(input, column) {
+    if (column.readonly) return;
+    if (column.required) input.required = true;
+    if (column.maxLength != null) input.maxLength = column.maxLength;
+    if (column.minLength != null) input.minLength = column.minLength;
+    if (column.min != null && input.type === "number") input.min = column.min;
+    if (column.max != null && input.type === "number") input.max = column.max;
+    if (column.pattern) input.pattern = column.pattern;
+}
+
+// Bearbeitungssperre des geöffneten Datensatzes (URL), null bei neuen Einträgen oder ohne Anmeldung
+let editLock = null;
+let editLockTimer = null;
+
+// Sperrt den Datensatz für die Dauer der Bearbeitung; false, wenn ihn ein anderer Benutzer bearbeitet
+async function acquireEditLock(primaryKeyValue) {
+    const url = `/api/locks/${encodeURIComponent(currentSchema)}/${encodeURIComponent(currentTable)}/${encodeURIComponent(primaryKeyValue)}`;
+    const response = await fetch(url, { method: "POST" });
+    if (!response.ok) {
+        const { error } = await response.json().catch(() => ({}));
+        if (error && error.code === "locked") {
+            alert(`Bearbeiten nicht möglich: ${error.message}`);
+            return false;
+        }
+        return true; // z. B. ohne Anmeldung: ohne Sperre bearbeiten
+    }
+    const lock = await response.json();
+    editLock = url;
+
+    // Heartbeat nach einem Drittel der Laufzeit, gemessen an der Uhr des Servers
+    const serverNow = new Date(response.headers.get("Date") || Date.now());
+    const interval = Math.max((new Date(lock.expiresAt) - serverNow) / 3, 5000);
+    editLockTimer = setInterval(async () => {
+        const heartbeat = await fetch(`${url}/heartbeat`, { method: "POST" });
+        if (heartbeat.status === 409) {
+            clearInterval(editLockTimer);
+            editLock = null;
+            alert("Die Bearbeitungssperre wurde aufgehoben. Änderungen anderer Benutzer können überschrieben werden.");
+        }
+    }, interval);
+    return true;
+}
+
+// Gibt die Sperre beim Schließen des Modals bzw. Verlassen der Seite frei
+function releaseEditLock() {
+    clearInterval(editLockTimer);
+    if (editLock) fetch(`${editLock}/release`, { method: "POST", keepalive: true });
+    editLock = null;
+}
+window.addEventListener("pagehide", releaseEditLock);
+
 // Öffnet das Modal und setzt ggf. Felder zurück
-function openModal(record = null) {
+async function openModal(record = null) {
+    if (record && currentPrivateKey && record[currentPrivateKey]) {
+        if (!await acquireEditLock(record[currentPrivateKey])) return;
+    }
     resetForm();
 
     const modal = document.getElementById("modal-container");
@@ -333,6 +407,7 @@ function populateModalFields(modal, data) {
 
 // Schließt das Modal und entfernt das Overlay
 function closeModal() {
+    releaseEditLock();
     document.getElementById("modal-container").style.display = "none";
     const overlay = document.querySelector(".modal-overlay");
     if (overlay) overlay.remove();
@@ -340,10 +415,11 @@ function closeModal() {
 
 async function submitForm() {
     const form = document.getElementById("editForm");
+    if (!form.reportValidity()) return; // Browser-Validierung anhand der Feldvorgaben
     const data = {
         schema: currentSchema,
         table: currentTable,
-        primaryKey: "", 
+        primaryKey: currentPrivateKey || "",
         columns: []
     };
 
@@ -351,6 +427,8 @@ async function submitForm() {
     form.querySelectorAll("input, select, textarea").forEach((input) => {
         // Überspringe Felder ohne Namen
         if (!input.name) return;
+        // Generierte Spalten und GENERATED ALWAYS-Identitäten nicht senden
+        if (input.dataset.generated) return;
 
         let value = input.value;
 
@@ -421,12 +499,60 @@ async function submitForm() {
         if (response.ok) {
             const result = await response.json();
             console.log("Speichern erfolgreich:", result);
+            if (response.status === 202) {
+                // Tabelle mit Freigabe-Workflow: die Änderung wird erst nach Prüfung veröffentlicht
+                alert("Die Änderung wurde als Entwurf gespeichert und wartet auf Freigabe.");
+            }
             closeModal(); // Schließt das Modal nach erfolgreichem Speichern
             loadTableContent(); // Aktualisiert die Tabelle
         } else {
-            const error = await response.text();
+            const { error } = await response.json();
             console.error("Fehler beim Speichern:", error);
-            alert(`Fehler beim Speichern: ${error}`);
+            showFieldErrors(error);
         }
     } catch (error) { }
-}
\ No newline at end of file
+}
+
+// Deutsche Texte zu den Fehlercodes der API
+const FIELD_ERROR_MESSAGES = {
+    required: "Dieses Feld ist ein Pflichtfeld.",
+    unique: "Dieser Wert ist bereits vergeben.",
+    reference: "Der verknüpfte Datensatz existiert nicht.",
+    check: "Dieser Wert ist nicht zulässig.",
+    invalid_format: "Ungültiges Format.",
+    unknown_column: "Unbekannte Spalte.",
+    too_long: "Der Wert ist zu lang.",
+    too_short: "Der Wert ist zu kurz.",
+    out_of_range: "Der Wert liegt außerhalb des erlaubten Bereichs.",
+    pattern: "Der Wert entspricht nicht dem erwarteten Muster.",
+    email: "Bitte eine gültige E-Mail-Adresse eingeben.",
+    url: "Bitte eine gültige URL eingeben."
+};
+
+// Zeigt Feldfehler direkt unter dem betroffenen Eingabefeld an, alle übrigen als Hinweis
+function showFieldErrors(error) {
+    document.querySelectorAll("#form-fields .field-error").forEach(el => el.remove());
+
+    const unassigned = [];
+    (error.fields || []).forEach(fieldError => {
+        const wrapper = document.querySelector(`#form-fields [data-field="${CSS.escape(fieldError.field)}"]`);
+        const message = FIELD_ERROR_MESSAGES[fieldError.code] || fieldError.message;
+        if (!wrapper) {
+            unassigned.push(`${fieldError.field}: ${message}`);
+            return;
+        }
+        const hint = document.createElement("span");
+        hint.className = "field-error";
+        hint.textContent = message;
+        wrapper.appendChild(hint);
+    });
+
+    if (!error.fields || error.fields.length === 0 || unassigned.length > 0) {
+        const details = unassigned.length > 0 ? `\n${unassigned.join("\n")}` : "";
+        alert(`Fehler beim Speichern: ${error.message}${details}`);
+    }
+}
+
+// Buttons im Modal; Inline-Handler sind durch die Content-Security-Policy nicht erlaubt
+document.getElementById("modal-cancel").addEventListener("click", closeModal);
+document.getElementById("modal-save").addEventListener("click", submitForm);
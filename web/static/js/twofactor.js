@@ -0,0 +1,93 @@
+// Einrichtung, Prüfung und Verwaltung des zweiten Faktors (TOTP) auf /auth/2fa
+(function () {
+    function show(id) {
+        document.querySelectorAll(".twofactor section").forEach(section => {
+            section.style.display = section.id === id ? "block" : "none";
+        });
+    }
+
+    function showError(message) {
+        document.getElementById("twofactor-error").textContent = message;
+    }
+
+    // post schickt JSON und liefert die Antwort; Fehler zeigt es an und liefert null
+    async function post(url, body) {
+        showError("");
+        const response = await fetch(url, {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify(body),
+        });
+        if (response.status === 204) return {};
+        const data = await response.json().catch(() => ({}));
+        if (!response.ok) {
+            showError(data.error ? data.error.message : "Unbekannter Fehler");
+            return null;
+        }
+        return data;
+    }
+
+    function showRecoveryCodes(codes) {
+        document.getElementById("recovery-codes").textContent = codes.join("\n");
+        show("recovery-section");
+    }
+
+    async function startEnrollment(required) {
+        const data = await post("/auth/totp/enroll", {});
+        if (!data) return;
+        document.getElementById("qr-code").src = data.qrCode;
+        document.getElementById("totp-secret").textContent = data.secret;
+        document.getElementById("enroll-required").style.display = required ? "" : "none";
+        show("enroll-section");
+    }
+
+    document.addEventListener("DOMContentLoaded", async () => {
+        const response = await fetch("/auth/me");
+        if (response.status === 401) {
+            window.location.href = "/auth/login";
+            return;
+        }
+        if (!response.ok) {
+            showError("Die Anmeldung ist nicht konfiguriert.");
+            return;
+        }
+        const user = await response.json();
+
+        document.getElementById("verify-form").addEventListener("submit", async (event) => {
+            event.preventDefault();
+            const recoveryCode = document.getElementById("verify-recovery").value.trim();
+            const code = document.getElementById("verify-code").value.trim();
+            if (await post("/auth/totp/verify", recoveryCode ? { recoveryCode } : { code })) {
+                window.location.href = "/";
+            }
+        });
+
+        document.getElementById("enroll-form").addEventListener("submit", async (event) => {
+            event.preventDefault();
+            const data = await post("/auth/totp/confirm", { code: document.getElementById("enroll-code").value.trim() });
+            if (data) showRecoveryCodes(data.recoveryCodes);
+        });
+
+        document.getElementById("manage-form").addEventListener("submit", async (event) => {
+            event.preventDefault();
+            const code = document.getElementById("manage-code").value.trim();
+            if (event.submitter && event.submitter.id === "disable-btn") {
+                if (await post("/auth/totp/disable", { code })) window.location.href = "/";
+                return;
+            }
+            const data = await post("/auth/totp/recovery-codes", { code });
+            if (data) showRecoveryCodes(data.recoveryCodes);
+        });
+        document.getElementById("disable-btn").style.display = user.twoFactorRequired ? "none" : "";
+
+        if (user.secondFactor === "verify") {
+            show("verify-section");
+        } else if (user.secondFactor === "enroll") {
+            startEnrollment(true);
+        } else if (user.twoFactor) {
+            show("manage-section");
+        } else {
+            startEnrollment(false);
+        }
+    });
+})();
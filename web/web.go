@@ -0,0 +1,230 @@
+// Package web liefert die Oberfläche des CMS aus. Die Dateien sind in das Binary eingebettet;
+// für die Entwicklung können sie stattdessen direkt von der Festplatte gelesen werden.
+package web
+
+//go:generate go run ../cmd/fetch-vendor -manifest vendor.json -dir static/vendor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed templates static vendor.json
+var embedded embed.FS
+
+// VendorFile beschreibt eine Fremdbibliothek, die unter static/vendor abgelegt wird
+type VendorFile struct {
+	Path   string `json:"path"`   // Relativ zu static/vendor
+	URL    string `json:"url"`    // Herkunft, zugleich Fallback solange die Datei nicht vendort ist
+	SHA256 string `json:"sha256"` // Wird von cmd/fetch-vendor beim ersten Download eingetragen
+}
+
+// Assets stellt statische Dateien und das Layout bereit
+type Assets struct {
+	files fs.FS
+	dev   bool
+
+	vendor map[string]VendorFile
+
+	mu     sync.Mutex
+	hashes map[string]string  // Inhalts-Hash je Datei, im Entwicklungsmodus nicht zwischengespeichert
+	pages  *template.Template // Alle Dateien unter templates/, benannt nach Dateiname
+}
+
+// New liefert die eingebetteten Dateien oder, wenn dir gesetzt ist, die Dateien aus diesem Verzeichnis (Entwicklungsmodus)
+func New(dir string) (*Assets, error) {
+	a := &Assets{files: embedded, hashes: map[string]string{}}
+	if dir != "" {
+		if _, err := os.Stat(path.Join(dir, "templates", "layout.html")); err != nil {
+			return nil, fmt.Errorf("assets directory %s: %w", dir, err)
+		}
+		a.files = os.DirFS(dir)
+		a.dev = true
+	}
+
+	manifest, err := fs.ReadFile(a.files, "vendor.json")
+	if err != nil {
+		return nil, err
+	}
+	var vendor []VendorFile
+	if err := json.Unmarshal(manifest, &vendor); err != nil {
+		return nil, fmt.Errorf("invalid vendor.json: %w", err)
+	}
+	a.vendor = map[string]VendorFile{}
+	for _, file := range vendor {
+		a.vendor[file.Path] = file
+	}
+
+	// Fehler in den Templates schon beim Start melden
+	if _, err := a.template(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// hash liefert die ersten 16 Hex-Zeichen des SHA-256 einer Datei unter static/
+func (a *Assets) hash(name string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if hash, ok := a.hashes[name]; ok && !a.dev {
+		return hash, nil
+	}
+
+	content, err := fs.ReadFile(a.files, path.Join("static", name))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])[:16]
+	a.hashes[name] = hash
+	return hash, nil
+}
+
+// URL liefert die Adresse einer Datei unter static/ mit Inhalts-Hash, damit Browser sie dauerhaft cachen können
+func (a *Assets) URL(name string) (string, error) {
+	hash, err := a.hash(name)
+	if err != nil {
+		return "", fmt.Errorf("unknown asset %s: %w", name, err)
+	}
+	return "/web/static/" + name + "?v=" + hash, nil
+}
+
+// VendorURL liefert die lokale Kopie einer Fremdbibliothek bzw. die Herkunfts-URL, solange sie nicht vendort ist
+func (a *Assets) VendorURL(name string) (string, error) {
+	file, ok := a.vendor[name]
+	if !ok {
+		return "", fmt.Errorf("%s is not listed in vendor.json", name)
+	}
+	if local, err := a.URL(path.Join("vendor", name)); err == nil {
+		return local, nil
+	}
+	return file.URL, nil
+}
+
+// Static liefert Dateien unter /web/static/ mit ETag; Anfragen mit passendem ?v= sind unbegrenzt cachebar
+func (a *Assets) Static() http.Handler {
+	return http.StripPrefix("/web/static/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.serve(w, r, r.URL.Path)
+	}))
+}
+
+// staticTypes sind die Dateiendungen, die unter /web/static/ ausgeliefert werden
+var staticTypes = map[string]bool{
+	".js":    true,
+	".css":   true,
+	".woff":  true,
+	".woff2": true,
+	".ttf":   true,
+	".svg":   true,
+	".png":   true,
+	".ico":   true,
+}
+
+func (a *Assets) serve(w http.ResponseWriter, r *http.Request, name string) {
+	// Nur Dateien mit erlaubter Endung; keine Verzeichnisse, keine versteckten Dateien
+	if name != path.Clean("/" + name)[1:] || !staticTypes[path.Ext(name)] || strings.Contains("/"+name, "/.") {
+		http.NotFound(w, r)
+		return
+	}
+	content, err := fs.ReadFile(a.files, path.Join("static", name))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])[:16]
+	w.Header().Set("ETag", `"`+hash+`"`)
+	switch {
+	case a.dev:
+		w.Header().Set("Cache-Control", "no-store")
+	case r.URL.Query().Get("v") == hash:
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	default:
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	// ServeContent setzt Content-Type anhand der Endung und beantwortet If-None-Match mit 304
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+}
+
+func (a *Assets) template() (*template.Template, error) {
+	a.mu.Lock()
+	if a.pages != nil && !a.dev {
+		defer a.mu.Unlock()
+		return a.pages, nil
+	}
+	a.mu.Unlock()
+
+	pages, err := template.New("layout.html").Funcs(template.FuncMap{
+		"asset":  a.URL,
+		"vendor": a.VendorURL,
+	}).ParseFS(a.files, "templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse templates: %w", err)
+	}
+
+	a.mu.Lock()
+	a.pages = pages
+	a.mu.Unlock()
+	return pages, nil
+}
+
+// Origins liefert die Herkunft der noch nicht vendorten Fremdbibliotheken, damit die
+// Content-Security-Policy sie zulassen kann
+func (a *Assets) Origins() []string {
+	seen := map[string]bool{}
+	var origins []string
+	for name, file := range a.vendor {
+		if _, err := a.hash(path.Join("vendor", name)); err == nil {
+			continue
+		}
+		u, err := url.Parse(file.URL)
+		if err != nil || seen[u.Host] {
+			continue
+		}
+		seen[u.Host] = true
+		origins = append(origins, u.Scheme+"://"+u.Host)
+	}
+	sort.Strings(origins)
+	return origins
+}
+
+// Layout rendert die Hauptseite
+func (a *Assets) Layout(w http.ResponseWriter, r *http.Request) {
+	a.render(w, r, "layout.html")
+}
+
+// TwoFactor rendert die Seite zum Einrichten und Prüfen des zweiten Faktors
+func (a *Assets) TwoFactor(w http.ResponseWriter, r *http.Request) {
+	a.render(w, r, "twofactor.html")
+}
+
+func (a *Assets) render(w http.ResponseWriter, r *http.Request, name string) {
+	pages, err := a.template()
+	if err == nil {
+		var page bytes.Buffer
+		if err = pages.ExecuteTemplate(&page, name, nil); err == nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-cache")
+			page.WriteTo(w)
+			return
+		}
+	}
+	slog.ErrorContext(r.Context(), "Failed to render page", "page", name, "error", err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
@@ -0,0 +1,114 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Ereignisse, auf die ein Webhook reagieren kann; entsprechen den Änderungsarten der Datensätze
+var Events = []string{"insert", "update", "delete"}
+
+// Header der Zustellungen; die Signatur ist HMAC-SHA256 über "<timestamp>.<body>" mit dem Secret des Webhooks
+const (
+	HeaderEvent     = "X-CMS-Event"
+	HeaderDelivery  = "X-CMS-Delivery"
+	HeaderTimestamp = "X-CMS-Timestamp"
+	HeaderSignature = "X-CMS-Signature"
+)
+
+// Options enthält die Webhooks und die Regeln für Zustellversuche
+type Options struct {
+	Endpoints   []Endpoint    `yaml:"endpoints"`
+	Timeout     time.Duration `yaml:"timeout"`      // Wartezeit auf die Antwort je Versuch
+	MaxAttempts int           `yaml:"max_attempts"` // Danach gilt eine Zustellung als gescheitert
+	Backoff     time.Duration `yaml:"backoff"`      // Wartezeit nach dem ersten Fehlschlag, verdoppelt sich je Versuch
+	MaxBackoff  time.Duration `yaml:"max_backoff"`
+	Retention   time.Duration `yaml:"retention"` // So lange bleiben abgeschlossene Zustellungen im Protokoll; 0 = unbegrenzt
+}
+
+// Endpoint ist ein Webhook: Ziel-URL, Secret für die Signatur und die Änderungen, die er erhält
+type Endpoint struct {
+	Name   string   `yaml:"name" json:"name"`
+	URL    string   `yaml:"url" json:"url"`
+	Secret string   `yaml:"secret" json:"-"`
+	Schema string   `yaml:"schema" json:"schema,omitempty"` // Leer bedeutet alle Schemas
+	Table  string   `yaml:"table" json:"table,omitempty"`   // Leer bedeutet alle Tabellen des Schemas
+	Events []string `yaml:"events" json:"events,omitempty"` // Leer bedeutet alle Ereignisse
+}
+
+// Matches prüft, ob der Webhook die Änderung an schema.table erhält
+func (e Endpoint) Matches(event, schema, table string) bool {
+	return (e.Schema == "" || e.Schema == schema) && (e.Table == "" || e.Table == table) &&
+		(len(e.Events) == 0 || slices.Contains(e.Events, event))
+}
+
+// Endpoint sucht einen Webhook anhand seines Namens
+func (o Options) Endpoint(name string) (Endpoint, bool) {
+	for _, e := range o.Endpoints {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return Endpoint{}, false
+}
+
+// Delay liefert die Wartezeit nach failed fehlgeschlagenen Versuchen: Backoff, 2×Backoff, 4×Backoff … bis MaxBackoff
+func (o Options) Delay(failed int) time.Duration {
+	delay := o.Backoff
+	for i := 1; i < failed && delay < o.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, o.MaxBackoff)
+}
+
+// Sign berechnet die Signatur im Format von X-CMS-Signature
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Weiterleitungen werden nicht verfolgt; aus einem POST würde sonst ein GET ohne Inhalt
+var client = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// Send stellt den Inhalt einer Zustellung per POST zu und liefert den HTTP-Status (0 ohne Antwort).
+// Jede Antwort außerhalb von 2xx ist ein Fehler.
+func (o Options) Send(ctx context.Context, e Endpoint, delivery int64, event string, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "wuffnetCMS-Webhooks")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(e.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Antwort nur kurz lesen, damit die Verbindung wiederverwendet werden kann
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}